@@ -0,0 +1,39 @@
+package basicauth
+
+import "net/http"
+
+// AllowAny is an AuthFunc which tries the given AuthFuncs in order,
+// e.g. a local admin list, then a database lookup and then an LDAP bind.
+// It returns the user value of the first one which succeeds and the rest are not called,
+// so the order matters: the first ones override the next ones.
+// A failure (false, with or without an error value) of one just moves to the next one.
+// When all of them fail, the failure value (e.g. an ErrUserNotFound) of the last one is returned.
+// Nil AuthFuncs are skipped.
+//
+// Usage:
+//
+//	New(Options{Allow: AllowAny(AllowUsers(admins), allowDatabase, allowLDAP)})
+func AllowAny(funcs ...AuthFunc) AuthFunc {
+	var allowFuncs []AuthFunc
+	for _, fn := range funcs {
+		if fn != nil {
+			allowFuncs = append(allowFuncs, fn)
+		}
+	}
+
+	if len(allowFuncs) == 0 {
+		panic("AllowAny: at least one AuthFunc is required")
+	}
+
+	return func(r *http.Request, username, password string) (interface{}, bool) {
+		var user interface{}
+		for _, allow := range allowFuncs {
+			var ok bool
+			if user, ok = allow(r, username, password); ok {
+				return user, true
+			}
+		}
+
+		return user, false
+	}
+}
@@ -0,0 +1,66 @@
+package basicauth
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestAllowAny(t *testing.T) {
+	var called []string
+	track := func(name string, allow AuthFunc) AuthFunc {
+		return func(r *http.Request, username, password string) (interface{}, bool) {
+			called = append(called, name)
+			return allow(r, username, password)
+		}
+	}
+
+	remoteUser := Map{"username": "kataras", "source": "remote"}
+	allow := AllowAny(
+		track("local", AllowUsers(map[string]string{"kataras": "local_pass"})),
+		nil,
+		track("remote", func(r *http.Request, username, password string) (interface{}, bool) {
+			if username == "kataras" && (password == "local_pass" || password == "remote_pass") {
+				return remoteUser, true
+			}
+
+			return ErrUserNotFound{Username: username}, false
+		}),
+	)
+
+	// The local one overrides the remote one.
+	called = called[:0]
+	if user, ok := allow(nil, "kataras", "local_pass"); !ok || user != nil {
+		t.Fatalf("expected the local user but got: %v, %v", user, ok)
+	}
+	if expected, got := []string{"local"}, called; len(got) != 1 || got[0] != expected[0] {
+		t.Fatalf("expected calls: %v but got: %v", expected, got)
+	}
+
+	// A failure moves to the next one.
+	called = called[:0]
+	if user, ok := allow(nil, "kataras", "remote_pass"); !ok || user.(Map)["source"] != "remote" {
+		t.Fatalf("expected the remote user but got: %v, %v", user, ok)
+	}
+	if len(called) != 2 {
+		t.Fatalf("expected two calls but got: %v", called)
+	}
+
+	// The failure value of the last one.
+	user, ok := allow(nil, "makis", "makis_pass")
+	if ok {
+		t.Fatalf("expected to fail")
+	}
+	if _, isNotFound := user.(ErrUserNotFound); !isNotFound {
+		t.Fatalf("expected an ErrUserNotFound failure but got: %#+v", user)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("expected a panic without AuthFuncs")
+			}
+		}()
+
+		AllowAny(nil)
+	}()
+}
@@ -0,0 +1,189 @@
+package basicauth
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Argon2Params holds the argon2 cost parameters,
+// the memory is in KiB, e.g. 64*1024 for 64 MiB.
+// See the WithArgon2 function.
+type Argon2Params struct {
+	Memory  uint32
+	Time    uint32
+	Threads uint8
+}
+
+// argon2Hash is a decoded argon2 encoded hash,
+// e.g. $argon2id$v=19$m=65536,t=3,p=4$c2FsdA$aGFzaA.
+type argon2Hash struct {
+	variant string // argon2id or argon2i.
+	params  Argon2Params
+	salt    []byte
+	key     []byte
+}
+
+var errArgon2Malformed = errors.New("argon2: malformed hash")
+
+// dummyArgon2Hash is an argon2id hash of the RFC 9106 second recommended parameters,
+// compared against on unknown usernames, see UserAuthOptions.DummyPassword.
+const dummyArgon2Hash = "$argon2id$v=19$m=65536,t=3,p=4$tiQEll8fx9yXrtcMvUSzRw$04qKchsoLI/LXrcfD60D7qQ/bOr021iKjccoQ2D+0og"
+
+func parseArgon2(encoded string) (*argon2Hash, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[0] != "" {
+		return nil, errArgon2Malformed
+	}
+
+	h := &argon2Hash{variant: parts[1]}
+	if h.variant != "argon2id" && h.variant != "argon2i" {
+		return nil, fmt.Errorf("argon2: unsupported variant: %s", h.variant)
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return nil, errArgon2Malformed
+	}
+	if version != argon2.Version {
+		return nil, fmt.Errorf("argon2: unsupported version: %d", version)
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.params.Memory, &h.params.Time, &h.params.Threads); err != nil {
+		return nil, errArgon2Malformed
+	}
+
+	// The argon2 package panics on these, see RFC 9106 section 3.1.
+	p := h.params
+	if p.Time < 1 || p.Threads < 1 || p.Memory < 8*uint32(p.Threads) {
+		return nil, errArgon2Malformed
+	}
+
+	var err error
+	if h.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, errArgon2Malformed
+	}
+
+	if h.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(h.key) == 0 {
+		return nil, errArgon2Malformed
+	}
+
+	return h, nil
+}
+
+// verifyArgon2 compares an argon2 encoded hash with its user input in constant time,
+// the parameters are read from the encoded hash.
+func verifyArgon2(stored, userPassword string) bool {
+	h, err := parseArgon2(stored)
+	if err != nil {
+		return false
+	}
+
+	var key []byte
+	if h.variant == "argon2id" {
+		key = argon2.IDKey([]byte(userPassword), h.salt, h.params.Time, h.params.Memory, h.params.Threads, uint32(len(h.key)))
+	} else {
+		key = argon2.Key([]byte(userPassword), h.salt, h.params.Time, h.params.Memory, h.params.Threads, uint32(len(h.key)))
+	}
+
+	return subtle.ConstantTimeCompare(key, h.key) == 1
+}
+
+// validate reports an error if the given encoded hash is malformed
+// or its parameters are lower than the minimum ones.
+func (min Argon2Params) validate(stored string) error {
+	h, err := parseArgon2(stored)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case h.params.Memory < min.Memory:
+		return fmt.Errorf("argon2: memory cost %d KiB is lower than the minimum %d KiB", h.params.Memory, min.Memory)
+	case h.params.Time < min.Time:
+		return fmt.Errorf("argon2: time cost %d is lower than the minimum %d", h.params.Time, min.Time)
+	case h.params.Threads < min.Threads:
+		return fmt.Errorf("argon2: parallelism %d is lower than the minimum %d", h.params.Threads, min.Threads)
+	}
+
+	return nil
+}
+
+// WithArgon2 returns a UserAuthOption which compares argon2id (or argon2i)
+// encoded hashes, e.g. $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>, with their user input.
+// The verification parameters are read from each stored hash,
+// so rotating cost factors does not break existing users.
+//
+// The "min" parameters are enforced on the stored hashes at load time,
+// too weak (or malformed) hashes are rejected, the AllowUsers and AllowUsersFile panic.
+// Pass a zero Argon2Params to accept any cost.
+//
+// Usage:
+//
+//	AllowUsersFile("users.yml", WithArgon2(Argon2Params{Memory: 64 * 1024, Time: 3, Threads: 1}))
+func WithArgon2(min Argon2Params) UserAuthOption {
+	return withScheme(hashScheme{
+		prefixes: argon2Prefixes,
+		verify:   verifyArgon2,
+		validate: min.validate,
+		dummy:    dummyArgon2Hash,
+	})
+}
+
+var argon2Prefixes = []string{"$argon2id$", "$argon2i$"}
+
+// ARGON2 it is a UserAuthOption, it compares an argon2id (or argon2i) encoded hash,
+// e.g. $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>, with its user input in constant time.
+// The parameters are auto-detected from each stored hash,
+// so rotating cost factors does not break existing users.
+// It is a shortcut of WithArgon2 without minimum parameters.
+//
+// When it is used alone, all the stored passwords should be argon2 encoded hashes:
+// a user list which mixes argon2 hashes with bcrypt hashes (or plain passwords)
+// is rejected cleanly at load time, the AllowUsers and AllowUsersFile panic
+// with the username of the first non-argon2 entry, instead of failing on the user's login.
+// Compose it with other hash options, e.g. AllowUsersFile(..., BCRYPT, ARGON2),
+// to accept a mixed user list, each hash is detected by its prefix.
+//
+// Usage:
+//
+//	Default(..., ARGON2) OR
+//	Load(..., ARGON2) OR
+//	Options.Allow = AllowUsers(..., ARGON2) OR
+//	Options.Allow = AllowUsersFile(..., ARGON2)
+func ARGON2(opts *UserAuthOptions) {
+	WithArgon2(Argon2Params{})(opts)
+}
+
+// ARGON2ID it is a UserAuthOption like ARGON2 but it accepts argon2id hashes only,
+// the recommended variant of RFC 9106. Stored argon2i hashes are rejected at load time.
+//
+// Usage:
+//
+//	Options.Allow = AllowUsersFile("users.yml", ARGON2ID)
+func ARGON2ID(opts *UserAuthOptions) {
+	withScheme(hashScheme{
+		prefixes: argon2Prefixes,
+		verify:   verifyArgon2,
+		validate: validateArgon2ID,
+		dummy:    dummyArgon2Hash,
+	})(opts)
+}
+
+// validateArgon2ID reports an error if the given encoded hash is not an argon2id one.
+func validateArgon2ID(stored string) error {
+	h, err := parseArgon2(stored)
+	if err != nil {
+		return err
+	}
+
+	if h.variant != "argon2id" {
+		return fmt.Errorf("argon2: variant %s is not allowed, argon2id is required", h.variant)
+	}
+
+	return nil
+}
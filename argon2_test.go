@@ -0,0 +1,145 @@
+package basicauth
+
+import (
+	"strings"
+	"testing"
+)
+
+const (
+	// kataras_pass, m=19456 (19 MiB), t=2, p=1.
+	testArgon2Hash = "$argon2id$v=19$m=19456,t=2,p=1$HpDLbeqMVn6u6NPbeQBBVw$QaNtvokNQLK+QsaVKzQeBPkRoE0v/juvQHft4Qv4GUA"
+	// kataras_pass, m=1024 (1 MiB), t=1, p=1.
+	testWeakArgon2Hash = "$argon2id$v=19$m=1024,t=1,p=1$HpDLbeqMVn6u6NPbeQBBVw$AIhrA5rTVCovNlsoF4giofnPdjuvZJSSZuC9x6H6HxE"
+	// kataras_pass, argon2i, m=1024 (1 MiB), t=1, p=1.
+	testArgon2iHash = "$argon2i$v=19$m=1024,t=1,p=1$HpDLbeqMVn6u6NPbeQBBVw$/GLSLfav1akb8SQa/3fy7g1MrlEJ69RzU96QlsLW5Nk"
+)
+
+func TestWithArgon2(t *testing.T) {
+	allow := AllowUsers(map[string]string{
+		"kataras": testArgon2Hash,
+		"makis":   testWeakArgon2Hash,
+	}, WithArgon2(Argon2Params{}))
+
+	var tests = []struct {
+		username, password string
+		ok                 bool
+	}{
+		{"kataras", "kataras_pass", true},
+		{"makis", "kataras_pass", true},
+		{"kataras", "invalid_pass", false},
+		{"kataras", testArgon2Hash, false},
+		{"unknown", "kataras_pass", false},
+	}
+
+	for i, tt := range tests {
+		if _, ok := allow(nil, tt.username, tt.password); tt.ok != ok {
+			t.Fatalf("[%d] expected: %v but got: %v (username=%s,password=%s)", i, tt.ok, ok, tt.username, tt.password)
+		}
+	}
+
+	if _, err := parseArgon2(dummyArgon2Hash); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWithArgon2MinCost(t *testing.T) {
+	min := Argon2Params{Memory: 19 * 1024, Time: 2, Threads: 1}
+
+	// Strong enough.
+	AllowUsers(map[string]string{"kataras": testArgon2Hash}, WithArgon2(min))
+
+	var tests = []struct {
+		hash     string
+		expected string
+	}{
+		{testWeakArgon2Hash, "memory cost 1024 KiB is lower than the minimum 19456 KiB"},
+		{"kataras_pass", "malformed hash"},
+		{"$argon2d$v=19$m=19456,t=2,p=1$c2FsdA$aGFzaA", "unsupported variant"},
+	}
+
+	for i, tt := range tests {
+		func() {
+			defer func() {
+				v := recover()
+				if v == nil {
+					t.Fatalf("[%d] expected a load error", i)
+				}
+
+				if got := v.(string); !strings.Contains(got, tt.expected) {
+					t.Fatalf("[%d] expected a load error containing: %q but got: %q", i, tt.expected, got)
+				}
+			}()
+
+			AllowUsers(map[string]string{"kataras": tt.hash}, WithArgon2(min))
+		}()
+	}
+}
+
+func TestArgon2InvalidParams(t *testing.T) {
+	var hashes = []string{
+		"$argon2id$v=19$m=1024,t=0,p=1$HpDLbeqMVn6u6NPbeQBBVw$AIhrA5rTVCovNlsoF4giofnPdjuvZJSSZuC9x6H6HxE",
+		"$argon2id$v=19$m=1024,t=1,p=0$HpDLbeqMVn6u6NPbeQBBVw$AIhrA5rTVCovNlsoF4giofnPdjuvZJSSZuC9x6H6HxE",
+		"$argon2id$v=19$m=7,t=1,p=1$HpDLbeqMVn6u6NPbeQBBVw$AIhrA5rTVCovNlsoF4giofnPdjuvZJSSZuC9x6H6HxE",
+	}
+
+	for i, hash := range hashes {
+		if _, err := parseArgon2(hash); err != errArgon2Malformed {
+			t.Fatalf("[%d] expected a malformed hash error but got: %v", i, err)
+		}
+
+		// It should not panic on verification.
+		if verifyArgon2(hash, "kataras_pass") {
+			t.Fatalf("[%d] expected verification to fail", i)
+		}
+
+		func() {
+			defer func() {
+				if v := recover(); v == nil || !strings.Contains(v.(string), "malformed hash") {
+					t.Fatalf("[%d] expected a load error but got: %v", i, v)
+				}
+			}()
+
+			AllowUsers(map[string]string{"kataras": hash}, ARGON2)
+		}()
+	}
+}
+
+func TestARGON2(t *testing.T) {
+	var tests = []struct {
+		opt   UserAuthOption
+		users map[string]string
+		panic string
+	}{
+		{ARGON2, map[string]string{"kataras": testArgon2Hash, "makis": testArgon2iHash}, ""},
+		{ARGON2ID, map[string]string{"kataras": testArgon2Hash, "makis": testWeakArgon2Hash}, ""},
+		{ARGON2ID, map[string]string{"kataras": testArgon2Hash, "makis": testArgon2iHash}, "argon2id is required"},
+		// A mixed bcrypt and argon2 user list is rejected on load.
+		{ARGON2, map[string]string{"kataras": testArgon2Hash, "makis": "$2a$10$fmxY9Ky3z4vRtqn8CmX1FeVt.7BOn5ouSzp5jjiSaIkKmMd6Sx4Nu"}, `user "makis": argon2: malformed hash`},
+	}
+
+	for i, tt := range tests {
+		func() {
+			defer func() {
+				v := recover()
+				if tt.panic == "" && v != nil {
+					t.Fatalf("[%d] expected no panic but got: %v", i, v)
+				}
+
+				if tt.panic != "" && (v == nil || !strings.Contains(v.(string), tt.panic)) {
+					t.Fatalf("[%d] expected a panic of: %q but got: %v", i, tt.panic, v)
+				}
+			}()
+
+			allow := AllowUsers(tt.users, tt.opt)
+			for username := range tt.users {
+				if _, ok := allow(nil, username, "kataras_pass"); !ok {
+					t.Fatalf("[%d] expected %q to be allowed", i, username)
+				}
+
+				if _, ok := allow(nil, username, "invalid_pass"); ok {
+					t.Fatalf("[%d] expected %q with an invalid password to be rejected", i, username)
+				}
+			}
+		}()
+	}
+}
@@ -0,0 +1,212 @@
+// Package auditlog provides a file sink for the basicauth authentication events,
+// it writes each event as a JSON line to a file which is rotated by size.
+// It lives in its own package so the core basicauth package stays dependency-free.
+//
+// Usage:
+//
+//	b, auth := basicauth.NewBasicAuth(opts)
+//	w, err := auditlog.New("audit.log", 10<<20) // 10 MiB.
+//	if err != nil { ... }
+//	defer w.Close()
+//	go w.Consume(b.Events())
+package auditlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/kataras/basicauth"
+)
+
+const (
+	// DefaultMaxSize is the default maximum size, in bytes, of the log file before it is rotated.
+	DefaultMaxSize = 10 << 20 // 10 MiB.
+	// DefaultMaxBackups is the default number of rotated files to keep.
+	DefaultMaxBackups = 3
+)
+
+// AuditEntry is the JSON line representation of a basicauth.AuthEvent.
+type AuditEntry struct {
+	Type          string    `json:"type"`
+	Time          time.Time `json:"time"`
+	Username      string    `json:"username,omitempty"`
+	RemoteAddr    string    `json:"remote_addr,omitempty"`
+	ClientIP      string    `json:"client_ip,omitempty"`
+	Error         string    `json:"error,omitempty"`
+	CorrelationID string    `json:"correlation_id,omitempty"`
+}
+
+// NewAuditEntry returns the audit entry of the given event.
+func NewAuditEntry(ev basicauth.AuthEvent) AuditEntry {
+	entry := AuditEntry{
+		Type:          ev.Type.String(),
+		Time:          ev.Time,
+		Username:      ev.Username,
+		RemoteAddr:    ev.RemoteAddr,
+		ClientIP:      ev.ClientIP,
+		CorrelationID: ev.CorrelationID,
+	}
+
+	if ev.Err != nil {
+		entry.Error = ev.Err.Error()
+	}
+
+	return entry
+}
+
+// Writer writes audit entries as JSON lines to a file.
+// When the file would exceed the MaxSize, it is renamed to "filename.1"
+// (the older ones are shifted to "filename.2" and so on, up to MaxBackups)
+// and a new file is created.
+// It is safe for concurrent use.
+type Writer struct {
+	// Filename is the path of the log file.
+	Filename string
+	// MaxSize is the maximum size, in bytes, of the log file before it is rotated.
+	MaxSize int64
+	// MaxBackups is the number of rotated files to keep, the oldest ones are removed.
+	// Zero keeps none.
+	MaxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// New opens (or creates) the log file for appending and returns a new Writer.
+// A zero or negative "maxSize" defaults to DefaultMaxSize.
+// The MaxBackups defaults to DefaultMaxBackups.
+func New(filename string, maxSize int64) (*Writer, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+
+	w := &Writer{
+		Filename:   filename,
+		MaxSize:    maxSize,
+		MaxBackups: DefaultMaxBackups,
+	}
+
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func (w *Writer) open() error {
+	f, err := os.OpenFile(w.Filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	w.file = f
+	w.size = info.Size()
+	return nil
+}
+
+// Write writes the audit entry of the given event as a single JSON line.
+func (w *Writer) Write(ev basicauth.AuthEvent) error {
+	line, err := json.Marshal(NewAuditEntry(ev))
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return os.ErrClosed
+	}
+
+	if w.size > 0 && w.size+int64(len(line)) > w.MaxSize {
+		if err = w.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := w.file.Write(line)
+	w.size += int64(n)
+	return err
+}
+
+// rotate shifts the backups, renames the current file to the first backup
+// and opens a new file. The file is reopened even if the renaming fails,
+// so the next writes are not lost.
+func (w *Writer) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	w.file = nil
+
+	err := w.shift()
+	if openErr := w.open(); openErr != nil {
+		return openErr
+	}
+
+	return err
+}
+
+// shift removes the oldest backup and renames the rest, including the current file.
+func (w *Writer) shift() error {
+	if w.MaxBackups <= 0 {
+		return os.Remove(w.Filename)
+	}
+
+	os.Remove(w.backupName(w.MaxBackups)) // the oldest one, if any.
+	for i := w.MaxBackups - 1; i > 0; i-- {
+		if err := os.Rename(w.backupName(i), w.backupName(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return os.Rename(w.Filename, w.backupName(1))
+}
+
+func (w *Writer) backupName(i int) string {
+	return fmt.Sprintf("%s.%d", w.Filename, i)
+}
+
+// Consume writes the events received from the given channel,
+// e.g. the basicauth.BasicAuth.Events(), until the channel is closed
+// or the Writer is closed (it returns on the next event).
+// It blocks, so it should be called in its own goroutine.
+// Write errors are passed to the optional "onError" callback.
+func (w *Writer) Consume(events <-chan basicauth.AuthEvent, onError ...func(error)) {
+	for ev := range events {
+		if err := w.Write(ev); err != nil {
+			if err == os.ErrClosed {
+				return
+			}
+
+			for _, fn := range onError {
+				fn(err)
+			}
+		}
+	}
+}
+
+// Close closes the log file.
+// Further writes return os.ErrClosed.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
@@ -0,0 +1,142 @@
+package auditlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kataras/basicauth"
+)
+
+func readEntries(t *testing.T, filename string) []AuditEntry {
+	t.Helper()
+
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err = json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("malformed line: %q: %v", scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+func TestWriter(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "audit.log")
+
+	ev := basicauth.AuthEvent{
+		Type:       basicauth.EventFailure,
+		Time:       time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Username:   "kataras",
+		RemoteAddr: "127.0.0.1:1234",
+		Err:        errors.New("invalid"),
+	}
+
+	line, _ := json.Marshal(NewAuditEntry(ev))
+	lineSize := int64(len(line) + 1)
+
+	// Room for 3 lines per file.
+	w, err := New(filename, 3*lineSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.MaxBackups = 2
+
+	for i := 0; i < 10; i++ {
+		if err = w.Write(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 10 entries: 3 (dropped) + 3 (.2) + 3 (.1) + 1 (current).
+	var tests = []struct {
+		filename string
+		entries  int
+	}{
+		{filename, 1},
+		{filename + ".1", 3},
+		{filename + ".2", 3},
+	}
+
+	for _, tt := range tests {
+		entries := readEntries(t, tt.filename)
+		if len(entries) != tt.entries {
+			t.Fatalf("%s: expected %d entries but got: %d", tt.filename, tt.entries, len(entries))
+		}
+
+		for _, entry := range entries {
+			expected := AuditEntry{
+				Type:       "failure",
+				Time:       ev.Time,
+				Username:   "kataras",
+				RemoteAddr: "127.0.0.1:1234",
+				Error:      "invalid",
+			}
+			if entry != expected {
+				t.Fatalf("%s: expected entry: %#+v but got: %#+v", tt.filename, expected, entry)
+			}
+		}
+
+		if info, _ := os.Stat(tt.filename); info.Size() > 3*lineSize {
+			t.Fatalf("%s: expected size up to %d but got: %d", tt.filename, 3*lineSize, info.Size())
+		}
+	}
+
+	if _, err = os.Stat(filename + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("expected no third backup but got: %v", err)
+	}
+
+	if err = w.Write(ev); err != os.ErrClosed {
+		t.Fatalf("expected os.ErrClosed after close but got: %v", err)
+	}
+}
+
+func TestWriterConsume(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "audit.log")
+
+	w, err := New(filename, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := make(chan basicauth.AuthEvent, 2)
+	events <- basicauth.AuthEvent{Type: basicauth.EventSuccess, Username: "kataras"}
+	events <- basicauth.AuthEvent{Type: basicauth.EventLogout, Username: "kataras"}
+	close(events)
+
+	w.Consume(events)
+	w.Close()
+
+	entries := readEntries(t, filename)
+	if len(entries) != 2 || entries[0].Type != "success" || entries[1].Type != "logout" {
+		t.Fatalf("unexpected entries: %#+v", entries)
+	}
+
+	// Appends to the existing file.
+	if w, err = New(filename, 0); err != nil {
+		t.Fatal(err)
+	}
+	w.Write(basicauth.AuthEvent{Type: basicauth.EventSuccess, Username: "makis"})
+	w.Close()
+
+	if entries = readEntries(t, filename); len(entries) != 3 || entries[2].Username != "makis" {
+		t.Fatalf("unexpected entries: %#+v", entries)
+	}
+}
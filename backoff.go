@@ -0,0 +1,136 @@
+package basicauth
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultFailureBackoffMax is the default FailureBackoff.Max duration.
+	DefaultFailureBackoffMax = 5 * time.Second
+	// DefaultFailureBackoffWindow is the default FailureBackoff.Window duration.
+	DefaultFailureBackoffWindow = 15 * time.Minute
+)
+
+// FailureBackoff holds the configuration of the per-client exponential backoff
+// on repeated sign in failures. Each failure of a client (by its IP)
+// inside the Window delays the failed response for Base, 2*Base, 4*Base and so on,
+// up to Max. It makes brute-force impractical while it barely affects
+// the legitimate users, the failures count of a client is reset on its successful sign in.
+// Unlike the MaxTries cookie, the failures are tracked in memory and can not be reset by the client.
+// See the Options.FailureBackoff field.
+type FailureBackoff struct {
+	// Base is the delay of the first failure, it is doubled on each subsequent failure.
+	// Zero disables the backoff.
+	Base time.Duration
+	// Max is the maximum delay.
+	//
+	// Defaults to DefaultFailureBackoffMax.
+	Max time.Duration
+	// Window is the duration after the last failure of a client that its failures count is reset.
+	//
+	// Defaults to DefaultFailureBackoffWindow.
+	Window time.Duration
+}
+
+// failureBackoff implements the FailureBackoff.
+type failureBackoff struct {
+	cfg FailureBackoff
+	// sleep waits for the given duration and reports whether it was not canceled,
+	// see sleepContext.
+	sleep func(ctx context.Context, d time.Duration) bool
+
+	mu      sync.Mutex
+	clients map[string]backoffEntry
+	pruned  time.Time
+}
+
+type backoffEntry struct {
+	failures    int
+	lastFailure time.Time
+}
+
+func newFailureBackoff(cfg FailureBackoff) *failureBackoff {
+	if cfg.Max <= 0 {
+		cfg.Max = DefaultFailureBackoffMax
+	}
+
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultFailureBackoffWindow
+	}
+
+	return &failureBackoff{
+		cfg:     cfg,
+		sleep:   sleepContext,
+		clients: make(map[string]backoffEntry),
+		pruned:  time.Now(),
+	}
+}
+
+// fail records a failure of the given client and returns its delay.
+func (f *failureBackoff) fail(client string, now time.Time) time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if now.Sub(f.pruned) > f.cfg.Window {
+		f.pruneLocked(now)
+	}
+
+	e := f.clients[client]
+	if now.Sub(e.lastFailure) > f.cfg.Window {
+		e.failures = 0
+	}
+	e.failures++
+	e.lastFailure = now
+	f.clients[client] = e
+
+	delay := f.cfg.Base
+	for i := 1; i < e.failures && delay < f.cfg.Max; i++ {
+		delay *= 2
+	}
+
+	if delay > f.cfg.Max {
+		delay = f.cfg.Max
+	}
+
+	return delay
+}
+
+// reset clears the failures of the given client.
+func (f *failureBackoff) reset(client string) {
+	f.mu.Lock()
+	delete(f.clients, client)
+	f.mu.Unlock()
+}
+
+// pruneLocked removes the clients without failures inside the window.
+func (f *failureBackoff) pruneLocked(now time.Time) {
+	for client, e := range f.clients {
+		if now.Sub(e.lastFailure) > f.cfg.Window {
+			delete(f.clients, client)
+		}
+	}
+
+	f.pruned = now
+}
+
+// wait records a failure of the request's client and sleeps for its delay.
+// It reports false if the request was canceled during the sleep.
+func (f *failureBackoff) wait(ctx context.Context, client string) bool {
+	return f.sleep(ctx, f.fail(client, time.Now()))
+}
+
+// sleepContext waits for the given duration or until the context is done,
+// it reports whether the full duration has passed.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
@@ -0,0 +1,103 @@
+package basicauth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFailureBackoff(t *testing.T) {
+	b, auth := NewBasicAuth(Options{
+		Allow: AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		FailureBackoff: FailureBackoff{
+			Base: 100 * time.Millisecond,
+			Max:  time.Second,
+		},
+	})
+
+	var delays []time.Duration
+	b.backoff.sleep = func(ctx context.Context, d time.Duration) bool {
+		delays = append(delays, d)
+		return true
+	}
+
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for i := 0; i < 6; i++ {
+		testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "invalid_pass")).
+			statusCode(http.StatusUnauthorized)
+	}
+
+	// Reset on success.
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).
+		statusCode(http.StatusOK)
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "invalid_pass")).
+		statusCode(http.StatusUnauthorized)
+
+	expected := []time.Duration{
+		100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond,
+		time.Second, time.Second, // capped.
+		100 * time.Millisecond,
+	}
+	if len(expected) != len(delays) {
+		t.Fatalf("expected %d delays but got: %v", len(expected), delays)
+	}
+
+	for i := range expected {
+		if expected[i] != delays[i] {
+			t.Fatalf("[%d] expected delay: %s but got: %s", i, expected[i], delays[i])
+		}
+	}
+}
+
+func TestFailureBackoffPerClient(t *testing.T) {
+	f := newFailureBackoff(FailureBackoff{Base: time.Second, Max: time.Minute, Window: time.Minute})
+	now := time.Now()
+
+	if expected, got := time.Second, f.fail("1.1.1.1", now); expected != got {
+		t.Fatalf("expected delay: %s but got: %s", expected, got)
+	}
+	if expected, got := 2*time.Second, f.fail("1.1.1.1", now); expected != got {
+		t.Fatalf("expected delay: %s but got: %s", expected, got)
+	}
+	// Another client.
+	if expected, got := time.Second, f.fail("2.2.2.2", now); expected != got {
+		t.Fatalf("expected delay: %s but got: %s", expected, got)
+	}
+	// Outside of the window.
+	if expected, got := time.Second, f.fail("1.1.1.1", now.Add(2*time.Minute)); expected != got {
+		t.Fatalf("expected delay: %s but got: %s", expected, got)
+	}
+	// The stale clients are pruned.
+	if expected, got := 1, len(f.clients); expected != got {
+		t.Fatalf("expected %d tracked clients but got: %d", expected, got)
+	}
+}
+
+func TestFailureBackoffCanceled(t *testing.T) {
+	auth := New(Options{
+		Allow:          AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		FailureBackoff: FailureBackoff{Base: time.Hour, Max: time.Hour},
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	req.SetBasicAuth("kataras", "invalid_pass")
+	rec := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(rec, req)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the delay to be canceled with the request's context")
+	}
+}
@@ -1,14 +1,21 @@
 package basicauth
 
 import (
+	"container/list"
 	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"hash/fnv"
 	"log"
+	"net"
 	"net/http"
-	"net/url"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 )
 
 const (
@@ -20,6 +27,9 @@ const (
 	// DefaultCookieMaxAge is the default cookie max age on MaxTries,
 	// when the Options.MaxAge is zero.
 	DefaultCookieMaxAge = time.Hour
+	// DefaultMaxAgeLimit is the default maximum value of the Options.MaxAge,
+	// when the Options.MaxAgeLimit is zero.
+	DefaultMaxAgeLimit = 365 * 24 * time.Hour
 )
 
 // cookieExpireDelete may be set on Cookie.Expire for expiring the given cookie.
@@ -31,6 +41,11 @@ const (
 	proxyAuthenticateHeaderKey  = "Proxy-Authenticate"
 	authorizationHeaderKey      = "Authorization"
 	proxyAuthorizationHeaderKey = "Proxy-Authorization"
+	varyHeaderKey               = "Vary"
+	originHeaderKey             = "Origin"
+	webSocketProtocolHeaderKey  = "Sec-WebSocket-Protocol"
+	cacheControlHeaderKey       = "Cache-Control"
+	forwardedProtoHeaderKey     = "X-Forwarded-Proto"
 )
 
 type (
@@ -65,12 +80,18 @@ func HandlerFunc(auth Middleware, handlerFunc func(http.ResponseWriter, *http.Re
 
 // AuthFunc accepts the current request and the username and password user inputs
 // and it should optionally return a user value and report whether the login succeed or not.
+// On failure it may return an error value instead of a user,
+// which is passed to the ErrorHandler as the ErrCredentialsInvalid.Reason.
 // Look the Options.Allow field.
 //
 // Default implementations are:
 // AllowUsers and AllowUsersFile functions.
 type AuthFunc func(r *http.Request, username, password string) (interface{}, bool)
 
+// Extractor reads the username and password from the request
+// and reports whether they were found. See the Options.Extractor field.
+type Extractor func(r *http.Request) (username, password string, ok bool)
+
 // ErrorHandler should handle the given request credentials failure.
 // See Options.ErrorHandler and DefaultErrorHandler for details.
 type ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
@@ -86,6 +107,25 @@ type Options struct {
 	// Realm directive, read http://tools.ietf.org/html/rfc2617#section-1.2 for details.
 	// E.g. "Authorization Required".
 	Realm string
+	// Realms if not empty overrides the Realm field
+	// and sends one challenge (WWW-Authenticate: Basic realm=...) per realm,
+	// so clients which hold different credential sets per realm can choose one.
+	//
+	// Defaults to nil.
+	Realms []string
+	// RealmFunc if not nil then the realm of the challenge is derived per request,
+	// e.g. distinct realms for the "/admin" and "/api" routes of the same middleware,
+	// so browsers keep separate credential caches. It overrides the Realm and Realms fields,
+	// an empty result falls back to them.
+	//
+	// Usage:
+	//  RealmFunc: func(r *http.Request) string {
+	//    if strings.HasPrefix(r.URL.Path, "/admin") { return "Admin" }
+	//    return "API"
+	//  }
+	//
+	// Defaults to nil.
+	RealmFunc func(r *http.Request) string
 	// In the case of proxies, the challenging status code is 407 (Proxy Authentication Required),
 	// the Proxy-Authenticate response header contains at least one challenge applicable to the proxy,
 	// and the Proxy-Authorization request header is used for providing the credentials to the proxy server.
@@ -98,6 +138,111 @@ type Options struct {
 	//
 	// Defaults to false.
 	HTTPSOnly bool
+	// HTTPSOnlyCode is the status code that the non-https requests are dropped with,
+	// when HTTPSOnly is true. The 505 is kept as the default for compatibility,
+	// prefer the 426 (StatusUpgradeRequired), which sends an "Upgrade: TLS/1.2, HTTP/1.1" header too,
+	// or the 403 (StatusForbidden).
+	//
+	// Defaults to 505 (StatusHTTPVersionNotSupported).
+	HTTPSOnlyCode int
+	// TrustedProxies is a list of IPs and CIDRs, e.g. []string{"10.0.0.0/8", "::1"},
+	// of the reverse proxies which terminate the TLS, e.g. nginx.
+	// When the direct peer of a plain HTTP request is one of them, the HTTPSOnly check
+	// consults its "X-Forwarded-Proto" header instead.
+	// The header is ignored when it comes from any other peer, so it can not be spoofed by the clients.
+	//
+	// Defaults to nil, the X-Forwarded-Proto header is never trusted.
+	TrustedProxies []string
+	// ClientIP if not nil then it returns the client IP of the request,
+	// e.g. behind reverse proxies, where the http.Request.RemoteAddr is the proxy's one.
+	// It is used wherever the client IP matters: the FailureBackoff, the MaxTriesBy ByIP counters,
+	// the session metadata (see SessionMeta.ClientIP and OnNewClientIP) and the events (see AuthEvent.ClientIP).
+	// An empty result falls back to the default one.
+	// See the ClientIPFromHeaders function for a builtin implementation.
+	//
+	// Usage:
+	//  ClientIP: basicauth.ClientIPFromHeaders("X-Forwarded-For", "X-Real-IP")
+	//
+	// Defaults to nil, the IP of the RemoteAddr is used.
+	ClientIP func(r *http.Request) string
+	// CacheAllow if set to true then a stored credential which is not expired yet
+	// skips the Allow call, the user value of its first login is used instead,
+	// until the credential expires. Useful when the Allow is slow, e.g. a remote lookup.
+	// It trades revocation latency for performance: a revoked user is still allowed
+	// until the MaxAge expiration (see Invalidate and Logout too).
+	// It requires the MaxAge field, credentials without an expiration are never cached.
+	//
+	// Defaults to false.
+	CacheAllow bool
+	// AlwaysAdvertiseChallenge if set to true then the challenge header
+	// (WWW-Authenticate or Proxy-Authenticate) is sent on the responses of the allowed
+	// (and the Optional anonymous) requests too, not only on the 401 (or 407) ones,
+	// so clients can discover the authentication requirements. It respects the ChallengeFor field.
+	//
+	// Defaults to false.
+	AlwaysAdvertiseChallenge bool
+	// ChallengeFor if not nil then it reports whether the challenge header
+	// (WWW-Authenticate or Proxy-Authenticate) should be sent on a 401 (or 407) response
+	// of the given request. When it returns false the status code is sent without the header,
+	// e.g. API clients should not trigger a browser prompt, only browser User-Agents should.
+	//
+	// Usage:
+	//  ChallengeFor: func(r *http.Request) bool { return strings.Contains(r.UserAgent(), "Mozilla") }
+	//
+	// Defaults to nil, the header is always sent.
+	ChallengeFor func(r *http.Request) bool
+	// SuppressAuthenticateHeader if set to true then the challenge header
+	// (WWW-Authenticate or Proxy-Authenticate) is omitted on the 401 (or 407) responses
+	// of the requests that look like an AJAX call, so XHR/fetch-based login flows
+	// do not trigger the browser's native credentials dialog.
+	// A request is an AJAX call when its "X-Requested-With" header is "XMLHttpRequest"
+	// or its "Sec-Fetch-Dest" header is "empty" (sent by browsers on fetch and XHR).
+	// Normal navigations still receive the header. It is checked before the ChallengeFor field.
+	//
+	// Defaults to false.
+	SuppressAuthenticateHeader bool
+	// BlockWhenDisabled if set to true then all requests are rejected
+	// with a 503 Service Unavailable (see ErrDisabled) while the middleware is disabled,
+	// instead of being passed through anonymously. See the BasicAuth.Disable method.
+	//
+	// Defaults to false.
+	BlockWhenDisabled bool
+	// PreAuth if not nil then it runs on each request before everything else
+	// (the Disable state, the AllowedHosts, AllowedOrigins, HTTPSOnly and FailureCircuit checks
+	// and the credentials extraction), a non-nil error rejects the request with the PreAuthCode.
+	// A single hook for geo-blocking, IP filtering, maintenance mode or Host validation in user code.
+	//
+	// Usage:
+	//  PreAuth: func(r *http.Request) error {
+	//    if blocked(r.RemoteAddr) { return errors.New("blocked") }
+	//    return nil
+	//  }
+	PreAuth func(r *http.Request) error
+	// PreAuthCode is the status code of the requests rejected by the PreAuth.
+	//
+	// Defaults to 403 (StatusForbidden).
+	PreAuthCode int
+	// AllowedHosts if not empty then requests with a Host header
+	// which is not part of this list are rejected with a 400 Bad Request,
+	// before any authentication, mitigating Host header attacks.
+	// An entry without a port matches the host on any port,
+	// e.g. "example.com" matches both "example.com" and "example.com:8080".
+	//
+	// Defaults to nil.
+	AllowedHosts []string
+	// AllowedOrigins if not empty then state-changing requests (POST, PUT, PATCH and DELETE)
+	// with an Origin header which is not part of this list, e.g. "https://example.com",
+	// are rejected with the OriginRejectCode, even if their credentials are valid.
+	// Browsers send the basic authentication credentials automatically,
+	// so a cross-origin form could perform actions on behalf of the user (CSRF).
+	// Requests without an Origin header (e.g. non-browser clients) are not checked.
+	//
+	// Defaults to nil.
+	AllowedOrigins []string
+	// OriginRejectCode is the status code of the requests rejected by the AllowedOrigins.
+	//
+	// Defaults to 403 (StatusForbidden).
+	OriginRejectCode int
 	// Allow is the only one required field for the Options type.
 	// Can be customized to validate a username and password combination
 	// and return a user object, e.g. fetch from database.
@@ -109,18 +254,75 @@ type Options struct {
 	//  - Allow: AllowUsersFile("users.yml", [BCRYPT])
 	// Look the user.go source file for details.
 	Allow AuthFunc
+	// AllowCertificate if not nil then requests with a verified client TLS certificate
+	// (mutual TLS, the http.Server's TLSConfig.ClientAuth should verify the client certificates)
+	// are authenticated through that function, without basic credentials.
+	// When it returns a nil user then a *SimpleUser with the certificate's Subject Common Name
+	// as its Username is stored instead. When it reports false (or there is no verified certificate)
+	// the basic authentication is used as the fallback.
+	// See the AllowCommonNames function for a builtin implementation.
+	//
+	// Defaults to nil.
+	AllowCertificate func(r *http.Request, cert *x509.Certificate) (interface{}, bool)
+	// TokenAllow if not nil then requests with a "Bearer <token>" authorization header
+	// are authenticated through that function instead of the Allow field,
+	// e.g. the jwks.AllowJWT of the jwks subpackage.
+	// On success the user is stored to the request context the same way, no credential is stored
+	// (a nil user is stored as an empty *SimpleUser). On failure the ErrCredentialsInvalid is fired,
+	// without a username and a password. Requests without a Bearer token
+	// fall back to the basic authentication, as usual.
+	// It is not used when the Extractor field is set.
+	//
+	// Defaults to nil.
+	TokenAllow func(r *http.Request, token string) (interface{}, bool)
+	// AllowSelector can be used to choose the AuthFunc per request,
+	// e.g. multi-tenant applications which route tenants by subdomain
+	// and each tenant has its own user list, without running N separate middlewares.
+	// When it returns nil the Allow field is used instead.
+	//
+	// Usage:
+	//  AllowSelector: func(r *http.Request) basicauth.AuthFunc { return tenants[r.Host] }
+	AllowSelector func(r *http.Request) AuthFunc
+	// Ready is an optional check which runs once on initialization,
+	// e.g. a no-op database query to validate that the credentials backend of the Allow field is reachable.
+	// If it returns a non-nil error then the NewE function fails with that error
+	// (and New panics), so the server fails fast instead of failing on the first user request.
+	//
+	// Usage:
+	//  Ready: db.PingContext
+	Ready func(ctx context.Context) error
 	// MaxAge sets expiration duration for the in-memory credentials map.
 	// By default an old map entry will be removed when the user visits a page.
 	// In order to remove old entries automatically please take a look at the `GC` option too.
+	// It can be overridden per user, see the ExpiringUser interface.
 	//
 	// Usage:
 	//  MaxAge: 30 * time.Minute
 	MaxAge time.Duration
+	// MaxAgeLimit is the maximum allowed value of the MaxAge field,
+	// a greater MaxAge (e.g. a typo of 100 years) is clamped to that limit
+	// and a warning is logged, so the credentials expiration
+	// and the MaxTries cookie lifetime stay within sane bounds.
+	//
+	// Defaults to DefaultMaxAgeLimit (one year).
+	MaxAgeLimit time.Duration
+	// IsExpired if not nil then it decides whether a stored credential has been expired,
+	// instead of the default expiration time comparison, e.g. to implement custom revocation
+	// by checking a global "revoked since" timestamp against the "storedAt" (the first login time).
+	// The "user" is the authenticated user and the "expiresAt" is zero when the MaxAge is zero.
+	// An expired credential is removed and the client is asked for credentials again.
+	//
+	// Usage:
+	//  IsExpired: func(r *http.Request, user interface{}, storedAt, expiresAt time.Time) bool {
+	//    return storedAt.Before(revokedSince) || (!expiresAt.IsZero() && expiresAt.Before(time.Now()))
+	//  }
+	IsExpired func(r *http.Request, user interface{}, storedAt, expiresAt time.Time) bool
 	// If greater than zero then the server will send 403 forbidden status code afer
 	// MaxTries amount of sign in failures (see MaxTriesCookie).
 	// Note that the client can modify the cookie and its value,
 	// do NOT depend for any type of custom domain logic based on this field.
 	// By default the server will re-ask for credentials on invalid credentials, each time.
+	// It can be overridden per user, see the MaxTriesUser interface.
 	MaxTries int
 	// MaxTriesCookie is the cookie name the middleware uses to
 	// store the failures amount on the client side.
@@ -132,6 +334,72 @@ type Options struct {
 	// Defaults to "basicmaxtries".
 	// The MaxTries should be set to greater than zero.
 	MaxTriesCookie string
+	// RealmByTries if not nil then the realm of the challenge, sent after a failed try,
+	// is the result of that function, so the user gets feedback about the remaining attempts,
+	// e.g. append " - last attempt" when tries == max-1.
+	// It overrides the Realm and Realms fields on those responses.
+	// The MaxTries should be set to greater than zero.
+	//
+	// Usage:
+	//  RealmByTries: func(tries, max int) string {
+	//    return fmt.Sprintf("%s (%d attempts left)", basicauth.DefaultRealm, max-tries)
+	//  }
+	RealmByTries func(tries, max int) string
+	// TriesRemainingHeader if not empty then the middleware sets a header of that name,
+	// e.g. "X-Auth-Tries-Remaining", with the number of the remaining attempts
+	// (MaxTries minus the current tries) on the failed, but not yet forbidden, responses.
+	// The MaxTries should be set to greater than zero.
+	//
+	// Defaults to empty.
+	TriesRemainingHeader string
+	// MaxTriesCookiePerRealm if set to true then the MaxTriesCookie name
+	// is suffixed with a short hash of the Realm, e.g. "basicmaxtries_1a2b3c4d".
+	// Useful when more than one middleware with MaxTries runs on the same domain,
+	// so their failure counters are not shared across realms.
+	//
+	// Defaults to false.
+	MaxTriesCookiePerRealm bool
+	// MaxTriesBy is the key of the MaxTries failures counter.
+	// ByIP and ByUsername (or both, ByIP|ByUsername) keep the counter on the server side,
+	// so the client can not reset it by deleting the MaxTriesCookie.
+	// The counters are shared through the Store field when it implements the AttemptStore
+	// (e.g. the MemoryStore), otherwise they are kept in memory. They expire
+	// after MaxAge (or one hour) since the last failure and they are reset on success.
+	// Once the MaxTries is reached the attempts, even with valid credentials,
+	// are rejected with the ErrCredentialsForbidden until the counter expires.
+	// The MaxTries should be set to greater than zero.
+	//
+	// Defaults to ByCookie.
+	MaxTriesBy MaxTriesBy
+	// LockoutBackoff if not nil then after each failure the client is locked out
+	// for the returned duration of the current "tries", e.g. an exponential backoff,
+	// and its attempts inside that window are rejected with the ErrCredentialsLocked
+	// (429 Too Many Requests with a Retry-After header), even with valid credentials.
+	// A zero or negative duration does not lock the client out.
+	// The lockout state is kept next to the tries amount, see MaxTriesBy.
+	// The MaxTries should be set to greater than zero, it is still the hard limit.
+	//
+	// Usage:
+	//  LockoutBackoff: func(tries int) time.Duration {
+	//    return time.Second << (tries - 1) // 1s, 2s, 4s...
+	//  }
+	//
+	// Defaults to nil.
+	LockoutBackoff func(tries int) time.Duration
+	// CookieSecure if set to true then the MaxTriesCookie is sent with the Secure attribute,
+	// so browsers send it back only over HTTPS.
+	//
+	// Defaults to false.
+	CookieSecure bool
+	// CookieSameSite is the SameSite attribute of the MaxTriesCookie,
+	// e.g. http.SameSiteStrictMode.
+	//
+	// Defaults to http.SameSiteDefaultMode, the attribute is omitted.
+	CookieSameSite http.SameSite
+	// CookieDomain is the Domain attribute of the MaxTriesCookie.
+	//
+	// Defaults to empty, the cookie is sent back only to the host that set it.
+	CookieDomain string
 	// ErrorHandler handles the given request credentials failure.
 	// E.g  when the client tried to access a protected resource
 	// with empty or invalid or expired credentials or
@@ -139,6 +407,18 @@ type Options struct {
 	//
 	// Defaults to the DefaultErrorHandler, do not modify if you don't need to.
 	ErrorHandler ErrorHandler
+	// OnSuccess if not nil then it is called on each authenticated request,
+	// just before the next handler, e.g. to increment a Prometheus counter.
+	// The "user" is the authenticated user, the same as the GetUser returns.
+	//
+	// Defaults to nil.
+	OnSuccess func(r *http.Request, user interface{})
+	// OnFailure if not nil then it is called on each failed request,
+	// just before the ErrorHandler. The "username" is the one of the error, if any,
+	// e.g. of an ErrCredentialsInvalid, otherwise it is empty.
+	//
+	// Defaults to nil.
+	OnFailure func(r *http.Request, username string, err error)
 	// ErrorLogger if not nil then it logs any credentials failure errors
 	// that are going to be sent to the client. Set it on debug development state.
 	// Usage:
@@ -146,21 +426,227 @@ type Options struct {
 	//
 	// Defaults to nil.
 	ErrorLogger *log.Logger
+	// LogSuccess if set to true then the ErrorLogger
+	// logs the username and the remote address of each allowed request too.
+	// Useful for debugging purposes, the password is never logged.
+	//
+	// Defaults to false.
+	LogSuccess bool
+	// SetUserHeader if not empty then the middleware sets a header of that name,
+	// e.g. "X-Authenticated-User", with the authenticated username as its value,
+	// on the response and on the request (for downstream handlers and reverse proxies),
+	// so access logs can attribute requests to users.
+	// Any client-sent request header of that name is removed, so it can not be spoofed.
+	//
+	// Defaults to empty.
+	SetUserHeader string
+	// CorrelationHeader if not empty then the value of that request header,
+	// e.g. "X-Request-Id", is included in the ErrorLogger's entries
+	// and in the AuthEvent.CorrelationID field of the Events,
+	// so authentication failures can be tied to the broader request tracing.
+	//
+	// Defaults to empty.
+	CorrelationHeader string
+	// OnNewClientIP if not nil then it is called when a stored credential
+	// is used from a different client IP than the last one, e.g. for anomaly detection alerts.
+	// The "meta" input argument holds the first-seen metadata of the credential.
+	// See the BasicAuth.SessionInfo method too.
+	//
+	// Defaults to nil.
+	OnNewClientIP func(r *http.Request, meta SessionMeta)
 	// GC automatically clears old entries every x duration.
 	// Note that, by old entries we mean expired credentials therefore
 	// the `MaxAge` option should be already set,
-	// if it's not then all entries will be removed on "every" duration.
+	// if it's not then the entries are kept (a warning is logged)
+	// unless the GC.RemoveAllWhenNoMaxAge is true, which removes all entries on "every" duration.
 	// The standard context can be used for the internal ticker cancelation, it can be nil.
 	//
 	// Usage:
 	//  GC: basicauth.GC{Every: 2 * time.Hour}
 	GC GC
+	// OnGCStart if not nil then it is called when the GC goroutine starts.
+	// Together with the OnGCStop and the RunningGC function it makes
+	// the GC goroutine lifecycle observable, e.g. to verify that it is stopped on Close.
+	// The ErrorLogger, if not nil, logs the start and the stop too.
+	//
+	// Defaults to nil.
+	OnGCStart func(every time.Duration)
+	// OnGCStop if not nil then it is called when the GC goroutine stops,
+	// on Close or when the GC.Context is done.
+	//
+	// Defaults to nil.
+	OnGCStop func()
+	// MaxEntries if greater than zero then it limits the number of the stored credentials,
+	// so the memory stays bounded regardless of the number of unique logins.
+	// When the limit is reached, the EvictionPolicy decides which credential is dropped.
+	// An evicted client is validated by the Allow again on its next request.
+	// The evicted credentials are removed from the Options.Store too.
+	//
+	// Defaults to zero (unbounded).
+	MaxEntries int
+	// EvictionPolicy is the policy of the stored credentials when the MaxEntries is reached:
+	// EvictionLRU drops the least recently used, EvictionFIFO drops the oldest login
+	// and EvictionNone does not store the new credentials until there is room again,
+	// each one of them is logged through the ErrorLogger.
+	//
+	// Defaults to EvictionNone.
+	EvictionPolicy EvictionPolicy
+	// MaxSessionsPerUser if greater than zero then it limits the stored credentials
+	// (the simultaneously authenticated sessions) of each username,
+	// e.g. 1 for "one session per user". A session is a distinct username:password combination
+	// (e.g. after a password change or through the CredentialsCookie) stored by the middleware.
+	// When a new login of a user would exceed the limit, it is rejected with an ErrSessionLimit (403 Forbidden)
+	// or the oldest sessions of the user are removed, see EvictOldestSession.
+	//
+	// Defaults to zero (unlimited).
+	MaxSessionsPerUser int
+	// EvictOldestSession if set to true then the oldest sessions (by their first login)
+	// of a user are removed to make room for the new login, instead of rejecting it.
+	// The MaxSessionsPerUser should be greater than zero.
+	//
+	// Defaults to false.
+	EvictOldestSession bool
+	// Store if not nil then the credentials expiration is shared through that store,
+	// e.g. a Redis-backed one, across multiple instances of the application
+	// behind a load balancer. The new credentials are written to it,
+	// they are read from it when they are not stored locally (e.g. logged in through another instance),
+	// they are removed from it on logout and expiration, and its GC runs with the Options.GC.
+	// A credential which is missing from the store (e.g. logged out through another instance)
+	// is removed locally too.
+	// See the NewMemoryStore for an in-process implementation.
+	//
+	// Defaults to nil, the credentials are stored in memory only.
+	Store CredentialStore
+	// StoreFailurePolicy is the behavior when the Store fails to store a new credential:
+	// StoreFailOpen authenticates the request anyway and logs the error,
+	// StoreFailClosed rejects it with a 503 Service Unavailable.
+	//
+	// Defaults to StoreFailOpen.
+	StoreFailurePolicy StoreFailurePolicy
 	// OnLogoutClearContext will clear the context values stored by
 	// the middleware when Logout is called.
 	// This means that the GetUser will return nil after a Logout call was made.
 	//
 	// Defaults to false.
 	OnLogoutClearContext bool
+	// ContextNamespace if not empty then the authenticated user is stored
+	// under that namespace too, so it can be retrieved through the
+	// GetUserNamespace package-level function.
+	// Useful when multiple middlewares are chained and each one
+	// should retrieve its own user. Note that the BasicAuth.GetUser method
+	// always reads the instance's own user, even when the namespace is empty.
+	//
+	// Defaults to empty.
+	ContextNamespace string
+	// UserContextKey if not nil then the authenticated user is stored
+	// under that caller-supplied context key too, in addition to the package's own key,
+	// so other libraries (e.g. template renderers) can read it through r.Context().Value(key).
+	// The key should be comparable and, as the context.WithValue suggests,
+	// of a custom type to avoid collisions.
+	//
+	// Defaults to nil.
+	UserContextKey interface{}
+	// Optional if set to true then requests without any credentials
+	// are passed through to the next handler anonymously instead of being challenged.
+	// Malformed or invalid credentials are still rejected.
+	// Use the IsAnonymous package-level function to check
+	// whether the current request was served without credentials.
+	//
+	// Defaults to false.
+	Optional bool
+	// CredentialSeparator is the byte which separates the username and the password
+	// of the decoded authorization header value. The RFC defines it as a colon,
+	// change it only for custom clients which use a different separator.
+	//
+	// Defaults to ':'.
+	CredentialSeparator byte
+	// NormalizeForm is the Unicode normalization form which is applied
+	// to the username and the password before the credentials lookup and the Allow,
+	// so the same logical username typed by different input methods (e.g. "é" as a single code point
+	// or as "e" followed by a combining accent) is authenticated, and stored, identically.
+	// Note that the stored user list should be in the same form,
+	// e.g. NormalizeNFC for usernames and passwords typed in Go source files.
+	//
+	// Defaults to NormalizeNone.
+	NormalizeForm NormalizationForm
+	// Charset if not empty then the challenge advertises the encoding
+	// the client should use for the credentials, e.g. `Basic realm="...", charset="UTF-8"`.
+	// RFC 7617 allows only the "UTF-8" value. When it is set, the decoded credentials
+	// are treated as UTF-8 and an invalid UTF-8 username or password is rejected as malformed.
+	//
+	// Defaults to empty, no charset parameter is sent.
+	Charset string
+	// WebSocketProtocol if not empty then the middleware reads the credentials
+	// from the Sec-WebSocket-Protocol request header when the authorization header is missing,
+	// as browser WebSocket clients can not set the authorization header.
+	// The credentials entry is the protocol name, a dot and the unpadded base64url encoded username:password,
+	// e.g. "basicauth.a2F0YXJhczprYXRhcmFzX3Bhc3M". The client should offer the protocol name itself too,
+	// it is echoed back on the response (the handshake requires one of the offered protocols):
+	//
+	//  new WebSocket(url, ["basicauth", "basicauth." + btoa("username:password").replace(...)])
+	//
+	// Note that WebSocket libraries which write their own handshake response
+	// should be configured to select that protocol too.
+	//
+	// Defaults to empty.
+	WebSocketProtocol string
+	// CredentialsCookie if not empty then the middleware reads the credentials
+	// from the cookie with that name when the authorization header is missing.
+	// The cookie value should be the base64 encoded username:password,
+	// as in the authorization header without the "Basic " prefix.
+	// Useful for browser-based flows which store the credentials
+	// after the first login in order to avoid the native prompt.
+	// Logout removes that cookie too.
+	//
+	// Defaults to empty.
+	CredentialsCookie string
+	// Extractor if not nil then it is used to read the credentials from the request
+	// instead of the authorization header (and the CredentialsCookie).
+	// When it reports false the request is handled as a request without credentials.
+	//
+	// Defaults to nil.
+	Extractor Extractor
+	// DisableVaryHeader if set to true then the middleware does NOT
+	// add the "Vary: Authorization" (or Proxy-Authorization) response header.
+	// By default it is sent on both successful and challenge responses,
+	// so caches and CDNs in front of the application
+	// never serve one user's response to another.
+	// It is an opt-out (instead of a SetVaryHeader field which defaults to true)
+	// because the zero value of a bool field can not be told apart from an explicit false,
+	// so Options{} keeps sending the header.
+	//
+	// Defaults to false.
+	DisableVaryHeader bool
+	// NoStore if set to true then the middleware sets the "Cache-Control: private, no-store"
+	// header on the authenticated responses, so intermediaries and browsers never cache them.
+	// The handler can still override it.
+	//
+	// Defaults to false.
+	NoStore bool
+	// FailureCircuit configures a global circuit breaker,
+	// after a number of failures per time window across all users
+	// all requests are temporarily rejected with 503 (or let through, see FailOpen).
+	// It protects the credentials backend during a credential-stuffing storm.
+	//
+	// Usage:
+	//  FailureCircuit: basicauth.FailureCircuit{Threshold: 100, Window: time.Minute, OpenFor: 30 * time.Second}
+	FailureCircuit FailureCircuit
+	// FailureBackoff configures a per-client exponential backoff on the sign in failures,
+	// each failure of the same client IP delays its failed response longer, up to a maximum,
+	// and a successful sign in resets it. The delay is canceled when the request's context is done.
+	//
+	// Usage:
+	//  FailureBackoff: basicauth.FailureBackoff{Base: 100 * time.Millisecond, Max: 5 * time.Second}
+	FailureBackoff FailureBackoff
+	// RateLimit if not nil then the authentication attempts which reach the Allow
+	// are rate limited through a token bucket, globally, per client IP or per username,
+	// the rejected ones receive a 429 Too Many Requests (see ErrTooManyRequests).
+	//
+	// Usage:
+	//  RateLimit: &basicauth.RateLimit{Rate: 5, Burst: 10, By: basicauth.RateLimitByIP}
+	//
+	// Defaults to nil.
+	RateLimit *RateLimit
 }
 
 // GC holds the context and the tick duration to clear expired stored credentials.
@@ -168,6 +654,26 @@ type Options struct {
 type GC struct {
 	Context context.Context
 	Every   time.Duration
+	// RemoveAllWhenNoMaxAge reports whether the GC should remove
+	// the entries without an expiration, e.g. all entries when the Options.MaxAge is zero,
+	// on every tick. The clients have to pass through the Allow function again.
+	//
+	// Defaults to false, these entries are kept.
+	RemoveAllWhenNoMaxAge bool
+}
+
+// GCStats holds the accumulated statistics of the GC runs,
+// both the Options.GC ticks and the manual BasicAuth.GC calls.
+// See the BasicAuth.GCStats method.
+type GCStats struct {
+	// Runs is the number of the GC runs.
+	Runs int64
+	// LastRun is the time of the last GC run, zero if it never ran.
+	LastRun time.Time
+	// LastRemoved is the number of the credentials removed by the last GC run.
+	LastRemoved int
+	// TotalRemoved is the number of the credentials removed by all GC runs.
+	TotalRemoved int64
 }
 
 // BasicAuth implements the basic access authentication.
@@ -193,14 +699,72 @@ type BasicAuth struct {
 	askCode             int
 	authorizationHeader string
 	authenticateHeader  string
-	// built based on realm field.
-	authenticateHeaderValue string
+	// built based on realm(s) field.
+	authenticateHeaderValues []string
 
-	// credentials stores the user expiration,
-	// key = username:password, value = expiration time (if MaxAge > 0).
-	credentials map[string]*time.Time // TODO: think of just a uint64 here (unix seconds).
-	// protects the credentials concurrent access.
+	// credentials stores the user expiration and session metadata,
+	// key = the hash of the username:password (see fullUserKey),
+	// value = expiration time (if MaxAge > 0) and metadata.
+	credentials map[string]*credential
+	// the storing order of the credentials, the most recent first,
+	// nil when the MaxEntries is not set, see EvictionPolicy.
+	order *list.List
+	// protects the credentials and their order concurrent access.
 	mu sync.RWMutex
+
+	// the per-instance context key of the user, see GetUser method.
+	userContextKey interface{}
+
+	// built based on the allowed hosts field (lowercase).
+	allowedHosts map[string]struct{}
+	// the parsed Options.TrustedProxies.
+	trustedProxies ipList
+	// built based on the allowed origins field (lowercase).
+	allowedOrigins map[string]struct{}
+
+	// the authentication events, created on the first Events call, see emit.
+	events atomic.Pointer[chan AuthEvent]
+
+	// the current Options.Allow, see Reload.
+	allowFn atomic.Pointer[AuthFunc]
+
+	// the global failures circuit breaker, nil if disabled.
+	circuit *circuitBreaker
+	// the per-client failures backoff, nil if disabled.
+	backoff *failureBackoff
+	// the attempts rate limiter, nil if disabled.
+	limiter *rateLimiter
+	// the server-side failures counters, nil when Options.MaxTriesBy is ByCookie.
+	attempts AttemptStore
+	// the in-memory attempts, when the Options.Store does not implement the AttemptStore.
+	localAttempts *MemoryStore
+	// the MaxTriesUser overrides, per username, see maxTries.
+	userMaxTries   map[string]int
+	userMaxTriesMu sync.RWMutex
+
+	// temporary credentials, see AddTemporary.
+	temporary   map[string]*temporaryCredential
+	temporaryMu sync.Mutex
+
+	// reports whether the authentication is disabled, see Disable.
+	disabled atomic.Bool
+
+	// tracks the in-flight requests and the GC, see Close.
+	inflight sync.WaitGroup
+	closeMu  sync.RWMutex
+	closed   bool
+	stopGC   context.CancelFunc
+	gcDone   chan struct{}
+
+	// the accumulated GC statistics, see GCStats.
+	gcStats   GCStats
+	gcStatsMu sync.Mutex
+
+	// built based on max tries cookie and max age fields.
+	triesCookieMaxAge  time.Duration
+	triesCookiePrefix  string
+	triesCookieExpires string
+	triesCookieSuffix  string
 }
 
 // New returns a new basic authentication middleware.
@@ -228,19 +792,75 @@ type BasicAuth struct {
 //
 // Look the BasicAuth type docs for more information.
 func New(opts Options) Middleware {
+	auth, err := NewE(opts)
+	if err != nil {
+		panic(err)
+	}
+
+	return auth
+}
+
+// NewE same as New but it returns an error instead of panicking.
+// It fails when the Options.Allow field is missing
+// or when the Options.Ready check did not pass.
+//
+// Usage:
+//
+//	auth, err := basicauth.NewE(opts)
+//	if err != nil {
+//		log.Fatal(err) // e.g. the database is unreachable.
+//	}
+func NewE(opts Options) (Middleware, error) {
+	b, err := newBasicAuth(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.Wrap, nil
+}
+
+// NewBasicAuth same as New but it returns the BasicAuth instance too,
+// so it can be managed after construction, e.g. through its GC, Len and Reload methods.
+// The returned Middleware is the same as the instance's Wrap method.
+//
+// Usage:
+//
+//	b, auth := basicauth.NewBasicAuth(opts)
+//	http.ListenAndServe(":8080", auth(mux)) // or b.Wrap(mux).
+func NewBasicAuth(opts Options) (*BasicAuth, Middleware) {
+	b, err := newBasicAuth(opts)
+	if err != nil {
+		panic(err)
+	}
+
+	return b, b.Wrap
+}
+
+func newBasicAuth(opts Options) (*BasicAuth, error) {
 	var (
-		askCode                 = http.StatusUnauthorized
-		authorizationHeader     = authorizationHeaderKey
-		authenticateHeader      = authenticateHeaderKey
-		authenticateHeaderValue = "Basic"
+		askCode                  = http.StatusUnauthorized
+		authorizationHeader      = authorizationHeaderKey
+		authenticateHeader       = authenticateHeaderKey
+		authenticateHeaderValues []string
 	)
 
 	if opts.Allow == nil {
-		panic("BasicAuth: Allow field is required")
+		return nil, errors.New("BasicAuth: Allow field is required")
+	}
+
+	if opts.Ready != nil {
+		if err := opts.Ready(context.Background()); err != nil {
+			return nil, fmt.Errorf("BasicAuth: ready: %w", err)
+		}
+	}
+
+	realms := opts.Realms
+	if len(realms) == 0 {
+		realms = []string{opts.Realm}
 	}
 
-	if opts.Realm != "" {
-		authenticateHeaderValue += " realm=" + strconv.Quote(opts.Realm)
+	for _, realm := range realms {
+		authenticateHeaderValues = append(authenticateHeaderValues, challengeValue(realm, opts.Charset))
 	}
 
 	if opts.Proxy {
@@ -249,28 +869,118 @@ func New(opts Options) Middleware {
 		authorizationHeader = proxyAuthorizationHeaderKey
 	}
 
-	if opts.MaxTries > 0 && opts.MaxTriesCookie == "" {
+	if opts.CredentialSeparator == 0 {
+		opts.CredentialSeparator = colonChar
+	}
+
+	if opts.MaxAgeLimit <= 0 {
+		opts.MaxAgeLimit = DefaultMaxAgeLimit
+	}
+
+	if opts.MaxAge > opts.MaxAgeLimit {
+		warn := log.Printf
+		if opts.ErrorLogger != nil {
+			warn = opts.ErrorLogger.Printf
+		}
+		warn("BasicAuth: MaxAge: %s exceeds the limit of %s, clamped", opts.MaxAge, opts.MaxAgeLimit)
+		opts.MaxAge = opts.MaxAgeLimit
+	}
+
+	// Even if MaxTries is zero, it can be enabled per user, see MaxTriesUser.
+	if opts.MaxTriesCookie == "" {
 		opts.MaxTriesCookie = DefaultMaxTriesCookie
 	}
 
+	if opts.MaxTriesCookiePerRealm {
+		opts.MaxTriesCookie += "_" + realmHash(opts.Realm)
+	}
+
 	if opts.ErrorHandler == nil {
 		opts.ErrorHandler = DefaultErrorHandler
 	}
 
 	b := &BasicAuth{
-		opts:                    opts,
-		askCode:                 askCode,
-		authorizationHeader:     authorizationHeader,
-		authenticateHeader:      authenticateHeader,
-		authenticateHeaderValue: authenticateHeaderValue,
-		credentials:             make(map[string]*time.Time),
+		opts:                     opts,
+		askCode:                  askCode,
+		authorizationHeader:      authorizationHeader,
+		authenticateHeader:       authenticateHeader,
+		authenticateHeaderValues: authenticateHeaderValues,
+		credentials:              make(map[string]*credential),
+		order:                    newEvictionList(opts),
+	}
+	b.allowFn.Store(&opts.Allow)
+
+	if len(opts.AllowedHosts) > 0 {
+		b.allowedHosts = make(map[string]struct{}, len(opts.AllowedHosts))
+		for _, host := range opts.AllowedHosts {
+			b.allowedHosts[strings.ToLower(host)] = struct{}{}
+		}
+	}
+
+	if len(opts.TrustedProxies) > 0 {
+		trustedProxies, err := parseIPList(opts.TrustedProxies)
+		if err != nil {
+			return nil, fmt.Errorf("BasicAuth: TrustedProxies: %w", err)
+		}
+		b.trustedProxies = trustedProxies
+	}
+
+	if len(opts.AllowedOrigins) > 0 {
+		b.allowedOrigins = make(map[string]struct{}, len(opts.AllowedOrigins))
+		for _, origin := range opts.AllowedOrigins {
+			b.allowedOrigins[strings.ToLower(strings.TrimSuffix(origin, "/"))] = struct{}{}
+		}
+	}
+
+	if opts.ContextNamespace != "" {
+		b.userContextKey = namespaceContextKey(opts.ContextNamespace)
+	} else {
+		b.userContextKey = instanceContextKey{b}
+	}
+
+	b.buildTriesCookie()
+	if opts.MaxTriesBy != ByCookie {
+		if s, ok := opts.Store.(AttemptStore); ok {
+			b.attempts = s
+		} else {
+			b.localAttempts = NewMemoryStore()
+			b.attempts = b.localAttempts
+		}
+	}
+
+	if opts.FailureCircuit.Threshold > 0 {
+		b.circuit = &circuitBreaker{cfg: opts.FailureCircuit}
+	}
+
+	if opts.FailureBackoff.Base > 0 {
+		b.backoff = newFailureBackoff(opts.FailureBackoff)
+	}
+
+	if opts.RateLimit != nil && opts.RateLimit.Rate > 0 {
+		b.limiter = newRateLimiter(*opts.RateLimit)
 	}
 
 	if opts.GC.Every > 0 {
-		go b.runGC(opts.GC.Context, opts.GC.Every)
+		ctx := opts.GC.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+
+		if opts.MaxAge == 0 && !opts.GC.RemoveAllWhenNoMaxAge {
+			warn := log.Printf
+			if opts.ErrorLogger != nil {
+				warn = opts.ErrorLogger.Printf
+			}
+			warn("BasicAuth: GC: MaxAge is zero, entries are kept, see GC.RemoveAllWhenNoMaxAge")
+		}
+
+		ctx, b.stopGC = context.WithCancel(ctx)
+		b.gcDone = make(chan struct{})
+		b.startGC()
+		go b.runGC(ctx, opts.GC.Every)
 	}
 
-	return b.serveHTTP
+	return b, nil
 }
 
 // Default returns a new basic authentication middleware
@@ -313,9 +1023,38 @@ func Load(jsonOrYamlFilename string, userOpts ...UserAuthOption) Middleware {
 	return New(opts)
 }
 
-func (b *BasicAuth) getCurrentTries(r *http.Request) (tries int) {
+// FileServer returns a handler which serves the files of the "dir" directory,
+// directory listings included, to authenticated requests only.
+// It's a shortcut of New(opts)(http.FileServer(http.Dir(dir))).
+// It panics if the Options.Allow field is missing, as New does.
+//
+// Usage:
+//
+//	http.Handle("/static/", http.StripPrefix("/static/", FileServer(opts, "./public")))
+func FileServer(opts Options, dir string) http.Handler {
+	return New(opts)(http.FileServer(http.Dir(dir)))
+}
+
+// realmHash returns a short, cookie-name safe, hash of the given realm.
+func realmHash(realm string) string {
+	h := fnv.New32a()
+	h.Write([]byte(realm))
+	return strconv.FormatUint(uint64(h.Sum32()), 16)
+}
+
+// getCurrentTries returns the tries amount of the MaxTries cookie
+// and the end of its lockout window (see Options.LockoutBackoff), if any.
+// The cookie value is "tries" or "tries-unix" when the client is locked out.
+func (b *BasicAuth) getCurrentTries(r *http.Request) (tries int, lockedUntil time.Time) {
 	if cookie, err := r.Cookie(b.opts.MaxTriesCookie); err == nil {
 		if v := cookie.Value; v != "" {
+			if idx := strings.IndexByte(v, triesLockoutSeparator); idx > 0 {
+				if sec, err := strconv.ParseInt(v[idx+1:], 10, 64); err == nil {
+					lockedUntil = time.Unix(sec, 0)
+				}
+				v = v[:idx]
+			}
+
 			tries, _ = strconv.Atoi(v)
 		}
 	}
@@ -323,29 +1062,78 @@ func (b *BasicAuth) getCurrentTries(r *http.Request) (tries int) {
 	return
 }
 
-func (b *BasicAuth) setCurrentTries(w http.ResponseWriter, tries int) {
-	maxAge := b.opts.MaxAge
-	if maxAge == 0 {
-		maxAge = DefaultCookieMaxAge // 1 hour.
+// triesLockoutSeparator separates the tries amount and the lockout end of the MaxTries cookie value.
+const triesLockoutSeparator = '-'
+
+// buildTriesCookie precomputes the static parts of the MaxTries cookie,
+// so setCurrentTries does not have to build a new http.Cookie on each failure.
+func (b *BasicAuth) buildTriesCookie() {
+	b.triesCookieMaxAge = b.opts.MaxAge
+	if b.triesCookieMaxAge == 0 {
+		b.triesCookieMaxAge = DefaultCookieMaxAge // 1 hour.
 	}
 
-	c := &http.Cookie{
+	// Same order and validation as the http.Cookie.String method,
+	// the static parts are built by it and the value and expiration are filled on each failure.
+	b.triesCookiePrefix = b.opts.MaxTriesCookie + "=" // the value follows.
+	head := (&http.Cookie{
+		Name:   b.opts.MaxTriesCookie,
+		Path:   "/",
+		Domain: b.opts.CookieDomain,
+	}).String()
+	b.triesCookieExpires = strings.TrimPrefix(head, b.triesCookiePrefix) + "; Expires="
+	tail := (&http.Cookie{
 		Name:     b.opts.MaxTriesCookie,
-		Path:     "/",
-		Value:    url.QueryEscape(strconv.Itoa(tries)),
+		MaxAge:   int(b.triesCookieMaxAge.Seconds()),
 		HttpOnly: true,
-		Expires:  time.Now().Add(maxAge),
-		MaxAge:   int(maxAge.Seconds()),
+		Secure:   b.opts.CookieSecure,
+		SameSite: b.opts.CookieSameSite,
+	}).String()
+	b.triesCookieSuffix = strings.TrimPrefix(tail, b.triesCookiePrefix)
+}
+
+var triesCookiePool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, 128)
+		return &buf
+	},
+}
+
+// setCurrentTries sets the MaxTries cookie to the given tries value.
+// This is the hot path of a failure, e.g. under a credential-stuffing attack,
+// the header value is identical to the http.SetCookie's one.
+func (b *BasicAuth) setCurrentTries(w http.ResponseWriter, tries int) {
+	b.setCurrentTriesLockout(w, tries, time.Time{})
+}
+
+// setCurrentTriesLockout sets the MaxTries cookie to the given tries value
+// and the end of its lockout window, if not zero, see Options.LockoutBackoff.
+func (b *BasicAuth) setCurrentTriesLockout(w http.ResponseWriter, tries int, lockedUntil time.Time) {
+	bufPtr := triesCookiePool.Get().(*[]byte)
+	buf := append((*bufPtr)[:0], b.triesCookiePrefix...)
+	buf = strconv.AppendInt(buf, int64(tries), 10)
+	if !lockedUntil.IsZero() {
+		buf = append(buf, triesLockoutSeparator)
+		buf = strconv.AppendInt(buf, lockedUntil.Unix(), 10)
 	}
+	buf = append(buf, b.triesCookieExpires...)
+	buf = time.Now().Add(b.triesCookieMaxAge).UTC().AppendFormat(buf, http.TimeFormat)
+	buf = append(buf, b.triesCookieSuffix...)
 
-	http.SetCookie(w, c)
+	w.Header().Add("Set-Cookie", string(buf))
+
+	*bufPtr = buf
+	triesCookiePool.Put(bufPtr)
 }
 
 func (b *BasicAuth) resetCurrentTries(w http.ResponseWriter) {
 	c := &http.Cookie{
 		Name:     b.opts.MaxTriesCookie,
 		Path:     "/",
+		Domain:   b.opts.CookieDomain,
 		HttpOnly: true,
+		Secure:   b.opts.CookieSecure,
+		SameSite: b.opts.CookieSameSite,
 		Expires:  cookieExpireDelete,
 		MaxAge:   -1,
 	}
@@ -353,121 +1141,504 @@ func (b *BasicAuth) resetCurrentTries(w http.ResponseWriter) {
 	http.SetCookie(w, c)
 }
 
+// isAllowedHost reports whether the given Host header value
+// matches one of the Options.AllowedHosts, with or without its port.
+func (b *BasicAuth) isAllowedHost(host string) bool {
+	host = strings.ToLower(host)
+	if _, ok := b.allowedHosts[host]; ok {
+		return true
+	}
+
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		_, ok := b.allowedHosts[hostname]
+		return ok
+	}
+
+	return false
+}
+
+// isAllowedOrigin reports whether the given Origin header value
+// matches one of the Options.AllowedOrigins.
+func (b *BasicAuth) isAllowedOrigin(origin string) bool {
+	_, ok := b.allowedOrigins[strings.ToLower(origin)]
+	return ok
+}
+
+// isStateChanging reports whether the given method may change the server state,
+// see Options.AllowedOrigins.
+func isStateChanging(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// isHTTPS reports whether the request was made over TLS,
+// regardless of the HTTP version (HTTP/1.1 or HTTP/2).
 func isHTTPS(r *http.Request) bool {
-	return (strings.EqualFold(r.URL.Scheme, "https") || r.TLS != nil) && r.ProtoMajor == 2
+	return strings.EqualFold(r.URL.Scheme, "https") || r.TLS != nil
+}
+
+// isSecure reports whether the request was made over TLS, directly
+// or through one of the Options.TrustedProxies (see the X-Forwarded-Proto header).
+func (b *BasicAuth) isSecure(r *http.Request) bool {
+	if isHTTPS(r) {
+		return true
+	}
+
+	if len(b.trustedProxies) == 0 || !b.trustedProxies.contains(remoteIP(r)) {
+		return false
+	}
+
+	// The first one is the protocol of the client, e.g. "https, http" through a proxies chain.
+	proto := r.Header.Get(forwardedProtoHeaderKey)
+	if idx := strings.IndexByte(proto, ','); idx >= 0 {
+		proto = proto[:idx]
+	}
+
+	return strings.EqualFold(strings.TrimSpace(proto), "https")
+}
+
+// allow reports whether the given username:password combination is allowed,
+// the temporary credentials are checked first and then the Options.Allow field.
+// The "temporary" reports whether it was allowed through a temporary credential, see AddTemporary.
+func (b *BasicAuth) allow(r *http.Request, username, password string) (user interface{}, ok, temporary bool) {
+	if b.useTemporary(username, password) {
+		return nil, true, true
+	}
+
+	if b.opts.AllowSelector != nil {
+		if allow := b.opts.AllowSelector(r); allow != nil {
+			user, ok = allow(r, username, password)
+			return
+		}
+	}
+
+	user, ok = (*b.allowFn.Load())(r, username, password)
+	return
+}
+
+// Reload replaces the Options.Allow at runtime, e.g. after the user list was modified.
+// The stored credentials which are no longer allowed fail on their next request
+// (see ErrCredentialsRotated), unless the Options.CacheAllow is true.
+// It is safe for concurrent use. It returns an error if the "allow" is nil.
+func (b *BasicAuth) Reload(allow AuthFunc) error {
+	if allow == nil {
+		return errors.New("BasicAuth: Allow field is required")
+	}
+
+	b.allowFn.Store(&allow)
+	return nil
+}
+
+// GC removes the expired stored credentials (see Options.MaxAge) now
+// and returns their number. It is the same as the Options.GC tick,
+// useful when the GC goroutine is not enabled or on admin operations.
+func (b *BasicAuth) GC() int {
+	return b.gc()
+}
+
+// GCStats returns a snapshot of the accumulated GC statistics,
+// e.g. to be exposed by a metrics endpoint along with the Len method.
+func (b *BasicAuth) GCStats() GCStats {
+	b.gcStatsMu.Lock()
+	stats := b.gcStats
+	b.gcStatsMu.Unlock()
+
+	return stats
+}
+
+// correlationID returns the value of the Options.CorrelationHeader, if any.
+func (b *BasicAuth) correlationID(r *http.Request) string {
+	if b.opts.CorrelationHeader == "" {
+		return ""
+	}
+
+	return r.Header.Get(b.opts.CorrelationHeader)
 }
 
 func (b *BasicAuth) handleError(w http.ResponseWriter, r *http.Request, err error) {
 	if b.opts.ErrorLogger != nil {
-		b.opts.ErrorLogger.Println(err)
+		if id := b.correlationID(r); id != "" {
+			b.opts.ErrorLogger.Printf("[%s] %v", id, err)
+		} else {
+			b.opts.ErrorLogger.Println(err)
+		}
+	}
+
+	username := errorUsername(err)
+	b.emit(r, EventFailure, username, err)
+
+	if b.opts.OnFailure != nil {
+		b.opts.OnFailure(r, username, err)
 	}
 
 	// should not be nil as it's defaulted on New.
 	b.opts.ErrorHandler(w, r, err)
 }
 
-// serveHTTP is the main method of this middleware,
+// Wrap is the main method of this middleware,
 // checks and verifies the auhorization header for basic authentication,
 // next handlers will only be executed when the client is allowed to continue.
-func (b *BasicAuth) serveHTTP(next http.Handler) http.Handler {
+//
+// It is the same as the Middleware returned by New,
+// useful for routers which expect a named method.
+//
+// Usage:
+//
+//	b, _ := basicauth.NewBasicAuth(opts)
+//	http.ListenAndServe(":8080", b.Wrap(mux))
+func (b *BasicAuth) Wrap(next http.Handler) http.Handler {
 	handler := func(w http.ResponseWriter, r *http.Request) {
-		if b.opts.HTTPSOnly && !isHTTPS(r) {
-			b.handleError(w, r, ErrHTTPVersion{})
+		b.closeMu.RLock()
+		if !b.closed {
+			b.inflight.Add(1)
+			defer b.inflight.Done()
+		}
+		b.closeMu.RUnlock()
+
+		if !b.opts.DisableVaryHeader {
+			// Prevent shared caches from serving one user's response to another.
+			w.Header().Add(varyHeaderKey, b.authorizationHeader)
+			if b.opts.CredentialsCookie != "" {
+				w.Header().Add(varyHeaderKey, "Cookie")
+			}
+		}
+
+		if b.opts.SetUserHeader != "" {
+			r.Header.Del(b.opts.SetUserHeader) // never trust the client.
+		}
+
+		if b.opts.PreAuth != nil {
+			if err := b.opts.PreAuth(r); err != nil {
+				b.handleError(w, r, ErrPreAuth{Err: err, Code: b.opts.PreAuthCode})
+				return
+			}
+		}
+
+		if b.disabled.Load() {
+			if b.opts.BlockWhenDisabled {
+				b.handleError(w, r, ErrDisabled{})
+				return
+			}
+
+			r = r.WithContext(newAnonymousContext(r.Context()))
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(b.allowedHosts) > 0 && !b.isAllowedHost(r.Host) {
+			b.handleError(w, r, ErrHostNotAllowed{Host: r.Host})
+			return
+		}
+
+		if len(b.allowedOrigins) > 0 && isStateChanging(r.Method) {
+			if origin := r.Header.Get(originHeaderKey); origin != "" && !b.isAllowedOrigin(origin) {
+				b.handleError(w, r, ErrOriginNotAllowed{Origin: origin, Code: b.opts.OriginRejectCode})
+				return
+			}
+		}
+
+		if b.opts.HTTPSOnly && !b.isSecure(r) {
+			b.handleError(w, r, ErrHTTPVersion{Code: b.opts.HTTPSOnlyCode})
 			return
 		}
 
-		header := r.Header.Get(b.authorizationHeader)
-		fullUser, username, password, ok := decodeHeader(header)
+		if b.circuit != nil {
+			if retryAfter := b.circuit.openFor(time.Now()); retryAfter > 0 {
+				if b.opts.FailureCircuit.FailOpen {
+					r = r.WithContext(newAnonymousContext(r.Context()))
+					next.ServeHTTP(w, r)
+					return
+				}
+
+				b.handleError(w, r, ErrCircuitOpen{RetryAfter: retryAfter})
+				return
+			}
+		}
+
+		if b.opts.AllowCertificate != nil {
+			if cert := verifiedCertificate(r); cert != nil {
+				if user, ok := b.opts.AllowCertificate(r, cert); ok {
+					if user == nil {
+						user = &SimpleUser{Username: cert.Subject.CommonName}
+					}
+
+					b.emit(r, EventSuccess, cert.Subject.CommonName, nil)
+					b.setUserHeader(w, r, cert.Subject.CommonName)
+					b.setNoStore(w)
+					b.advertiseChallenge(w, r)
+
+					// No stored credentials to logout.
+					r = r.WithContext(b.newUserContext(r.Context(), user, nil))
+					b.onSuccess(r, user)
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+		}
+
+		if b.opts.TokenAllow != nil && b.opts.Extractor == nil {
+			if values := r.Header.Values(b.authorizationHeader); len(values) == 1 {
+				if token, ok := decodeBearer(values[0]); ok {
+					b.serveToken(w, r, next, token)
+					return
+				}
+			}
+		}
+
+		var (
+			header             string
+			username, password string
+			ok                 bool
+		)
+
+		if b.opts.Extractor != nil {
+			username, password, ok = b.opts.Extractor(r)
+		} else if values := r.Header.Values(b.authorizationHeader); len(values) > 1 {
+			// More than one authorization headers are ambiguous
+			// (e.g. request smuggling through a proxy which reads the last one),
+			// reject them as malformed.
+			header = strings.Join(values, ", ")
+		} else {
+			header = b.getAuthorizationHeader(r)
+			username, password, ok = decodeHeader(header, b.opts.CredentialSeparator)
+			if ok && b.opts.Charset != "" {
+				ok = utf8.ValidString(username) && utf8.ValidString(password)
+			}
+		}
+
+		if ok {
+			username, password = b.normalizeCredentials(username, password)
+		}
+
 		if !ok { // Header is malformed or missing (e.g. browser cancel button on user prompt).
+			if header == "" && b.opts.Optional {
+				b.advertiseChallenge(w, r)
+				r = r.WithContext(newAnonymousContext(r.Context()))
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			challenge := b.challenge(r)
 			b.handleError(w, r, ErrCredentialsMissing{
-				Header:                  header,
-				AuthenticateHeader:      b.authenticateHeader,
-				AuthenticateHeaderValue: b.authenticateHeaderValue,
-				Code:                    b.askCode,
+				Header:                   header,
+				AuthenticateHeader:       b.authenticateHeader,
+				AuthenticateHeaderValue:  challenge[0],
+				AuthenticateHeaderValues: challenge,
+				Code:                     b.askCode,
 			})
 			return
 		}
 
 		var (
-			maxTries = b.opts.MaxTries
-			tries    int
+			maxTries    = b.maxTries(username)
+			tries       int
+			lockedUntil time.Time
 		)
 
 		if maxTries > 0 {
-			tries = b.getCurrentTries(r)
+			tries, lockedUntil = b.getTries(r, username)
+			if b.attempts != nil && tries >= maxTries {
+				// The server-side counter can not be reset by the client,
+				// reject even valid credentials until it expires.
+				b.handleError(w, r, ErrCredentialsForbidden{
+					Username: username,
+					Password: password,
+					Tries:    tries,
+					Age:      b.opts.MaxAge,
+				})
+				return
+			}
+
+			if retryAfter := time.Until(lockedUntil); retryAfter > 0 {
+				b.handleError(w, r, ErrCredentialsLocked{
+					Username:   username,
+					Tries:      tries,
+					RetryAfter: retryAfter,
+				})
+				return
+			}
+		}
+
+		fullUser := fullUserKey(username, password)
+		user, ok := b.cachedUser(fullUser)
+		temporary := false
+		if !ok {
+			if b.limiter != nil {
+				if retryAfter := b.limiter.take(b.rateLimitKey(r, username), time.Now()); retryAfter > 0 {
+					b.handleError(w, r, ErrTooManyRequests{Username: username, RetryAfter: retryAfter})
+					return
+				}
+			}
+
+			user, ok, temporary = b.allow(r, username, password)
 		}
 
-		user, ok := b.opts.Allow(r, username, password)
 		if !ok { // This username:password combination was not allowed.
+			if b.takeCredential(fullUser) {
+				// It was allowed before, the password has been rotated.
+				b.handleRotated(w, r, username, password)
+				return
+			}
+
+			reason, _ := user.(error)
+			if b.circuit != nil {
+				b.circuit.fail(time.Now())
+			}
+
+			if b.backoff != nil && !b.backoff.wait(r.Context(), b.clientIP(r)) {
+				return // The client has gone away.
+			}
+
+			if e, ok := reason.(ErrPasswordMismatch); ok {
+				if u, ok := e.User.(MaxTriesUser); ok { // per-user override.
+					n := u.GetMaxTries()
+					b.setMaxTries(username, n)
+					if maxTries <= 0 && n > 0 { // not loaded above.
+						tries, _ = b.getTries(r, username)
+					}
+					maxTries = n
+				}
+			}
+
 			if maxTries > 0 {
-				tries++
-				b.setCurrentTries(w, tries)
+				tries = b.addTry(w, r, username, tries, maxTries)
 				if tries >= maxTries { // e.g. if MaxTries == 1 then it should be allowed only once, so we must send forbidden now.
 					b.handleError(w, r, ErrCredentialsForbidden{
 						Username: username,
 						Password: password,
 						Tries:    tries,
 						Age:      b.opts.MaxAge,
+						Reason:   reason,
 					})
 					return
 				}
 			}
 
+			if b.opts.TriesRemainingHeader != "" && maxTries > 0 {
+				w.Header().Set(b.opts.TriesRemainingHeader, strconv.Itoa(maxTries-tries))
+			}
+
+			challenge := b.challenge(r)
+			if b.opts.RealmByTries != nil && maxTries > 0 && challenge[0] != "" {
+				challenge = []string{challengeValue(b.opts.RealmByTries(tries, maxTries), b.opts.Charset)}
+			}
 			b.handleError(w, r, ErrCredentialsInvalid{
-				Username:                username,
-				Password:                password,
-				CurrentTries:            tries,
-				AuthenticateHeader:      b.authenticateHeader,
-				AuthenticateHeaderValue: b.authenticateHeaderValue,
-				Code:                    b.askCode,
+				Username:                 username,
+				Password:                 password,
+				CurrentTries:             tries,
+				Reason:                   reason,
+				AuthenticateHeader:       b.authenticateHeader,
+				AuthenticateHeaderValue:  challenge[0],
+				AuthenticateHeaderValues: challenge,
+				Code:                     b.askCode,
 			})
 			return
 		}
 
 		if tries > 0 {
 			// had failures but it's ok, reset the tries on success.
-			b.resetCurrentTries(w)
+			b.resetTries(w, r, username)
+		}
+
+		if b.backoff != nil {
+			b.backoff.reset(b.clientIP(r))
+		}
+
+		if canonical := canonicalUsername(user); canonical != "" && canonical != username {
+			// Logged in through an alias, store the credential under the primary username.
+			username = canonical
+			fullUser = fullUserKey(username, password)
+		}
+
+		if user == nil {
+			// No custom uset was set by the auth func,
+			// it is passed though, set a simple user here:
+			user = &SimpleUser{
+				Username: username,
+				Password: password,
+			}
 		}
 
 		b.mu.RLock()
-		expiresAt, ok := b.credentials[fullUser]
+		c, ok := b.credentials[fullUser]
+		rotated := ok && c.rotated
 		b.mu.RUnlock()
+		if rotated { // See Invalidate.
+			b.takeCredential(fullUser)
+			b.handleRotated(w, r, username, password)
+			return
+		}
+
+		c, ok = b.loadCredential(r, fullUser, username, c, ok)
 		if ok {
-			if expiresAt != nil { // Has expiration.
-				if expiresAt.Before(time.Now()) { // Has been expired.
-					b.mu.Lock() // Delete the entry.
-					delete(b.credentials, fullUser)
-					b.mu.Unlock()
-
-					// Re-ask for new credentials.
-					b.handleError(w, r, ErrCredentialsExpired{
-						Username:                username,
-						Password:                password,
-						AuthenticateHeader:      b.authenticateHeader,
-						AuthenticateHeaderValue: b.authenticateHeaderValue,
-						Code:                    b.askCode,
-					})
-					return
-				}
+			if b.isExpired(r, user, c) { // Has been expired.
+				b.mu.Lock() // Delete the entry.
+				b.removeCredentialLocked(fullUser)
+				b.mu.Unlock()
+				b.deleteCredential(fullUser)
 
+				// Re-ask for new credentials.
+				challenge := b.challenge(r)
+				b.handleError(w, r, ErrCredentialsExpired{
+					Username:                 username,
+					Password:                 password,
+					AuthenticateHeader:       b.authenticateHeader,
+					AuthenticateHeaderValue:  challenge[0],
+					AuthenticateHeaderValues: challenge,
+					Code:                     b.askCode,
+				})
+				return
 			}
+
+			b.checkClientIP(r, c)
+			b.touchCredential(c)
 		} else {
 			// Saved credential not found, first login.
-			if b.opts.MaxAge > 0 { // Expiration is enabled, set the value.
-				t := time.Now().Add(b.opts.MaxAge)
-				expiresAt = &t
+			c = b.newCredential(r, username)
+			if maxAge := b.maxAge(user); maxAge > 0 { // Expiration is enabled, set the value.
+				t := c.meta.FirstSeen.Add(maxAge)
+				c.expiresAt = &t
+			}
+			// A temporary credential is never cached, its uses and ttl are checked on each request.
+			c.temporary = temporary
+			if b.opts.CacheAllow && !temporary {
+				c.user = user
+			}
+			if !b.storeCredential(w, r, fullUser, username, c) {
+				return
 			}
+
 			b.mu.Lock()
-			b.credentials[fullUser] = expiresAt
+			_, exists := b.credentials[fullUser]
+			evicted, allowed := b.limitSessionsLocked(fullUser, username)
+			stored := false
+			if allowed {
+				var key string
+				if key, stored = b.putCredentialLocked(fullUser, c); key != "" {
+					evicted = append(evicted, key)
+				}
+			}
 			b.mu.Unlock()
-		}
 
-		if user == nil {
-			// No custom uset was set by the auth func,
-			// it is passed though, set a simple user here:
-			user = &SimpleUser{
-				Username: username,
-				Password: password,
+			for _, key := range evicted {
+				b.deleteCredential(key)
+			}
+
+			if !stored && !exists { // Roll back the store write.
+				b.deleteCredential(fullUser)
+			}
+
+			if !allowed {
+				b.handleError(w, r, ErrSessionLimit{Username: username, Max: b.opts.MaxSessionsPerUser})
+				return
+			}
+
+			if !stored { // Still authenticated, through the Options.Allow each time.
+				b.logNotStored(r, username)
 			}
 		}
 
@@ -475,40 +1646,288 @@ func (b *BasicAuth) serveHTTP(next http.Handler) http.Handler {
 		// Note that the end-developer has always have access
 		// to the Request.BasicAuth, however, we support any user struct,
 		// so we must store it on this request instance so it can be retrieved later on.
-		r = r.WithContext(newContext(r.Context(), user, b.logout))
+		if b.opts.LogSuccess && b.opts.ErrorLogger != nil {
+			if id := b.correlationID(r); id != "" {
+				b.opts.ErrorLogger.Printf("[%s] credentials: allowed <%s> from <%s>", id, username, b.clientIP(r))
+			} else {
+				b.opts.ErrorLogger.Printf("credentials: allowed <%s> from <%s>", username, b.clientIP(r))
+			}
+		}
+
+		logoutFn := func(r *http.Request) *http.Request {
+			return b.logout(w, r)
+		}
+
+		b.emit(r, EventSuccess, username, nil)
+		b.setUserHeader(w, r, username)
+		b.setNoStore(w)
+		b.echoWebSocketProtocol(w, r)
+		b.advertiseChallenge(w, r)
+
+		ctx := newCredentialsContext(r.Context(), username, password)
+		r = r.WithContext(b.newUserContext(ctx, user, logoutFn))
+		b.onSuccess(r, user)
 		next.ServeHTTP(w, r)
 	}
 
 	return http.HandlerFunc(handler)
 }
 
+// onSuccess calls the Options.OnSuccess, if any.
+func (b *BasicAuth) onSuccess(r *http.Request, user interface{}) {
+	if b.opts.OnSuccess != nil {
+		b.opts.OnSuccess(r, user)
+	}
+}
+
+// maxAge returns the expiration duration of a new credential of the given user,
+// see the ExpiringUser interface.
+func (b *BasicAuth) maxAge(user interface{}) time.Duration {
+	if u, ok := user.(ExpiringUser); ok {
+		if maxAge := u.ExpiresIn(); maxAge > 0 {
+			if maxAge > b.opts.MaxAgeLimit {
+				maxAge = b.opts.MaxAgeLimit
+			}
+
+			return maxAge
+		}
+	}
+
+	return b.opts.MaxAge
+}
+
+// handleRotated fires the ErrCredentialsRotated error.
+func (b *BasicAuth) handleRotated(w http.ResponseWriter, r *http.Request, username, password string) {
+	challenge := b.challenge(r)
+	b.handleError(w, r, ErrCredentialsRotated{
+		Username:                 username,
+		Password:                 password,
+		AuthenticateHeader:       b.authenticateHeader,
+		AuthenticateHeaderValue:  challenge[0],
+		AuthenticateHeaderValues: challenge,
+		Code:                     b.askCode,
+	})
+}
+
+// setUserHeader sets the Options.SetUserHeader on the response and the request.
+func (b *BasicAuth) setUserHeader(w http.ResponseWriter, r *http.Request, username string) {
+	if b.opts.SetUserHeader == "" {
+		return
+	}
+
+	w.Header().Set(b.opts.SetUserHeader, username)
+	r.Header.Set(b.opts.SetUserHeader, username)
+}
+
+// setNoStore disables the caching of the authenticated response, see Options.NoStore.
+func (b *BasicAuth) setNoStore(w http.ResponseWriter) {
+	if b.opts.NoStore {
+		w.Header().Set(cacheControlHeaderKey, "private, no-store")
+	}
+}
+
+// advertiseChallenge sets the challenge header on a non-401 response,
+// see Options.AlwaysAdvertiseChallenge.
+func (b *BasicAuth) advertiseChallenge(w http.ResponseWriter, r *http.Request) {
+	if !b.opts.AlwaysAdvertiseChallenge {
+		return
+	}
+
+	for _, value := range b.challenge(r) {
+		if value != "" {
+			w.Header().Add(b.authenticateHeader, value)
+		}
+	}
+}
+
+// challenge returns the authenticate header values of the given request,
+// a single empty value when the Options.SuppressAuthenticateHeader
+// or the Options.ChallengeFor suppresses the challenge.
+func (b *BasicAuth) challenge(r *http.Request) []string {
+	if b.opts.SuppressAuthenticateHeader && isAJAX(r) {
+		return []string{""}
+	}
+
+	if b.opts.ChallengeFor != nil && !b.opts.ChallengeFor(r) {
+		return []string{""}
+	}
+
+	if b.opts.RealmFunc != nil {
+		if realm := b.opts.RealmFunc(r); realm != "" {
+			return []string{challengeValue(realm, b.opts.Charset)}
+		}
+	}
+
+	return b.authenticateHeaderValues
+}
+
+// challengeValue returns the authenticate header value of the given realm and charset.
+func challengeValue(realm, charset string) string {
+	var params []string
+	if realm != "" {
+		params = append(params, "realm="+strconv.Quote(realm))
+	}
+	if charset != "" {
+		params = append(params, "charset="+strconv.Quote(charset))
+	}
+
+	if len(params) == 0 {
+		return basicLiteral
+	}
+
+	return basicLiteral + " " + strings.Join(params, ", ")
+}
+
+// isAJAX reports whether the request is an XHR or a fetch call of a browser,
+// see Options.SuppressAuthenticateHeader.
+func isAJAX(r *http.Request) bool {
+	return r.Header.Get("X-Requested-With") == "XMLHttpRequest" || r.Header.Get("Sec-Fetch-Dest") == "empty"
+}
+
+// newUserContext returns a new Context with the basicauth values
+// and the user stored under the instance's and the Options.UserContextKey keys too.
+func (b *BasicAuth) newUserContext(ctx context.Context, user interface{}, logoutFn logoutFunc) context.Context {
+	ctx = newContext(ctx, user, logoutFn)
+	ctx = context.WithValue(ctx, b.userContextKey, user)
+	if b.opts.UserContextKey != nil {
+		ctx = context.WithValue(ctx, b.opts.UserContextKey, user)
+	}
+
+	return ctx
+}
+
+// serveToken authenticates the request through the Options.TokenAllow,
+// it does not store any credential, like the certificate authentication.
+func (b *BasicAuth) serveToken(w http.ResponseWriter, r *http.Request, next http.Handler, token string) {
+	user, ok := b.opts.TokenAllow(r, token)
+	if !ok {
+		reason, _ := user.(error)
+		if b.circuit != nil {
+			b.circuit.fail(time.Now())
+		}
+
+		if b.backoff != nil && !b.backoff.wait(r.Context(), b.clientIP(r)) {
+			return // The client has gone away.
+		}
+
+		challenge := b.challenge(r)
+		b.handleError(w, r, ErrCredentialsInvalid{
+			Reason:                   reason,
+			AuthenticateHeader:       b.authenticateHeader,
+			AuthenticateHeaderValue:  challenge[0],
+			AuthenticateHeaderValues: challenge,
+			Code:                     b.askCode,
+		})
+		return
+	}
+
+	if b.backoff != nil {
+		b.backoff.reset(b.clientIP(r))
+	}
+
+	if user == nil {
+		user = &SimpleUser{}
+	}
+
+	var username string
+	if u, ok := user.(User); ok {
+		username = u.GetUsername()
+	}
+
+	b.emit(r, EventSuccess, username, nil)
+	b.setUserHeader(w, r, username)
+	b.setNoStore(w)
+	b.advertiseChallenge(w, r)
+
+	// No stored credentials to logout.
+	r = r.WithContext(b.newUserContext(r.Context(), user, nil))
+	b.onSuccess(r, user)
+	next.ServeHTTP(w, r)
+}
+
+// getAuthorizationHeader returns the authorization header value,
+// if it's missing and Options.CredentialsCookie is set then
+// the header value is built from the cookie's base64 credentials.
+func (b *BasicAuth) getAuthorizationHeader(r *http.Request) string {
+	header := r.Header.Get(b.authorizationHeader)
+	if header == "" && b.opts.CredentialsCookie != "" {
+		if cookie, err := r.Cookie(b.opts.CredentialsCookie); err == nil && cookie.Value != "" {
+			header = basicSpaceLiteral + cookie.Value
+		}
+	}
+
+	if header == "" && b.opts.WebSocketProtocol != "" {
+		header = b.webSocketProtocolHeader(r)
+	}
+
+	return header
+}
+
+// removeCredentialsCookie removes the Options.CredentialsCookie
+// from the client and the current request.
+func (b *BasicAuth) removeCredentialsCookie(w http.ResponseWriter, r *http.Request) {
+	c := &http.Cookie{
+		Name:     b.opts.CredentialsCookie,
+		Path:     "/",
+		HttpOnly: true,
+		Expires:  cookieExpireDelete,
+		MaxAge:   -1,
+	}
+	http.SetCookie(w, c)
+
+	cookies := r.Cookies()
+	r.Header.Del("Cookie")
+	for _, cookie := range cookies {
+		if cookie.Name != b.opts.CredentialsCookie {
+			r.AddCookie(cookie)
+		}
+	}
+}
+
 // logout clears the current user's credentials.
-func (b *BasicAuth) logout(r *http.Request) *http.Request {
+func (b *BasicAuth) logout(w http.ResponseWriter, r *http.Request) *http.Request {
 	var (
-		fullUser, username, password string
-		ok                           bool
+		username, password string
+		ok                 bool
 	)
 
 	if v := GetUser(r); v != nil { // Get the saved ones, if any.
-		if u, isUser := v.(User); isUser {
-			username = u.GetUsername()
-			password = u.GetPassword()
-			fullUser = username + colonLiteral + password
-			ok = username != "" && password != ""
+		// The credentials which the middleware authenticated, the stored key is built from them.
+		// Note that a User's GetPassword may return the stored (e.g. hashed) password.
+		username, password, ok = getContextCredentials(r.Context())
+		if !ok {
+			if u, isUser := v.(User); isUser {
+				username = u.GetUsername()
+				password = u.GetPassword()
+				ok = username != "" && password != ""
+			}
 		}
 
 		if b.opts.OnLogoutClearContext {
 			// *r = *(r.WithContext(clearContext(r.Context())))
 			// Let's make it clear that we modify the request here by returning it instead of ^
-			r = r.WithContext(clearContext(r.Context()))
+			ctx := context.WithValue(clearContext(r.Context()), b.userContextKey, nil)
+			if b.opts.UserContextKey != nil {
+				ctx = context.WithValue(ctx, b.opts.UserContextKey, nil)
+			}
+			r = r.WithContext(ctx)
 		}
 	}
 
 	if !ok {
-		// If the custom user does
-		// not implement the User interface, then extract from the request header (most common scenario):
-		header := r.Header.Get(b.authorizationHeader)
-		fullUser, username, password, ok = decodeHeader(header)
+		// If the custom user does not implement the User interface,
+		// then extract them the same way the middleware did:
+		// through the custom Extractor, if any, or from the request header (most common scenario).
+		if b.opts.Extractor != nil {
+			username, password, ok = b.opts.Extractor(r)
+		} else {
+			header := b.getAuthorizationHeader(r)
+			username, password, ok = decodeHeader(header, b.opts.CredentialSeparator)
+		}
+	}
+
+	if ok {
+		username, password = b.normalizeCredentials(username, password)
 	}
 
 	if ok { // If it's authorized then try to lock and delete.
@@ -518,23 +1937,114 @@ func (b *BasicAuth) logout(r *http.Request) *http.Request {
 		// delete the request header so future Request().BasicAuth are empty.
 		r.Header.Del(authorizationHeaderKey)
 
+		if b.opts.CredentialsCookie != "" {
+			b.removeCredentialsCookie(w, r)
+		}
+
+		fullUser := fullUserKey(username, password)
 		b.mu.Lock()
-		delete(b.credentials, fullUser)
+		b.removeCredentialLocked(fullUser)
 		b.mu.Unlock()
+		b.deleteCredential(fullUser)
+
+		b.emit(r, EventLogout, username, nil)
 	}
 
 	return r
 }
 
+// Disable temporarily disables the authentication, e.g. for incident response or maintenance,
+// without reconfiguring the application. While disabled, all requests are passed through
+// anonymously (see IsAnonymous) or they are all rejected if the Options.BlockWhenDisabled is true.
+// It is safe for concurrent use.
+func (b *BasicAuth) Disable() {
+	b.disabled.Store(true)
+}
+
+// Enable enables the authentication again, see Disable.
+// The authentication is enabled by default.
+func (b *BasicAuth) Enable() {
+	b.disabled.Store(false)
+}
+
+// Close stops the GC goroutine, if any, and waits for it to exit (see Options.OnGCStop).
+// If "drain" is true then it blocks until all in-flight requests,
+// which entered the middleware before Close, are finished.
+// Useful on graceful shutdown when the authentication layer
+// is torn down before the HTTP server.
+// Requests served after Close are still authenticated but they are not tracked.
+// It is safe to call it multiple times, and concurrently.
+func (b *BasicAuth) Close(drain bool) {
+	b.closeMu.Lock()
+	b.closed = true
+	b.closeMu.Unlock()
+
+	if b.stopGC != nil {
+		b.stopGC()
+		<-b.gcDone
+	}
+
+	if drain {
+		b.inflight.Wait()
+	}
+}
+
+// Stop stops the GC goroutine, if any, and waits for it to exit,
+// it is the same as Close(false). Without a GC.Context the GC goroutine
+// lives as long as the process, so tests and graceful shutdowns should call it.
+// It is safe to call it multiple times, and concurrently.
+//
+// Usage:
+//
+//	b, auth := basicauth.NewBasicAuth(basicauth.Options{..., GC: basicauth.GC{Every: time.Hour}})
+//	defer b.Stop()
+func (b *BasicAuth) Stop() {
+	b.Close(false)
+}
+
+// runningGC is the number of the running GC goroutines, see RunningGC.
+var runningGC atomic.Int64
+
+// RunningGC returns the number of the running GC goroutines of all BasicAuth instances,
+// a metric to verify that they are stopped, e.g. on Close.
+func RunningGC() int64 {
+	return runningGC.Load()
+}
+
+// startGC records the start of the GC goroutine.
+func (b *BasicAuth) startGC() {
+	runningGC.Add(1)
+
+	if b.opts.ErrorLogger != nil {
+		b.opts.ErrorLogger.Printf("BasicAuth: GC: started, every %s", b.opts.GC.Every)
+	}
+
+	if b.opts.OnGCStart != nil {
+		b.opts.OnGCStart(b.opts.GC.Every)
+	}
+}
+
+// stoppedGC records the stop of the GC goroutine.
+func (b *BasicAuth) stoppedGC() {
+	runningGC.Add(-1)
+
+	if b.opts.ErrorLogger != nil {
+		b.opts.ErrorLogger.Println("BasicAuth: GC: stopped")
+	}
+
+	if b.opts.OnGCStop != nil {
+		b.opts.OnGCStop()
+	}
+
+	close(b.gcDone)
+}
+
 // runGC runs a function in a separate go routine
 // every x duration to clear in-memory expired credential entries.
 func (b *BasicAuth) runGC(ctx context.Context, every time.Duration) {
-	if ctx == nil {
-		ctx = context.Background()
-	}
-
 	t := time.NewTicker(every)
 	defer t.Stop()
+	defer b.stoppedGC()
 
 	for {
 		select {
@@ -546,7 +2056,8 @@ func (b *BasicAuth) runGC(ctx context.Context, every time.Duration) {
 	}
 }
 
-// gc removes all entries expired based on the max age or all entries (if max age is missing),
+// gc removes all entries expired based on the max age
+// or all entries (if max age is missing and GC.RemoveAllWhenNoMaxAge is true),
 // note that this does not mean that the server will send 401/407 to the next request,
 // when the request header credentials are still valid (Allow passed).
 func (b *BasicAuth) gc() int {
@@ -554,8 +2065,15 @@ func (b *BasicAuth) gc() int {
 	var markedForDeletion []string
 
 	b.mu.RLock()
-	for fullUser, expiresAt := range b.credentials {
-		if expiresAt == nil || expiresAt.Before(now) {
+	for fullUser, c := range b.credentials {
+		if c.expiresAt == nil {
+			if b.opts.GC.RemoveAllWhenNoMaxAge {
+				markedForDeletion = append(markedForDeletion, fullUser)
+			}
+			continue
+		}
+
+		if c.expiresAt.Before(now) {
 			markedForDeletion = append(markedForDeletion, fullUser)
 		}
 	}
@@ -565,10 +2083,25 @@ func (b *BasicAuth) gc() int {
 	if n > 0 {
 		for _, fullUser := range markedForDeletion {
 			b.mu.Lock()
-			delete(b.credentials, fullUser)
+			b.removeCredentialLocked(fullUser)
 			b.mu.Unlock()
 		}
 	}
 
+	if b.opts.Store != nil {
+		b.opts.Store.GC(now)
+	}
+
+	if b.localAttempts != nil {
+		b.localAttempts.GC(now)
+	}
+
+	b.gcStatsMu.Lock()
+	b.gcStats.Runs++
+	b.gcStats.LastRun = now
+	b.gcStats.LastRemoved = n
+	b.gcStats.TotalRemoved += int64(n)
+	b.gcStatsMu.Unlock()
+
 	return n
 }
@@ -1,9 +1,26 @@
 package basicauth
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestNew(t *testing.T) {
@@ -79,3 +96,1333 @@ func TestNew(t *testing.T) {
 		}
 	}
 }
+
+func TestMaxTriesCookiePerRealm(t *testing.T) {
+	newAuth := func(realm string) Middleware {
+		return New(Options{
+			Realm:                  realm,
+			Allow:                  AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+			MaxTries:               2,
+			MaxTriesCookiePerRealm: true,
+		})
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	adminAuth, apiAuth := newAuth("admin"), newAuth("api")
+	adminCookie := DefaultMaxTriesCookie + "_" + realmHash("admin")
+	apiCookie := DefaultMaxTriesCookie + "_" + realmHash("api")
+
+	if adminCookie == apiCookie {
+		t.Fatalf("expected different cookie names per realm but got: %q", adminCookie)
+	}
+
+	first := testHandler(t, adminAuth(handler), http.MethodGet, "/",
+		withBasicAuth("kataras", "invalid_pass")).statusCode(http.StatusUnauthorized).cookie(adminCookie)
+
+	// The admin failure counter should not be visible to the api realm.
+	apiFirst := testHandler(t, apiAuth(handler), http.MethodGet, "/",
+		withCookie(first), withBasicAuth("kataras", "invalid_pass")).statusCode(http.StatusUnauthorized).cookie(apiCookie)
+	if expected, got := "1", apiFirst.Value; expected != got {
+		t.Fatalf("expected api tries cookie value to be: %q but got: %q", expected, got)
+	}
+
+	testHandler(t, adminAuth(handler), http.MethodGet, "/",
+		withCookie(first), withCookie(apiFirst), withBasicAuth("kataras", "invalid_pass")).statusCode(http.StatusForbidden)
+}
+
+func TestNewEReady(t *testing.T) {
+	allow := AllowUsers(map[string]string{"kataras": "kataras_pass"})
+
+	errUnreachable := errors.New("database is unreachable")
+	_, err := NewE(Options{
+		Allow: allow,
+		Ready: func(ctx context.Context) error { return errUnreachable },
+	})
+	if !errors.Is(err, errUnreachable) {
+		t.Fatalf("expected error: %v but got: %v", errUnreachable, err)
+	}
+
+	var called bool
+	auth, err := NewE(Options{
+		Allow: allow,
+		Ready: func(ctx context.Context) error {
+			called = true
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !called {
+		t.Fatalf("expected Ready to be called")
+	}
+
+	testHandler(t, auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})), http.MethodGet, "/",
+		withBasicAuth("kataras", "kataras_pass")).statusCode(http.StatusOK)
+
+	if _, err = NewE(Options{}); err == nil {
+		t.Fatalf("expected an error on missing Allow field")
+	}
+}
+
+func TestRealms(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	var tests = []struct {
+		opts     Options
+		expected []string
+	}{
+		{Options{Realm: DefaultRealm}, []string{`Basic realm="Authorization Required"`}},
+		{Options{}, []string{"Basic"}},
+		{Options{Realm: DefaultRealm, Realms: []string{"internal", "partners"}},
+			[]string{`Basic realm="internal"`, `Basic realm="partners"`}},
+	}
+
+	for i, tt := range tests {
+		tt.opts.Allow = AllowUsers(map[string]string{"kataras": "kataras_pass"})
+		te := testHandler(t, New(tt.opts)(handler), http.MethodGet, "/",
+			withRequestID(i)).statusCode(http.StatusUnauthorized)
+
+		if got := te.resp.Header.Values("WWW-Authenticate"); !reflect.DeepEqual(tt.expected, got) {
+			te.fatalf("expected challenges: %q but got: %q", tt.expected, got)
+		}
+	}
+}
+
+func TestLogSuccess(t *testing.T) {
+	buf := new(bytes.Buffer)
+	auth := New(Options{
+		Allow:       AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		ErrorLogger: log.New(buf, "", 0),
+		LogSuccess:  true,
+	})
+
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).statusCode(http.StatusOK)
+
+	expected := "credentials: allowed <kataras> from <192.0.2.1>\n"
+	if got := buf.String(); expected != got {
+		t.Fatalf("expected log: %q but got: %q", expected, got)
+	}
+
+	if strings.Contains(buf.String(), "kataras_pass") {
+		t.Fatalf("password should never be logged")
+	}
+
+	// The resolved client IP, see Options.ClientIP.
+	buf.Reset()
+	auth = New(Options{
+		Allow:       AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		ErrorLogger: log.New(buf, "", 0),
+		LogSuccess:  true,
+		ClientIP:    ClientIPFromHeaders("X-Forwarded-For"),
+	})
+
+	handler = auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass"), withHeader("X-Forwarded-For", "203.0.113.7")).
+		statusCode(http.StatusOK)
+
+	expected = "credentials: allowed <kataras> from <203.0.113.7>\n"
+	if got := buf.String(); expected != got {
+		t.Fatalf("expected log: %q but got: %q", expected, got)
+	}
+}
+
+func TestCredentialsCookie(t *testing.T) {
+	auth := New(Options{
+		Allow:             AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		CredentialsCookie: "auth",
+	})
+
+	credentials := &http.Cookie{Name: "auth", Value: base64.StdEncoding.EncodeToString([]byte("kataras:kataras_pass"))}
+	index := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(GetUser(r).(*SimpleUser).Username))
+	}))
+	logout := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = Logout(r)
+		if _, err := r.Cookie("auth"); err == nil {
+			t.Fatalf("expected credentials cookie to be removed from the request")
+		}
+		if _, err := r.Cookie("other"); err != nil {
+			t.Fatalf("expected other cookies to be kept")
+		}
+	}))
+
+	testHandler(t, index, http.MethodGet, "/", withCookie(credentials)).
+		statusCode(http.StatusOK).bodyEq("kataras")
+	testHandler(t, index, http.MethodGet, "/").
+		statusCode(http.StatusUnauthorized)
+	testHandler(t, index, http.MethodGet, "/",
+		withCookie(&http.Cookie{Name: "auth", Value: base64.StdEncoding.EncodeToString([]byte("kataras:invalid_pass"))})).
+		statusCode(http.StatusUnauthorized)
+
+	removed := testHandler(t, logout, http.MethodGet, "/logout",
+		withCookie(credentials), withCookie(&http.Cookie{Name: "other", Value: "value"})).statusCode(http.StatusOK).cookie("auth")
+	if removed.MaxAge >= 0 {
+		t.Fatalf("expected credentials cookie to be removed from the client but got max age: %d", removed.MaxAge)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	b, auth := NewBasicAuth(Options{
+		Allow: AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+	})
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(GetUser(r).(*SimpleUser).Username))
+	})
+
+	for _, h := range []http.Handler{b.Wrap(handler), auth(handler)} {
+		testHandler(t, h, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).
+			statusCode(http.StatusOK).bodyEq("kataras")
+		testHandler(t, h, http.MethodGet, "/", withBasicAuth("kataras", "invalid_pass")).
+			statusCode(http.StatusUnauthorized)
+	}
+}
+
+func TestVaryHeader(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	allow := AllowUsers(map[string]string{"kataras": "kataras_pass"})
+
+	auth := New(Options{Allow: allow})
+	testHandler(t, auth(handler), http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).
+		statusCode(http.StatusOK).headerEq("Vary", "Authorization")
+	testHandler(t, auth(handler), http.MethodGet, "/").
+		statusCode(http.StatusUnauthorized).headerEq("Vary", "Authorization")
+
+	auth = New(Options{Allow: allow, Proxy: true})
+	testHandler(t, auth(handler), http.MethodGet, "/").
+		statusCode(http.StatusProxyAuthRequired).headerEq("Vary", "Proxy-Authorization")
+
+	auth = New(Options{Allow: allow, DisableVaryHeader: true})
+	testHandler(t, auth(handler), http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).
+		statusCode(http.StatusOK).headerEq("Vary", "")
+}
+
+func TestSetCurrentTries(t *testing.T) {
+	b, _ := NewBasicAuth(Options{
+		Allow:    AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		MaxTries: 3,
+		MaxAge:   30 * time.Minute,
+	})
+
+	for _, tries := range []int{1, 2, 10, 123} {
+		w := httptest.NewRecorder()
+		b.setCurrentTries(w, tries)
+
+		got := w.Header().Get("Set-Cookie")
+		// parse the expiration back, so we compare with the same time.
+		c := w.Result().Cookies()[0]
+
+		expected := (&http.Cookie{
+			Name:     DefaultMaxTriesCookie,
+			Path:     "/",
+			Value:    url.QueryEscape(strconv.Itoa(tries)),
+			HttpOnly: true,
+			Expires:  c.Expires,
+			MaxAge:   int((30 * time.Minute).Seconds()),
+		}).String()
+
+		if expected != got {
+			t.Fatalf("expected cookie:\n%s\nbut got:\n%s", expected, got)
+		}
+	}
+}
+
+func TestTriesCookieAttributes(t *testing.T) {
+	b, _ := NewBasicAuth(Options{
+		Allow:          AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		MaxTries:       3,
+		CookieSecure:   true,
+		CookieSameSite: http.SameSiteStrictMode,
+		CookieDomain:   "example.com",
+	})
+
+	w := httptest.NewRecorder()
+	b.setCurrentTries(w, 1)
+
+	got := w.Header().Get("Set-Cookie")
+	c := w.Result().Cookies()[0]
+
+	expected := (&http.Cookie{
+		Name:     DefaultMaxTriesCookie,
+		Path:     "/",
+		Domain:   "example.com",
+		Value:    "1",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+		Expires:  c.Expires,
+		MaxAge:   int(DefaultCookieMaxAge.Seconds()),
+	}).String()
+
+	if expected != got {
+		t.Fatalf("expected cookie:\n%s\nbut got:\n%s", expected, got)
+	}
+
+	w = httptest.NewRecorder()
+	b.resetCurrentTries(w)
+	c = w.Result().Cookies()[0]
+	if c.Domain != "example.com" || !c.Secure || c.SameSite != http.SameSiteStrictMode || c.MaxAge != -1 {
+		t.Fatalf("expected the reset cookie to keep the attributes but got: %s", w.Header().Get("Set-Cookie"))
+	}
+}
+
+// BenchmarkSetCurrentTriesCookie is the baseline: a new http.Cookie on each failure.
+func BenchmarkSetCurrentTriesCookie(b *testing.B) {
+	w := httptest.NewRecorder()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		http.SetCookie(w, &http.Cookie{
+			Name:     DefaultMaxTriesCookie,
+			Path:     "/",
+			Value:    url.QueryEscape(strconv.Itoa(i % 5)),
+			HttpOnly: true,
+			Expires:  time.Now().Add(DefaultCookieMaxAge),
+			MaxAge:   int(DefaultCookieMaxAge.Seconds()),
+		})
+		w.Header().Del("Set-Cookie")
+	}
+}
+
+func BenchmarkSetCurrentTries(b *testing.B) {
+	auth, _ := NewBasicAuth(Options{
+		Allow:    AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		MaxTries: 5,
+	})
+
+	w := httptest.NewRecorder()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		auth.setCurrentTries(w, i%5)
+		w.Header().Del("Set-Cookie")
+	}
+}
+
+func TestAllowSelector(t *testing.T) {
+	tenants := map[string]AuthFunc{
+		"a.example.com": AllowUsers(map[string]string{"kataras": "a_pass"}),
+		"b.example.com": AllowUsers(map[string]string{"kataras": "b_pass"}),
+	}
+
+	auth := New(Options{
+		Allow: AllowUsers(map[string]string{"admin": "admin_pass"}),
+		AllowSelector: func(r *http.Request) AuthFunc {
+			return tenants[r.Host]
+		},
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	var tests = []struct {
+		url                string
+		username, password string
+		ok                 bool
+	}{
+		{"http://a.example.com/", "kataras", "a_pass", true},
+		{"http://a.example.com/", "kataras", "b_pass", false},
+		{"http://b.example.com/", "kataras", "b_pass", true},
+		{"http://b.example.com/", "kataras", "a_pass", false},
+		{"http://b.example.com/", "admin", "admin_pass", false},
+		{"http://c.example.com/", "admin", "admin_pass", true}, // fallback to Allow.
+		{"http://c.example.com/", "kataras", "a_pass", false},
+	}
+
+	for i, tt := range tests {
+		te := testHandler(t, handler, http.MethodGet, tt.url, withRequestID(i), withBasicAuth(tt.username, tt.password))
+		if tt.ok {
+			te.statusCode(http.StatusOK)
+		} else {
+			te.statusCode(http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestExtractorSimpleUser(t *testing.T) {
+	auth := New(Options{
+		// A custom extractor, no authorization header is involved.
+		Extractor: func(r *http.Request) (string, string, bool) {
+			username, password := r.Header.Get("X-Username"), r.Header.Get("X-Password")
+			return username, password, username != "" && password != ""
+		},
+		// Allow without a custom user.
+		Allow: func(r *http.Request, username, password string) (interface{}, bool) {
+			return nil, username == "kataras" && password == "kataras_pass"
+		},
+	})
+
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u := GetUser(r).(*SimpleUser)
+		w.Write([]byte(u.Username + ":" + u.Password))
+	}))
+
+	testHandler(t, handler, http.MethodGet, "/",
+		withHeader("X-Username", "kataras"), withHeader("X-Password", "kataras_pass")).
+		statusCode(http.StatusOK).bodyEq("kataras:kataras_pass")
+	testHandler(t, handler, http.MethodGet, "/",
+		withHeader("X-Username", "kataras"), withHeader("X-Password", "invalid_pass")).
+		statusCode(http.StatusUnauthorized)
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).
+		statusCode(http.StatusUnauthorized)
+}
+
+func TestExtractorLogout(t *testing.T) {
+	b, auth := NewBasicAuth(Options{
+		Extractor: func(r *http.Request) (string, string, bool) {
+			username, password := r.Header.Get("X-Username"), r.Header.Get("X-Password")
+			return username, password, username != "" && password != ""
+		},
+		// A custom user which does not implement the User interface.
+		Allow: func(r *http.Request, username, password string) (interface{}, bool) {
+			return Map{"name": username}, username == "kataras" && password == "kataras_pass"
+		},
+	})
+
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/logout" {
+			Logout(r)
+		}
+	}))
+
+	testHandler(t, handler, http.MethodGet, "/",
+		withHeader("X-Username", "kataras"), withHeader("X-Password", "kataras_pass")).
+		statusCode(http.StatusOK)
+	if expected, got := 1, b.Len(); expected != got {
+		t.Fatalf("expected %d stored credentials but got: %d", expected, got)
+	}
+
+	testHandler(t, handler, http.MethodGet, "/logout",
+		withHeader("X-Username", "kataras"), withHeader("X-Password", "kataras_pass")).
+		statusCode(http.StatusOK)
+	if expected, got := 0, b.Len(); expected != got {
+		t.Fatalf("expected %d stored credentials after logout but got: %d", expected, got)
+	}
+}
+
+func TestAllowedHosts(t *testing.T) {
+	auth := New(Options{
+		Allow:        AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		AllowedHosts: []string{"example.com", "api.example.com:8443"},
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	var tests = []struct {
+		url        string
+		statusCode int
+	}{
+		{"http://example.com/", http.StatusOK},
+		{"http://EXAMPLE.com:8080/", http.StatusOK},
+		{"https://api.example.com:8443/", http.StatusOK},
+		{"https://api.example.com/", http.StatusBadRequest},
+		{"http://evil.com/", http.StatusBadRequest},
+	}
+
+	for i, tt := range tests {
+		testHandler(t, handler, http.MethodGet, tt.url, withRequestID(i), withBasicAuth("kataras", "kataras_pass")).
+			statusCode(tt.statusCode)
+	}
+
+	// The host check runs before the authentication.
+	testHandler(t, handler, http.MethodGet, "http://evil.com/").statusCode(http.StatusBadRequest)
+}
+
+func TestPreAuth(t *testing.T) {
+	errMaintenance := errors.New("maintenance")
+
+	var reason error
+	b, auth := NewBasicAuth(Options{
+		Allow: AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		PreAuth: func(r *http.Request) error {
+			if r.Header.Get("X-Country") == "XX" {
+				return errMaintenance
+			}
+
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			reason = err
+			DefaultErrorHandler(w, r, err)
+		},
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass"), withHeader("X-Country", "GR")).
+		statusCode(http.StatusOK)
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass"), withHeader("X-Country", "XX")).
+		statusCode(http.StatusForbidden)
+	if !errors.Is(reason, errMaintenance) {
+		t.Fatalf("expected the pre-auth error but got: %v", reason)
+	}
+
+	// It runs before everything else, even when disabled.
+	b.Disable()
+	testHandler(t, handler, http.MethodGet, "/", withHeader("X-Country", "XX")).
+		statusCode(http.StatusForbidden)
+	testHandler(t, handler, http.MethodGet, "/", withHeader("X-Country", "GR")).
+		statusCode(http.StatusOK)
+
+	// Custom status code.
+	auth = New(Options{
+		Allow:       AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		PreAuth:     func(r *http.Request) error { return errMaintenance },
+		PreAuthCode: http.StatusServiceUnavailable,
+	})
+	handler = auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).
+		statusCode(http.StatusServiceUnavailable)
+}
+
+func TestNoStore(t *testing.T) {
+	auth := New(Options{
+		Allow:    AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		NoStore:  true,
+		Optional: true,
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).
+		statusCode(http.StatusOK).headerEq("Cache-Control", "private, no-store")
+	// Only the authenticated responses.
+	testHandler(t, handler, http.MethodGet, "/").
+		statusCode(http.StatusOK).headerEq("Cache-Control", "")
+
+	auth = New(Options{
+		Allow: AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+	})
+	handler = auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).
+		statusCode(http.StatusOK).headerEq("Cache-Control", "")
+}
+
+func TestAllowedOrigins(t *testing.T) {
+	auth := New(Options{
+		Allow:          AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		AllowedOrigins: []string{"https://example.com"},
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	var tests = []struct {
+		method     string
+		origin     string
+		statusCode int
+	}{
+		{http.MethodPost, "https://example.com", http.StatusOK},
+		{http.MethodPost, "HTTPS://EXAMPLE.COM", http.StatusOK},
+		{http.MethodPost, "", http.StatusOK}, // not a browser.
+		{http.MethodPost, "https://evil.com", http.StatusForbidden},
+		{http.MethodDelete, "https://evil.com", http.StatusForbidden},
+		{http.MethodGet, "https://evil.com", http.StatusOK}, // not state-changing.
+	}
+
+	for _, tt := range tests {
+		opts := []requestOption{withBasicAuth("kataras", "kataras_pass")}
+		if tt.origin != "" {
+			opts = append(opts, withHeader("Origin", tt.origin))
+		}
+
+		testHandler(t, handler, tt.method, "/", opts...).statusCode(tt.statusCode)
+	}
+
+	// Custom status code.
+	auth = New(Options{
+		Allow:            AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		AllowedOrigins:   []string{"https://example.com"},
+		OriginRejectCode: http.StatusBadRequest,
+	})
+	handler = auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	testHandler(t, handler, http.MethodPost, "/", withBasicAuth("kataras", "kataras_pass"), withHeader("Origin", "https://evil.com")).
+		statusCode(http.StatusBadRequest)
+}
+
+func TestMaxAgeLimit(t *testing.T) {
+	buf := new(bytes.Buffer)
+	b, _ := NewBasicAuth(Options{
+		Allow:       AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		MaxAge:      100 * 365 * 24 * time.Hour,
+		MaxTries:    3,
+		ErrorLogger: log.New(buf, "", 0),
+	})
+
+	if b.opts.MaxAge != DefaultMaxAgeLimit {
+		t.Fatalf("expected max age to be clamped to: %s but got: %s", DefaultMaxAgeLimit, b.opts.MaxAge)
+	}
+
+	w := httptest.NewRecorder()
+	b.setCurrentTries(w, 1)
+	if expected, got := int(DefaultMaxAgeLimit.Seconds()), w.Result().Cookies()[0].MaxAge; expected != got {
+		t.Fatalf("expected cookie max age: %d but got: %d", expected, got)
+	}
+
+	if !strings.Contains(buf.String(), "exceeds the limit") {
+		t.Fatalf("expected a logged warning but got: %q", buf.String())
+	}
+
+	b, _ = NewBasicAuth(Options{
+		Allow:       AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		MaxAge:      2 * time.Hour,
+		MaxAgeLimit: time.Hour,
+		ErrorLogger: log.New(buf, "", 0),
+	})
+	if b.opts.MaxAge != time.Hour {
+		t.Fatalf("expected max age to be clamped to the custom limit but got: %s", b.opts.MaxAge)
+	}
+}
+
+func TestCorrelationHeader(t *testing.T) {
+	buf := new(bytes.Buffer)
+	b, auth := NewBasicAuth(Options{
+		Allow:             AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		ErrorLogger:       log.New(buf, "", 0),
+		CorrelationHeader: "X-Request-Id",
+	})
+
+	events := b.Events()
+
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "invalid_pass"),
+		withHeader("X-Request-Id", "req-42")).statusCode(http.StatusUnauthorized)
+
+	if got := buf.String(); !strings.HasPrefix(got, "[req-42] ") {
+		t.Fatalf("expected the correlation id in the log entry but got: %q", got)
+	}
+
+	if ev := <-events; ev.CorrelationID != "req-42" {
+		t.Fatalf("expected event correlation id: req-42 but got: %q", ev.CorrelationID)
+	}
+}
+
+func TestChallengeFor(t *testing.T) {
+	auth := New(Options{
+		Realm: DefaultRealm,
+		Allow: AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		ChallengeFor: func(r *http.Request) bool {
+			return strings.Contains(r.UserAgent(), "Mozilla")
+		},
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	browser := withHeader("User-Agent", "Mozilla/5.0 (X11; Linux x86_64)")
+	apiClient := withHeader("User-Agent", "Go-http-client/1.1")
+
+	testHandler(t, handler, http.MethodGet, "/", browser).
+		statusCode(http.StatusUnauthorized).headerEq("WWW-Authenticate", `Basic realm="Authorization Required"`)
+	testHandler(t, handler, http.MethodGet, "/", apiClient).
+		statusCode(http.StatusUnauthorized).headerEq("WWW-Authenticate", "")
+	testHandler(t, handler, http.MethodGet, "/", apiClient, withBasicAuth("kataras", "invalid_pass")).
+		statusCode(http.StatusUnauthorized).headerEq("WWW-Authenticate", "")
+	testHandler(t, handler, http.MethodGet, "/", apiClient, withBasicAuth("kataras", "kataras_pass")).
+		statusCode(http.StatusOK)
+}
+
+func TestSuppressAuthenticateHeader(t *testing.T) {
+	auth := New(Options{
+		Realm:                      DefaultRealm,
+		Allow:                      AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		SuppressAuthenticateHeader: true,
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	xhr := withHeader("X-Requested-With", "XMLHttpRequest")
+	fetch := withHeader("Sec-Fetch-Dest", "empty")
+	navigation := withHeader("Sec-Fetch-Dest", "document")
+
+	testHandler(t, handler, http.MethodGet, "/", navigation).
+		statusCode(http.StatusUnauthorized).headerEq("WWW-Authenticate", `Basic realm="Authorization Required"`)
+	testHandler(t, handler, http.MethodGet, "/").
+		statusCode(http.StatusUnauthorized).headerEq("WWW-Authenticate", `Basic realm="Authorization Required"`)
+	testHandler(t, handler, http.MethodGet, "/", xhr).
+		statusCode(http.StatusUnauthorized).headerEq("WWW-Authenticate", "")
+	testHandler(t, handler, http.MethodGet, "/", fetch, withBasicAuth("kataras", "invalid_pass")).
+		statusCode(http.StatusUnauthorized).headerEq("WWW-Authenticate", "")
+	testHandler(t, handler, http.MethodGet, "/", xhr, withBasicAuth("kataras", "kataras_pass")).
+		statusCode(http.StatusOK)
+}
+
+func TestTokenAllow(t *testing.T) {
+	auth := New(Options{
+		Realm: DefaultRealm,
+		Allow: AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		TokenAllow: func(r *http.Request, token string) (interface{}, bool) {
+			if token != "secret_token" {
+				return nil, false
+			}
+
+			return &SimpleUser{Username: "service"}, true
+		},
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(GetUsername(r)))
+	}))
+
+	testHandler(t, handler, http.MethodGet, "/", withHeader("Authorization", "Bearer secret_token")).
+		statusCode(http.StatusOK).bodyEq("service")
+	testHandler(t, handler, http.MethodGet, "/", withHeader("Authorization", "bearer secret_token")).
+		statusCode(http.StatusOK).bodyEq("service")
+	testHandler(t, handler, http.MethodGet, "/", withHeader("Authorization", "Bearer invalid_token")).
+		statusCode(http.StatusUnauthorized).headerEq("WWW-Authenticate", `Basic realm="Authorization Required"`)
+	// Basic credentials still work.
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).
+		statusCode(http.StatusOK).bodyEq("kataras")
+	// Neither of the schemes.
+	testHandler(t, handler, http.MethodGet, "/", withHeader("Authorization", "Digest username=kataras")).
+		statusCode(http.StatusUnauthorized)
+	testHandler(t, handler, http.MethodGet, "/", withHeader("Authorization", "Bearer ")).
+		statusCode(http.StatusUnauthorized)
+}
+
+func TestRealmFunc(t *testing.T) {
+	auth := New(Options{
+		Realm: DefaultRealm,
+		Allow: AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		RealmFunc: func(r *http.Request) string {
+			switch {
+			case strings.HasPrefix(r.URL.Path, "/admin"):
+				return "Admin"
+			case strings.HasPrefix(r.URL.Path, "/api"):
+				return "API"
+			default:
+				return ""
+			}
+		},
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	testHandler(t, handler, http.MethodGet, "/admin").
+		statusCode(http.StatusUnauthorized).headerEq("WWW-Authenticate", `Basic realm="Admin"`)
+	testHandler(t, handler, http.MethodGet, "/api/users", withBasicAuth("kataras", "invalid_pass")).
+		statusCode(http.StatusUnauthorized).headerEq("WWW-Authenticate", `Basic realm="API"`)
+	testHandler(t, handler, http.MethodGet, "/").
+		statusCode(http.StatusUnauthorized).headerEq("WWW-Authenticate", `Basic realm="Authorization Required"`)
+	testHandler(t, handler, http.MethodGet, "/admin", withBasicAuth("kataras", "kataras_pass")).
+		statusCode(http.StatusOK)
+}
+
+func TestCharset(t *testing.T) {
+	auth := New(Options{
+		Realm:   DefaultRealm,
+		Charset: "UTF-8",
+		Allow:   AllowUsers(map[string]string{"kataras": "pässwörd_é"}),
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(GetPassword(r)))
+	}))
+
+	testHandler(t, handler, http.MethodGet, "/").
+		statusCode(http.StatusUnauthorized).headerEq("WWW-Authenticate", `Basic realm="Authorization Required", charset="UTF-8"`)
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "pässwörd_é")).
+		statusCode(http.StatusOK).bodyEq("pässwörd_é")
+	// The same password in ISO-8859-1 is not valid UTF-8.
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "p\xe4ssw\xf6rd_\xe9")).
+		statusCode(http.StatusUnauthorized)
+}
+
+func TestLockoutBackoff(t *testing.T) {
+	var backoffs []int
+	auth := New(Options{
+		Allow:    AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		MaxTries: 3,
+		LockoutBackoff: func(tries int) time.Duration {
+			backoffs = append(backoffs, tries)
+			if tries == 1 {
+				return 0 // the first failure is free.
+			}
+
+			return time.Minute
+		},
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	te := testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "invalid_pass")).
+		statusCode(http.StatusUnauthorized)
+	first := te.cookie(DefaultMaxTriesCookie)
+	if expected, got := "1", first.Value; expected != got {
+		t.Fatalf("expected cookie value: %q but got: %q", expected, got)
+	}
+
+	te = testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "invalid_pass"), withCookie(first)).
+		statusCode(http.StatusUnauthorized)
+	second := te.cookie(DefaultMaxTriesCookie)
+
+	// Locked out, even with valid credentials.
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass"), withCookie(second)).
+		statusCode(http.StatusTooManyRequests).headerEq("Retry-After", "60")
+
+	// The lockout window has passed.
+	expired := &http.Cookie{Name: DefaultMaxTriesCookie, Value: "2-" + strconv.FormatInt(time.Now().Add(-time.Second).Unix(), 10)}
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "invalid_pass"), withCookie(expired)).
+		statusCode(http.StatusForbidden)
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass"), withCookie(expired)).
+		statusCode(http.StatusOK)
+
+	if expected := []int{1, 2}; !reflect.DeepEqual(expected, backoffs) {
+		t.Fatalf("expected backoffs for tries: %v but got: %v", expected, backoffs)
+	}
+}
+
+func TestCloseDrain(t *testing.T) {
+	b, auth := NewBasicAuth(Options{
+		Allow: AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		GC:    GC{Every: time.Hour},
+	})
+
+	started, release := make(chan struct{}), make(chan struct{})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+
+	go testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass"))
+	<-started
+
+	closed := make(chan struct{})
+	go func() {
+		b.Close(true)
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+		t.Fatalf("expected Close to wait for the in-flight request")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatalf("expected Close to return after the in-flight request finished")
+	}
+
+	b.Close(false) // idempotent.
+}
+
+func TestGCLifecycle(t *testing.T) {
+	var (
+		logs          bytes.Buffer
+		starts, stops int
+	)
+
+	running := RunningGC()
+	b, _ := NewBasicAuth(Options{
+		Allow:       AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		GC:          GC{Every: time.Hour},
+		ErrorLogger: log.New(&logs, "", 0),
+		OnGCStart: func(every time.Duration) {
+			if every != time.Hour {
+				t.Fatalf("expected every: %s but got: %s", time.Hour, every)
+			}
+			starts++
+		},
+		OnGCStop: func() {
+			stops++
+		},
+	})
+
+	if starts != 1 || stops != 0 {
+		t.Fatalf("expected a single start but got: %d starts, %d stops", starts, stops)
+	}
+
+	if expected, got := running+1, RunningGC(); expected != got {
+		t.Fatalf("expected %d running GC goroutines but got: %d", expected, got)
+	}
+
+	b.Close(false)
+	b.Close(false) // idempotent.
+
+	if starts != 1 || stops != 1 {
+		t.Fatalf("expected a single stop on close but got: %d starts, %d stops", starts, stops)
+	}
+
+	if expected, got := running, RunningGC(); expected != got {
+		t.Fatalf("expected %d running GC goroutines but got: %d", expected, got)
+	}
+
+	if expected, got := "BasicAuth: GC: MaxAge is zero, entries are kept, see GC.RemoveAllWhenNoMaxAge\n"+
+		"BasicAuth: GC: started, every 1h0m0s\nBasicAuth: GC: stopped\n", logs.String(); expected != got {
+		t.Fatalf("expected logs: %q but got: %q", expected, got)
+	}
+}
+
+func TestStop(t *testing.T) {
+	running := RunningGC()
+	b, _ := NewBasicAuth(Options{
+		Allow:  AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		MaxAge: time.Hour,
+		GC:     GC{Every: time.Hour},
+	})
+
+	if expected, got := running+1, RunningGC(); expected != got {
+		t.Fatalf("expected %d running GC goroutines but got: %d", expected, got)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.Stop()
+		}()
+	}
+	wg.Wait()
+	b.Stop()
+
+	if expected, got := running, RunningGC(); expected != got {
+		t.Fatalf("expected %d running GC goroutines but got: %d", expected, got)
+	}
+
+	// Without a GC.
+	b, _ = NewBasicAuth(Options{Allow: AllowUsers(map[string]string{"kataras": "kataras_pass"})})
+	b.Stop()
+}
+
+func TestGCNoMaxAge(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	for _, removeAll := range []bool{false, true} {
+		var logs bytes.Buffer
+		b, auth := NewBasicAuth(Options{
+			Allow:       AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+			GC:          GC{Every: time.Hour, RemoveAllWhenNoMaxAge: removeAll},
+			ErrorLogger: log.New(&logs, "", 0),
+		})
+
+		testHandler(t, auth(handler), http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).
+			statusCode(http.StatusOK)
+
+		expected := 0
+		if removeAll {
+			expected = 1
+		}
+
+		if got := b.gc(); expected != got {
+			t.Fatalf("[removeAll=%v] expected %d removed entries but got: %d", removeAll, expected, got)
+		}
+
+		if expected, got := 1-expected, len(b.SessionInfo("kataras")); expected != got {
+			t.Fatalf("[removeAll=%v] expected %d stored entries but got: %d", removeAll, expected, got)
+		}
+
+		if warned := strings.Contains(logs.String(), "MaxAge is zero"); warned == removeAll {
+			t.Fatalf("[removeAll=%v] unexpected warning log: %q", removeAll, logs.String())
+		}
+
+		b.Close(false)
+	}
+}
+
+func TestReload(t *testing.T) {
+	b, auth := NewBasicAuth(Options{
+		Allow:  AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		MaxAge: time.Hour,
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).statusCode(http.StatusOK)
+	if expected, got := 1, b.Len(); expected != got {
+		t.Fatalf("expected %d stored credentials but got: %d", expected, got)
+	}
+
+	if err := b.Reload(AllowUsers(map[string]string{"makis": "makis_pass"})); err != nil {
+		t.Fatal(err)
+	}
+
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).statusCode(http.StatusUnauthorized)
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("makis", "makis_pass")).statusCode(http.StatusOK)
+	if expected, got := 1, b.Len(); expected != got {
+		t.Fatalf("expected %d stored credentials but got: %d", expected, got)
+	}
+
+	if err := b.Reload(nil); err == nil {
+		t.Fatalf("expected an error of a nil Allow")
+	}
+}
+
+func TestManualGC(t *testing.T) {
+	b, auth := NewBasicAuth(Options{
+		Allow:  AllowUsers(map[string]string{"kataras": "kataras_pass", "makis": "makis_pass"}),
+		MaxAge: 50 * time.Millisecond,
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).statusCode(http.StatusOK)
+	if expected, got := 0, b.GC(); expected != got {
+		t.Fatalf("expected %d removed credentials but got: %d", expected, got)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("makis", "makis_pass")).statusCode(http.StatusOK)
+
+	if expected, got := 1, b.GC(); expected != got {
+		t.Fatalf("expected %d removed credentials but got: %d", expected, got)
+	}
+	if expected, got := 1, b.Len(); expected != got {
+		t.Fatalf("expected %d stored credentials but got: %d", expected, got)
+	}
+}
+
+func TestGCStats(t *testing.T) {
+	b, auth := NewBasicAuth(Options{
+		Allow:  AllowUsers(map[string]string{"kataras": "kataras_pass", "makis": "makis_pass"}),
+		MaxAge: 50 * time.Millisecond,
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	if stats := b.GCStats(); stats != (GCStats{}) {
+		t.Fatalf("expected zero stats but got: %#+v", stats)
+	}
+
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).statusCode(http.StatusOK)
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("makis", "makis_pass")).statusCode(http.StatusOK)
+	b.GC()
+
+	time.Sleep(100 * time.Millisecond)
+	before := time.Now()
+	b.GC()
+
+	stats := b.GCStats()
+	if expected, got := int64(2), stats.Runs; expected != got {
+		t.Fatalf("expected %d runs but got: %d", expected, got)
+	}
+	if expected, got := 2, stats.LastRemoved; expected != got {
+		t.Fatalf("expected %d last removed but got: %d", expected, got)
+	}
+	if expected, got := int64(2), stats.TotalRemoved; expected != got {
+		t.Fatalf("expected %d total removed but got: %d", expected, got)
+	}
+	if stats.LastRun.Before(before) {
+		t.Fatalf("expected last run after %s but got: %s", before, stats.LastRun)
+	}
+}
+
+func TestDuplicateAuthorizationHeaders(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	allow := AllowUsers(map[string]string{"kataras": "kataras_pass", "makis": "makis_pass"})
+
+	duplicate := func(key string) requestOption {
+		return func(r *http.Request) error {
+			r.Header.Add(key, "Basic a2F0YXJhczprYXRhcmFzX3Bhc3M=") // kataras:kataras_pass
+			r.Header.Add(key, "Basic bWFraXM6bWFraXNfcGFzcw==")     // makis:makis_pass
+			return nil
+		}
+	}
+
+	auth := New(Options{Allow: allow, Optional: true})
+	testHandler(t, auth(handler), http.MethodGet, "/", duplicate("Authorization")).
+		statusCode(http.StatusUnauthorized)
+	testHandler(t, auth(handler), http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).
+		statusCode(http.StatusOK)
+
+	auth = New(Options{Allow: allow, Proxy: true})
+	testHandler(t, auth(handler), http.MethodGet, "/", duplicate("Proxy-Authorization")).
+		statusCode(http.StatusProxyAuthRequired)
+}
+
+func TestCredentialSeparator(t *testing.T) {
+	auth := New(Options{
+		Allow:               AllowUsers(map[string]string{"kataras": "kataras:pass"}),
+		CredentialSeparator: '|',
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(GetUser(r).(*SimpleUser).Password))
+	}))
+
+	custom := "Basic " + base64.StdEncoding.EncodeToString([]byte("kataras|kataras:pass"))
+	testHandler(t, handler, http.MethodGet, "/", withHeader("Authorization", custom)).
+		statusCode(http.StatusOK).bodyEq("kataras:pass")
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras:pass")).
+		statusCode(http.StatusUnauthorized)
+}
+
+func TestFailureReason(t *testing.T) {
+	var reasons []error
+	auth := New(Options{
+		Realm:    DefaultRealm,
+		Allow:    AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		MaxTries: 3,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			var (
+				notFound ErrUserNotFound
+				mismatch ErrPasswordMismatch
+			)
+
+			switch {
+			case errors.As(err, &notFound):
+				reasons = append(reasons, notFound)
+			case errors.As(err, &mismatch):
+				reasons = append(reasons, mismatch)
+			}
+
+			DefaultErrorHandler(w, r, err)
+		},
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	notFound := testHandler(t, handler, http.MethodGet, "/", withBasicAuth("unknown", "kataras_pass"))
+	mismatch := testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "invalid_pass"))
+
+	expected := []error{ErrUserNotFound{Username: "unknown"}, ErrPasswordMismatch{Username: "kataras"}}
+	if !reflect.DeepEqual(expected, reasons) {
+		t.Fatalf("expected reasons: %v but got: %v", expected, reasons)
+	}
+
+	// The wire response stays the same.
+	for _, te := range []*testie{notFound, mismatch} {
+		te.statusCode(http.StatusUnauthorized).
+			headerEq("WWW-Authenticate", `Basic realm="Authorization Required"`).
+			bodyEq(http.StatusText(http.StatusUnauthorized) + "\n")
+	}
+}
+
+func TestFileServer(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "hello.txt"), []byte("Hello, World!"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := FileServer(Options{
+		Allow: AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+	}, dir)
+
+	testHandler(t, handler, http.MethodGet, "/hello.txt").
+		statusCode(http.StatusUnauthorized)
+	testHandler(t, handler, http.MethodGet, "/hello.txt", withBasicAuth("kataras", "kataras_pass")).
+		statusCode(http.StatusOK).bodyEq("Hello, World!")
+	testHandler(t, handler, http.MethodGet, "/missing.txt").
+		statusCode(http.StatusUnauthorized) // do not leak the existence of files.
+	testHandler(t, handler, http.MethodGet, "/missing.txt", withBasicAuth("kataras", "kataras_pass")).
+		statusCode(http.StatusNotFound)
+
+	te := testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).
+		statusCode(http.StatusOK)
+	b, err := ioutil.ReadAll(te.resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := string(b); !strings.Contains(body, `<a href="hello.txt">`) || !strings.Contains(body, `<a href="sub/">`) {
+		t.Fatalf("expected a directory listing but got: %s", body)
+	}
+}
+
+func TestDisable(t *testing.T) {
+	b, auth := NewBasicAuth(Options{
+		Allow: AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if IsAnonymous(r) {
+			w.Write([]byte("anonymous"))
+			return
+		}
+
+		w.Write([]byte(GetUser(r).(*SimpleUser).Username))
+	}))
+
+	testHandler(t, handler, http.MethodGet, "/").statusCode(http.StatusUnauthorized)
+
+	b.Disable()
+	testHandler(t, handler, http.MethodGet, "/").statusCode(http.StatusOK).bodyEq("anonymous")
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "invalid_pass")).
+		statusCode(http.StatusOK).bodyEq("anonymous")
+
+	b.Enable()
+	testHandler(t, handler, http.MethodGet, "/").statusCode(http.StatusUnauthorized)
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).
+		statusCode(http.StatusOK).bodyEq("kataras")
+
+	b, auth = NewBasicAuth(Options{
+		Allow:             AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		BlockWhenDisabled: true,
+	})
+	handler = auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	b.Disable()
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).
+		statusCode(http.StatusServiceUnavailable)
+}
+
+func TestAlwaysAdvertiseChallenge(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	allow := AllowUsers(map[string]string{"kataras": "kataras_pass"})
+
+	auth := New(Options{Realm: DefaultRealm, Allow: allow, AlwaysAdvertiseChallenge: true})
+	testHandler(t, auth(handler), http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).
+		statusCode(http.StatusOK).headerEq("WWW-Authenticate", `Basic realm="Authorization Required"`)
+	testHandler(t, auth(handler), http.MethodGet, "/").
+		statusCode(http.StatusUnauthorized).headerEq("WWW-Authenticate", `Basic realm="Authorization Required"`)
+
+	auth = New(Options{Realm: DefaultRealm, Allow: allow})
+	testHandler(t, auth(handler), http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).
+		statusCode(http.StatusOK).headerEq("WWW-Authenticate", "")
+}
+
+func TestRealmByTries(t *testing.T) {
+	auth := New(Options{
+		Realm:    DefaultRealm,
+		Allow:    AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		MaxTries: 3,
+		RealmByTries: func(tries, max int) string {
+			if tries == max-1 {
+				return DefaultRealm + " - last attempt"
+			}
+
+			return fmt.Sprintf("%s - %d attempts left", DefaultRealm, max-tries)
+		},
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	testHandler(t, handler, http.MethodGet, "/").
+		statusCode(http.StatusUnauthorized).headerEq("WWW-Authenticate", `Basic realm="Authorization Required"`)
+
+	te := testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "invalid_pass")).
+		statusCode(http.StatusUnauthorized).headerEq("WWW-Authenticate", `Basic realm="Authorization Required - 2 attempts left"`)
+
+	te = testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "invalid_pass"), withCookie(te.cookie(DefaultMaxTriesCookie))).
+		statusCode(http.StatusUnauthorized).headerEq("WWW-Authenticate", `Basic realm="Authorization Required - last attempt"`)
+
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "invalid_pass"), withCookie(te.cookie(DefaultMaxTriesCookie))).
+		statusCode(http.StatusForbidden)
+}
+
+func TestTriesRemainingHeader(t *testing.T) {
+	const header = "X-Auth-Tries-Remaining"
+
+	auth := New(Options{
+		Allow:                AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		MaxTries:             3,
+		TriesRemainingHeader: header,
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	te := testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "invalid_pass")).
+		statusCode(http.StatusUnauthorized).headerEq(header, "2")
+	te = testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "invalid_pass"), withCookie(te.cookie(DefaultMaxTriesCookie))).
+		statusCode(http.StatusUnauthorized).headerEq(header, "1")
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "invalid_pass"), withCookie(te.cookie(DefaultMaxTriesCookie))).
+		statusCode(http.StatusForbidden).headerEq(header, "")
+
+	// Absent without MaxTries.
+	auth = New(Options{
+		Allow:                AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		TriesRemainingHeader: header,
+	})
+	handler = auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "invalid_pass")).
+		statusCode(http.StatusUnauthorized).headerEq(header, "")
+}
+
+func TestHTTPSOnlyCode(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	allow := AllowUsers(map[string]string{"kataras": "kataras_pass"})
+
+	var tests = []struct {
+		code     int
+		expected int
+		upgrade  string
+	}{
+		{0, http.StatusHTTPVersionNotSupported, ""},
+		{http.StatusUpgradeRequired, http.StatusUpgradeRequired, "TLS/1.2, HTTP/1.1"},
+		{http.StatusForbidden, http.StatusForbidden, ""},
+	}
+
+	for _, tt := range tests {
+		auth := New(Options{Allow: allow, HTTPSOnly: true, HTTPSOnlyCode: tt.code})
+		testHandler(t, auth(handler), http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).
+			statusCode(tt.expected).headerEq("Upgrade", tt.upgrade)
+	}
+}
+
+func TestHTTPSOnly(t *testing.T) {
+	auth := New(Options{
+		Allow:     AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		HTTPSOnly: true,
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	withTLS := func(protoMajor int) requestOption {
+		return func(r *http.Request) error {
+			r.TLS = &tls.ConnectionState{Version: tls.VersionTLS13}
+			r.ProtoMajor = protoMajor
+			return nil
+		}
+	}
+
+	// HTTP/1.1 over TLS.
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass"), withTLS(1)).
+		statusCode(http.StatusOK)
+	// HTTP/2 over TLS.
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass"), withTLS(2)).
+		statusCode(http.StatusOK)
+	// Plain HTTP/1.1.
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).
+		statusCode(http.StatusHTTPVersionNotSupported)
+}
+
+func TestTrustedProxies(t *testing.T) {
+	auth := New(Options{
+		Allow:          AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		HTTPSOnly:      true,
+		TrustedProxies: []string{"10.0.0.0/8", "::1"},
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	withRemoteAddr := func(addr string) requestOption {
+		return func(r *http.Request) error {
+			r.RemoteAddr = addr
+			return nil
+		}
+	}
+
+	var tests = []struct {
+		remoteAddr string
+		proto      string
+		expected   int
+	}{
+		{"10.0.0.1:4242", "https", http.StatusOK},
+		{"[::1]:4242", "HTTPS", http.StatusOK},
+		{"10.0.0.1:4242", "https, http", http.StatusOK},
+		{"10.0.0.1:4242", "http", http.StatusHTTPVersionNotSupported},
+		{"10.0.0.1:4242", "", http.StatusHTTPVersionNotSupported},
+		// Spoofed by a client which is not a trusted proxy.
+		{"192.168.1.1:4242", "https", http.StatusHTTPVersionNotSupported},
+	}
+
+	for _, tt := range tests {
+		testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass"),
+			withRemoteAddr(tt.remoteAddr), withHeader("X-Forwarded-Proto", tt.proto)).
+			statusCode(tt.expected)
+	}
+
+	// Not trusted by default.
+	auth = New(Options{Allow: AllowUsers(map[string]string{"kataras": "kataras_pass"}), HTTPSOnly: true})
+	testHandler(t, auth(handler), http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass"),
+		withRemoteAddr("10.0.0.1:4242"), withHeader("X-Forwarded-Proto", "https")).
+		statusCode(http.StatusHTTPVersionNotSupported)
+
+	if _, err := newBasicAuth(Options{Allow: AllowUsers(map[string]string{"kataras": "kataras_pass"}), TrustedProxies: []string{"not_an_ip"}}); err == nil {
+		t.Fatalf("expected an error of an invalid trusted proxy")
+	}
+}
+
+func TestSetUserHeader(t *testing.T) {
+	auth := New(Options{
+		Allow:         AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		Optional:      true,
+		SetUserHeader: "X-Authenticated-User",
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-Authenticated-User")))
+	}))
+
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).
+		statusCode(http.StatusOK).headerEq("X-Authenticated-User", "kataras").bodyEq("kataras")
+	// Spoofed by the client.
+	testHandler(t, handler, http.MethodGet, "/", withHeader("X-Authenticated-User", "admin")).
+		statusCode(http.StatusOK).headerEq("X-Authenticated-User", "").bodyEq("")
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "invalid_pass")).
+		statusCode(http.StatusUnauthorized).headerEq("X-Authenticated-User", "")
+}
@@ -0,0 +1,107 @@
+package basicauth
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultCachedMaxSize is the default maximum number of entries
+// the Cached AuthFunc holds, when CachedOptions.MaxSize is zero.
+const DefaultCachedMaxSize = 1024
+
+// CachedOptions holds the options for the Cached function.
+type CachedOptions struct {
+	// PositiveTTL is the duration that a successful verification result is cached.
+	// Zero disables caching of successful results.
+	PositiveTTL time.Duration
+	// NegativeTTL is the duration that a failed verification result is cached.
+	// Useful to blunt repeated brute-force attempts against an expensive backend.
+	// Keep it very short (e.g. a few seconds),
+	// so a user who just fixed their password is not locked out for long.
+	// Zero disables caching of failures.
+	NegativeTTL time.Duration
+	// MaxSize is the maximum number of cached entries.
+	// When the cache is full expired entries are removed first,
+	// if there is still no room then a random entry is evicted.
+	//
+	// Defaults to DefaultCachedMaxSize.
+	MaxSize int
+}
+
+type cachedResult struct {
+	user      interface{}
+	ok        bool
+	expiresAt time.Time
+}
+
+// Cached wraps an AuthFunc, e.g. a database lookup, and caches its results
+// for the configured durations. The cache is keyed by a SHA-256 hash
+// of the username and password (see fullUserKey), so plain passwords are not kept in memory.
+//
+// Note that the cached results do not depend on the request,
+// do NOT use it when the given AuthFunc makes decisions based on the request.
+//
+// Usage:
+//
+//	Allow: Cached(AllowDatabase(db), CachedOptions{
+//		PositiveTTL: 5 * time.Minute,
+//		NegativeTTL: 5 * time.Second,
+//	})
+func Cached(allow AuthFunc, opts CachedOptions) AuthFunc {
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = DefaultCachedMaxSize
+	}
+
+	var (
+		mu      sync.Mutex
+		entries = make(map[string]cachedResult)
+	)
+
+	return func(r *http.Request, username, password string) (interface{}, bool) {
+		key := fullUserKey(username, password)
+		now := time.Now()
+
+		mu.Lock()
+		entry, found := entries[key]
+		if found && entry.expiresAt.Before(now) {
+			delete(entries, key)
+			found = false
+		}
+		mu.Unlock()
+
+		if found {
+			return entry.user, entry.ok
+		}
+
+		user, ok := allow(r, username, password)
+
+		ttl := opts.NegativeTTL
+		if ok {
+			ttl = opts.PositiveTTL
+		}
+
+		if ttl > 0 {
+			mu.Lock()
+			if len(entries) >= opts.MaxSize {
+				for k, e := range entries { // remove expired ones first.
+					if e.expiresAt.Before(now) {
+						delete(entries, k)
+					}
+				}
+
+				for k := range entries { // still full, evict a random one.
+					if len(entries) < opts.MaxSize {
+						break
+					}
+					delete(entries, k)
+				}
+			}
+
+			entries[key] = cachedResult{user: user, ok: ok, expiresAt: now.Add(ttl)}
+			mu.Unlock()
+		}
+
+		return user, ok
+	}
+}
@@ -0,0 +1,74 @@
+package basicauth
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCached(t *testing.T) {
+	var calls int
+	backend := func(r *http.Request, username, password string) (interface{}, bool) {
+		calls++
+		return nil, username == "kataras" && password == "kataras_pass"
+	}
+
+	allow := Cached(backend, CachedOptions{
+		PositiveTTL: time.Minute,
+		NegativeTTL: 50 * time.Millisecond,
+		MaxSize:     2,
+	})
+
+	var tests = []struct {
+		username, password string
+		ok                 bool
+		calls              int
+	}{
+		{"kataras", "kataras_pass", true, 1},
+		{"kataras", "kataras_pass", true, 1}, // positive cache hit.
+		{"kataras", "invalid_pass", false, 2},
+		{"kataras", "invalid_pass", false, 2}, // negative cache hit.
+	}
+
+	for i, tt := range tests {
+		if _, ok := allow(nil, tt.username, tt.password); tt.ok != ok {
+			t.Fatalf("[%d] expected: %v but got: %v", i, tt.ok, ok)
+		}
+
+		if tt.calls != calls {
+			t.Fatalf("[%d] expected backend calls: %d but got: %d", i, tt.calls, calls)
+		}
+	}
+
+	time.Sleep(60 * time.Millisecond) // negative entry expired.
+	if _, ok := allow(nil, "kataras", "invalid_pass"); ok {
+		t.Fatalf("expected failure")
+	}
+	if expected := 3; calls != expected {
+		t.Fatalf("expected backend calls: %d after negative TTL but got: %d", expected, calls)
+	}
+
+	// MaxSize is 1, a second entry evicts the first one.
+	calls = 0
+	allow = Cached(backend, CachedOptions{PositiveTTL: time.Minute, NegativeTTL: time.Minute, MaxSize: 1})
+	allow(nil, "kataras", "kataras_pass")
+	allow(nil, "makis", "makis_pass")
+	allow(nil, "kataras", "kataras_pass")
+	if expected := 3; calls != expected {
+		t.Fatalf("expected backend calls: %d after eviction but got: %d", expected, calls)
+	}
+}
+
+func TestCachedSeparatorInUsername(t *testing.T) {
+	backend := func(r *http.Request, username, password string) (interface{}, bool) {
+		return nil, username == "a:b" && password == "c"
+	}
+
+	allow := Cached(backend, CachedOptions{PositiveTTL: time.Minute, NegativeTTL: time.Minute})
+	if _, ok := allow(nil, "a:b", "c"); !ok {
+		t.Fatalf("expected success")
+	}
+	if _, ok := allow(nil, "a", "b:c"); ok {
+		t.Fatalf("expected a different user to not share the cached result")
+	}
+}
@@ -0,0 +1,33 @@
+package basicauth
+
+import (
+	"crypto/x509"
+	"net/http"
+)
+
+// verifiedCertificate returns the leaf client certificate of the request,
+// only if the TLS server verified its chain.
+func verifiedCertificate(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+
+	return r.TLS.PeerCertificates[0]
+}
+
+// AllowCommonNames returns a function for the Options.AllowCertificate field,
+// it maps the Subject Common Name of a verified client certificate to a user.
+// A nil user value is stored as a *SimpleUser with the Common Name as its Username.
+//
+// Usage:
+//
+//	AllowCertificate: AllowCommonNames(map[string]interface{}{
+//		"service-a": nil,
+//		"admin":     myAdminUser,
+//	})
+func AllowCommonNames(users map[string]interface{}) func(r *http.Request, cert *x509.Certificate) (interface{}, bool) {
+	return func(_ *http.Request, cert *x509.Certificate) (interface{}, bool) {
+		user, ok := users[cert.Subject.CommonName]
+		return user, ok
+	}
+}
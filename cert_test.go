@@ -0,0 +1,52 @@
+package basicauth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"testing"
+)
+
+func withPeerCertificate(commonName string, verified bool) requestOption {
+	return func(r *http.Request) error {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+		r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+		if verified {
+			r.TLS.VerifiedChains = [][]*x509.Certificate{{cert}}
+		}
+
+		return nil
+	}
+}
+
+func TestAllowCertificate(t *testing.T) {
+	auth := New(Options{
+		Allow: AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		AllowCertificate: AllowCommonNames(map[string]interface{}{
+			"service-a": nil,
+			"admin":     Map{"role": "admin"},
+		}),
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch u := GetUser(r).(type) {
+		case *SimpleUser:
+			w.Write([]byte(u.Username))
+		case Map:
+			w.Write([]byte(u["role"].(string)))
+		}
+	}))
+
+	testHandler(t, handler, http.MethodGet, "/", withPeerCertificate("service-a", true)).
+		statusCode(http.StatusOK).bodyEq("service-a")
+	testHandler(t, handler, http.MethodGet, "/", withPeerCertificate("admin", true)).
+		statusCode(http.StatusOK).bodyEq("admin")
+	// Not matching, basic authentication is the fallback.
+	testHandler(t, handler, http.MethodGet, "/", withPeerCertificate("service-b", true)).
+		statusCode(http.StatusUnauthorized)
+	testHandler(t, handler, http.MethodGet, "/", withPeerCertificate("service-b", true), withBasicAuth("kataras", "kataras_pass")).
+		statusCode(http.StatusOK).bodyEq("kataras")
+	// Not verified by the TLS server.
+	testHandler(t, handler, http.MethodGet, "/", withPeerCertificate("service-a", false)).
+		statusCode(http.StatusUnauthorized)
+}
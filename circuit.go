@@ -0,0 +1,68 @@
+package basicauth
+
+import (
+	"sync"
+	"time"
+)
+
+// FailureCircuit holds the configuration of a global circuit breaker
+// which protects the credentials backend during a credential-stuffing storm.
+// After Threshold failures, across all users, inside the Window duration
+// the circuit opens for OpenFor duration.
+// While it's open the requests do not reach the Options.Allow at all.
+// See the Options.FailureCircuit field.
+type FailureCircuit struct {
+	// Threshold is the number of failures inside the Window that trips the circuit.
+	// Zero disables the circuit breaker.
+	Threshold int
+	// Window is the duration which the failures are counted in.
+	Window time.Duration
+	// OpenFor is the duration the circuit stays open after a trip.
+	OpenFor time.Duration
+	// FailOpen if set to true then, while the circuit is open,
+	// all requests are passed through to the next handler anonymously
+	// (see IsAnonymous) instead of being rejected with a 503 Service Unavailable (fail-closed).
+	// Use it with caution, it effectively disables the authentication for OpenFor duration.
+	FailOpen bool
+}
+
+// circuitBreaker implements the FailureCircuit.
+type circuitBreaker struct {
+	cfg FailureCircuit
+
+	mu          sync.Mutex
+	windowStart time.Time
+	failures    int
+	openUntil   time.Time
+}
+
+// openFor reports the remaining duration of an open circuit,
+// zero means that the circuit is closed.
+func (c *circuitBreaker) openFor(now time.Time) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.Before(c.openUntil) {
+		return c.openUntil.Sub(now)
+	}
+
+	return 0
+}
+
+// fail records a failure and trips the circuit when the threshold is reached.
+func (c *circuitBreaker) fail(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.Sub(c.windowStart) > c.cfg.Window {
+		c.windowStart = now
+		c.failures = 0
+	}
+
+	c.failures++
+	if c.failures >= c.cfg.Threshold {
+		c.openUntil = now.Add(c.cfg.OpenFor)
+		c.windowStart = now
+		c.failures = 0
+	}
+}
@@ -0,0 +1,49 @@
+package basicauth
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestFailureCircuit(t *testing.T) {
+	for _, failOpen := range []bool{false, true} {
+		auth := New(Options{
+			Allow: AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+			FailureCircuit: FailureCircuit{
+				Threshold: 2,
+				Window:    time.Second,
+				OpenFor:   50 * time.Millisecond,
+				FailOpen:  failOpen,
+			},
+		})
+		handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if IsAnonymous(r) {
+				w.Write([]byte("anonymous"))
+			}
+		}))
+
+		testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).
+			statusCode(http.StatusOK)
+		testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "invalid_pass")).
+			statusCode(http.StatusUnauthorized)
+		testHandler(t, handler, http.MethodGet, "/", withBasicAuth("makis", "invalid_pass")).
+			statusCode(http.StatusUnauthorized)
+
+		// Tripped.
+		if failOpen {
+			testHandler(t, handler, http.MethodGet, "/").
+				statusCode(http.StatusOK).bodyEq("anonymous")
+		} else {
+			testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).
+				statusCode(http.StatusServiceUnavailable).headerEq("Retry-After", "1")
+		}
+
+		// Recovered.
+		time.Sleep(60 * time.Millisecond)
+		testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).
+			statusCode(http.StatusOK).bodyEq("")
+		testHandler(t, handler, http.MethodGet, "/").
+			statusCode(http.StatusUnauthorized)
+	}
+}
@@ -13,6 +13,26 @@ const (
 	userContextKey key = iota
 	// logoutFuncContextKey is the key for the user logout function.
 	logoutFuncContextKey
+	// anonymousContextKey is the key which reports whether
+	// the request was passed through without credentials (see Options.Optional).
+	anonymousContextKey
+	// credentialsContextKey is the key for the authenticated username and password.
+	credentialsContextKey
+)
+
+// credentials holds the username and password
+// which the middleware authenticated, see GetUsername.
+type credentials struct {
+	username, password string
+}
+
+type (
+	// namespaceContextKey is the type of the per-instance key for the authenticated user,
+	// see Options.ContextNamespace.
+	namespaceContextKey string
+	// instanceContextKey is the type of the per-instance key for the authenticated user
+	// when the Options.ContextNamespace is empty.
+	instanceContextKey struct{ b *BasicAuth }
 )
 
 type logoutFunc func(*http.Request) *http.Request
@@ -23,22 +43,109 @@ func GetUser(r *http.Request) interface{} {
 	return r.Context().Value(userContextKey)
 }
 
+// GetUsername returns the username of the current authenticated user.
+// If the user implements the User interface then its GetUsername is used,
+// otherwise it is the username which the middleware authenticated,
+// e.g. the primary username of an alias (see AliasedUser).
+// It returns an empty string when the request is not authenticated.
+func GetUsername(r *http.Request) string {
+	username, _ := getCredentials(r)
+	return username
+}
+
+// GetPassword returns the password of the current authenticated user,
+// see GetUsername. Note that a User's GetPassword may return the stored (e.g. hashed) password.
+// It returns an empty string when the request is not authenticated.
+func GetPassword(r *http.Request) string {
+	_, password := getCredentials(r)
+	return password
+}
+
+// getCredentials returns the username and password of the current authenticated user.
+func getCredentials(r *http.Request) (username, password string) {
+	v := GetUser(r)
+	if v == nil {
+		return
+	}
+
+	if u, ok := v.(User); ok {
+		return u.GetUsername(), u.GetPassword()
+	}
+
+	username, password, _ = getContextCredentials(r.Context())
+	return
+}
+
+// getContextCredentials returns the username and password which the middleware authenticated, if any.
+func getContextCredentials(ctx context.Context) (username, password string, ok bool) {
+	c, ok := ctx.Value(credentialsContextKey).(*credentials)
+	if !ok || c == nil {
+		return "", "", false
+	}
+
+	return c.username, c.password, true
+}
+
+// GetUserNamespace returns the current authenticated User
+// of the middleware with the given Options.ContextNamespace.
+func GetUserNamespace(r *http.Request, namespace string) interface{} {
+	return r.Context().Value(namespaceContextKey(namespace))
+}
+
+// GetUser returns the current authenticated User of this BasicAuth instance.
+// Unlike the GetUser package-level function, it is not affected by other
+// chained middlewares, each instance retrieves its own user.
+func (b *BasicAuth) GetUser(r *http.Request) interface{} {
+	return r.Context().Value(b.userContextKey)
+}
+
+// IsAnonymous reports whether the current request was served
+// by a middleware running on Optional mode without any credentials.
+// It returns false for authenticated requests and
+// for requests that did not pass through the middleware at all.
+func IsAnonymous(r *http.Request) bool {
+	anonymous, _ := r.Context().Value(anonymousContextKey).(bool)
+	return anonymous
+}
+
 // Logout deletes the authenticated user entry from the backend.
 // The client should login again on the next request.
 func Logout(r *http.Request) *http.Request {
-	if fn, ok := r.Context().Value(logoutFuncContextKey).(logoutFunc); ok {
+	if fn, ok := r.Context().Value(logoutFuncContextKey).(logoutFunc); ok && fn != nil {
 		r = fn(r)
 	}
 
 	return r
 }
 
+// LogoutUser same as Logout but it returns the user that was logged out too,
+// e.g. to render a confirmation message, even when the Options.OnLogoutClearContext is true.
+//
+// Usage:
+//
+//	user, r := LogoutUser(r)
+func LogoutUser(r *http.Request) (interface{}, *http.Request) {
+	user := GetUser(r)
+	return user, Logout(r)
+}
+
 // newContext returns a new Context with specific basicauth values.
 func newContext(ctx context.Context, user interface{}, logoutFn logoutFunc) context.Context {
 	parent := context.WithValue(ctx, userContextKey, user)
 	return context.WithValue(parent, logoutFuncContextKey, logoutFn)
 }
 
+// newCredentialsContext returns a new Context with the authenticated username and password.
+func newCredentialsContext(ctx context.Context, username, password string) context.Context {
+	return context.WithValue(ctx, credentialsContextKey, &credentials{username, password})
+}
+
+// newAnonymousContext returns a new Context which marks the request as anonymous.
+func newAnonymousContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, anonymousContextKey, true)
+}
+
 func clearContext(ctx context.Context) context.Context {
+	ctx = context.WithValue(ctx, credentialsContextKey, (*credentials)(nil))
 	return newContext(ctx, nil, nil)
 }
@@ -0,0 +1,298 @@
+package basicauth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+// SHACRYPT it is a UserAuthOption, it compares a SHA-256 ($5$) or SHA-512 ($6$) crypt hash,
+// as found in /etc/shadow and htpasswd files, with its user input in constant time.
+// The salt and the rounds are read from each stored hash.
+// Reports true on success and false on failure.
+//
+// It can be composed with the BCRYPT and ARGON2 options,
+// so a single user list can mix hash schemes, each one is detected by its prefix.
+//
+// See https://www.akkadia.org/drepper/SHA-crypt.txt.
+//
+// Usage:
+//
+//	Options.Allow = AllowUsersFile("users.yml", SHACRYPT) OR
+//	Options.Allow = AllowUsersFile("users.yml", SHACRYPT, BCRYPT) OR
+//	Options.Allow = AllowUsersShadowFile("shadow") // SHACRYPT is the default.
+func SHACRYPT(opts *UserAuthOptions) {
+	withScheme(hashScheme{
+		prefixes: []string{cryptSHA512Magic, cryptSHA256Magic},
+		verify:   verifyCrypt,
+		dummy:    dummyCryptHash,
+	})(opts)
+}
+
+// CRYPT is an alias of the SHACRYPT UserAuthOption.
+func CRYPT(opts *UserAuthOptions) {
+	SHACRYPT(opts)
+}
+
+// dummyCryptHash is a SHA-512 crypt hash of the default rounds,
+// compared against on unknown usernames, see UserAuthOptions.DummyPassword.
+const dummyCryptHash = "$6$basicauthdummy$lzM3WTx3yKSdEMggC9RK8MuK88uD58cqPd1sThccKYCLb/uRi1922tS2o5SH6a901ZpO02KdbVZ/LvOyPdJtt."
+
+const (
+	cryptSaltMaxLen       = 16
+	cryptRoundsDefault    = 5000
+	cryptRoundsMin        = 1000
+	cryptRoundsMax        = 999999999
+	cryptRoundsPrefix     = "rounds="
+	cryptBase64Alphabet   = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	cryptSHA256Magic      = "$5$"
+	cryptSHA512Magic      = "$6$"
+	shadowCommentPrefix   = "#"
+	shadowFieldsSeparator = ":"
+)
+
+var errCryptMalformed = errors.New("crypt: malformed hash")
+
+// verifyCrypt compares a SHA-256 or SHA-512 crypt hash with its user input in constant time.
+func verifyCrypt(stored, userPassword string) bool {
+	computed, err := shaCrypt(stored, userPassword)
+	if err != nil {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(stored)) == 1
+}
+
+// shaCrypt computes the crypt hash of the password,
+// using the algorithm, the rounds and the salt of the given hash (or setting, e.g. "$6$salt").
+func shaCrypt(setting, password string) (string, error) {
+	var (
+		newHash func() hash.Hash
+		order   [][3]int // the byte order of the final encoding.
+		magic   string
+	)
+
+	switch {
+	case strings.HasPrefix(setting, cryptSHA512Magic):
+		newHash, order, magic = sha512.New, sha512CryptOrder, cryptSHA512Magic
+	case strings.HasPrefix(setting, cryptSHA256Magic):
+		newHash, order, magic = sha256.New, sha256CryptOrder, cryptSHA256Magic
+	default:
+		return "", errCryptMalformed
+	}
+
+	rest := setting[len(magic):]
+	rounds, customRounds := cryptRoundsDefault, false
+	if strings.HasPrefix(rest, cryptRoundsPrefix) {
+		idx := strings.IndexByte(rest, '$')
+		if idx < 0 {
+			return "", errCryptMalformed
+		}
+
+		n, err := strconv.Atoi(rest[len(cryptRoundsPrefix):idx])
+		if err != nil {
+			return "", errCryptMalformed
+		}
+
+		rounds, customRounds = n, true
+		if rounds < cryptRoundsMin {
+			rounds = cryptRoundsMin
+		} else if rounds > cryptRoundsMax {
+			rounds = cryptRoundsMax
+		}
+		rest = rest[idx+1:]
+	}
+
+	salt := rest
+	if idx := strings.IndexByte(salt, '$'); idx >= 0 {
+		salt = salt[:idx]
+	}
+	if len(salt) > cryptSaltMaxLen {
+		salt = salt[:cryptSaltMaxLen]
+	}
+
+	p, s := []byte(password), []byte(salt)
+
+	// Digest B.
+	h := newHash()
+	h.Write(p)
+	h.Write(s)
+	h.Write(p)
+	digestB := h.Sum(nil)
+	size := len(digestB)
+
+	// Digest A.
+	h = newHash()
+	h.Write(p)
+	h.Write(s)
+	for n := len(p); n > 0; n -= size {
+		if n > size {
+			h.Write(digestB)
+		} else {
+			h.Write(digestB[:n])
+		}
+	}
+	for n := len(p); n > 0; n >>= 1 {
+		if n&1 != 0 {
+			h.Write(digestB)
+		} else {
+			h.Write(p)
+		}
+	}
+	digestA := h.Sum(nil)
+
+	// Sequence P.
+	h = newHash()
+	for i := 0; i < len(p); i++ {
+		h.Write(p)
+	}
+	seqP := repeatBytes(h.Sum(nil), len(p))
+
+	// Sequence S.
+	h = newHash()
+	for i := 0; i < 16+int(digestA[0]); i++ {
+		h.Write(s)
+	}
+	seqS := repeatBytes(h.Sum(nil), len(s))
+
+	// Rounds.
+	c := digestA
+	for i := 0; i < rounds; i++ {
+		h = newHash()
+		if i&1 != 0 {
+			h.Write(seqP)
+		} else {
+			h.Write(c)
+		}
+		if i%3 != 0 {
+			h.Write(seqS)
+		}
+		if i%7 != 0 {
+			h.Write(seqP)
+		}
+		if i&1 != 0 {
+			h.Write(c)
+		} else {
+			h.Write(seqP)
+		}
+		c = h.Sum(nil)
+	}
+
+	buf := bytes.NewBufferString(magic)
+	if customRounds {
+		buf.WriteString(cryptRoundsPrefix + strconv.Itoa(rounds) + "$")
+	}
+	buf.WriteString(salt)
+	buf.WriteByte('$')
+
+	for _, g := range order {
+		cryptBase64(buf, c[g[0]], c[g[1]], c[g[2]], 4)
+	}
+
+	// The remaining bytes.
+	if magic == cryptSHA512Magic {
+		cryptBase64(buf, 0, 0, c[63], 2)
+	} else {
+		cryptBase64(buf, 0, c[31], c[30], 3)
+	}
+
+	return buf.String(), nil
+}
+
+var sha512CryptOrder = [][3]int{
+	{0, 21, 42}, {22, 43, 1}, {44, 2, 23}, {3, 24, 45}, {25, 46, 4}, {47, 5, 26}, {6, 27, 48},
+	{28, 49, 7}, {50, 8, 29}, {9, 30, 51}, {31, 52, 10}, {53, 11, 32}, {12, 33, 54}, {34, 55, 13},
+	{56, 14, 35}, {15, 36, 57}, {37, 58, 16}, {59, 17, 38}, {18, 39, 60}, {40, 61, 19}, {62, 20, 41},
+}
+
+var sha256CryptOrder = [][3]int{
+	{0, 10, 20}, {21, 1, 11}, {12, 22, 2}, {3, 13, 23}, {24, 4, 14},
+	{15, 25, 5}, {6, 16, 26}, {27, 7, 17}, {18, 28, 8}, {9, 19, 29},
+}
+
+// cryptBase64 writes "n" characters of the 24 bits of the given bytes, least significant first.
+func cryptBase64(buf *bytes.Buffer, b2, b1, b0 byte, n int) {
+	w := uint(b2)<<16 | uint(b1)<<8 | uint(b0)
+	for ; n > 0; n-- {
+		buf.WriteByte(cryptBase64Alphabet[w&0x3f])
+		w >>= 6
+	}
+}
+
+// repeatBytes returns a sequence of "n" bytes of the repeated digest.
+func repeatBytes(digest []byte, n int) []byte {
+	seq := make([]byte, 0, n)
+	for len(seq) < n {
+		if rem := n - len(seq); rem < len(digest) {
+			seq = append(seq, digest[:rem]...)
+		} else {
+			seq = append(seq, digest...)
+		}
+	}
+
+	return seq
+}
+
+// AllowUsersShadowFile is an AuthFunc which authenticates user input based on
+// a colon-separated, /etc/shadow-like, file (user:hash:...) loaded on initialization.
+// Only the first two fields are parsed, the rest are ignored.
+// Empty lines, comments (#) and locked or password-less accounts
+// (the hash is empty or it starts with "!" or "*") are skipped.
+//
+// The hashes are compared with the SHACRYPT verifier,
+// more hash options (e.g. BCRYPT) passed through the "opts" input argument are composed with it.
+// A custom verifier (see WithVerifier) replaces it.
+//
+// Example Code:
+//
+//	New(Options{Allow: AllowUsersShadowFile("/etc/myapp/shadow")})
+func AllowUsersShadowFile(filename string, opts ...UserAuthOption) AuthFunc {
+	data, err := ReadFile(filename)
+	if err != nil {
+		panic(err)
+	}
+
+	users, err := parseShadow(data)
+	if err != nil {
+		panic(fmt.Sprintf("%s: %v", filename, err))
+	}
+
+	return userMap(users, append([]UserAuthOption{SHACRYPT}, opts...)...)
+}
+
+func parseShadow(data []byte) (map[string]string, error) {
+	users := make(map[string]string)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, shadowCommentPrefix) {
+			continue
+		}
+
+		fields := strings.SplitN(line, shadowFieldsSeparator, 3)
+		if len(fields) < 2 || fields[0] == "" {
+			return nil, fmt.Errorf("line %d: malformed entry", lineNum)
+		}
+
+		username, hash := fields[0], fields[1]
+		if hash == "" || hash[0] == '!' || hash[0] == '*' {
+			continue // locked or no password.
+		}
+
+		users[username] = hash
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
@@ -0,0 +1,136 @@
+package basicauth
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestShaCrypt(t *testing.T) {
+	// Test vectors of https://www.akkadia.org/drepper/SHA-crypt.txt, verified with openssl passwd.
+	var tests = []struct {
+		setting, password, expected string
+	}{
+		{"$5$saltstring", "Hello world!", "$5$saltstring$5B8vYYiY.CVt1RlTTf8KbXBH3hsxY/GNooZaBBGWEc5"},
+		{"$5$rounds=10000$saltstringsaltstring", "Hello world!", "$5$rounds=10000$saltstringsaltst$3xv.VbSHBb41AL9AvLeujZkZRBAwqFMz2.opqey6IcA"},
+		{"$6$saltstring", "Hello world!", "$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1"},
+		{"$6$rounds=10000$saltstringsaltstring", "Hello world!", "$6$rounds=10000$saltstringsaltst$OW1/O6BYHV6BcXZu8QVeXbDWra3Oeqh0sbHbbMCVNSnCM/UrjmM0Dp8vOuZeHBy/YTBmSK6H9qs/y3RnOaw5v."},
+	}
+
+	for i, tt := range tests {
+		got, err := shaCrypt(tt.setting, tt.password)
+		if err != nil {
+			t.Fatalf("[%d] %v", i, err)
+		}
+
+		if tt.expected != got {
+			t.Fatalf("[%d] expected: %q but got: %q", i, tt.expected, got)
+		}
+
+		if !verifyCrypt(tt.expected, tt.password) {
+			t.Fatalf("[%d] expected the password to be verified", i)
+		}
+	}
+
+	if !verifyCrypt(dummyCryptHash, dummyPassword) {
+		t.Fatalf("expected the dummy hash to be valid")
+	}
+}
+
+func TestAllowUsersShadowFile(t *testing.T) {
+	shadow := `# users
+kataras:$6$saltsalt$/N.GlpAavhe94JYxlSamUmddK4d5UWGjUjnHhTVHOxCRc8H.dft6PVgDrhiNjoWlw02aBlcv1ZNFHQauHPKny.:19000:0:99999:7:::
+makis:$5$saltsalt$7gcJqiTGoOo34.T3H/vhEbCi1xD1fOs0GXHW.qJWQ8D:19000:0:99999:7:::
+
+daemon:*:19000:0:99999:7:::
+locked:!$6$saltsalt$/N.GlpAavhe94JYxlSamUmddK4d5UWGjUjnHhTVHOxCRc8H.dft6PVgDrhiNjoWlw02aBlcv1ZNFHQauHPKny.:19000::::::
+`
+	filename := filepath.Join(t.TempDir(), "shadow")
+	if err := os.WriteFile(filename, []byte(shadow), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	allow := AllowUsersShadowFile(filename)
+
+	var tests = []struct {
+		username, password string
+		ok                 bool
+	}{
+		{"kataras", "kataras_pass", true},
+		{"makis", "makis_pass", true},
+		{"kataras", "makis_pass", false},
+		{"locked", "kataras_pass", false},
+		{"daemon", "*", false},
+		{"unknown", "kataras_pass", false},
+	}
+
+	for i, tt := range tests {
+		if _, ok := allow(nil, tt.username, tt.password); tt.ok != ok {
+			t.Fatalf("[%d] expected: %v but got: %v (username=%s,password=%s)", i, tt.ok, ok, tt.username, tt.password)
+		}
+	}
+}
+
+func TestSHACRYPT(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("bcrypt_pass"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users := map[string]string{
+		"kataras":   "$6$saltsalt$/N.GlpAavhe94JYxlSamUmddK4d5UWGjUjnHhTVHOxCRc8H.dft6PVgDrhiNjoWlw02aBlcv1ZNFHQauHPKny.",
+		"makis":     "$5$saltsalt$7gcJqiTGoOo34.T3H/vhEbCi1xD1fOs0GXHW.qJWQ8D",
+		"gerasimos": string(bcryptHash),
+		"argon2":    testArgon2Hash,
+	}
+
+	passwords := map[string]string{
+		"kataras":   "kataras_pass",
+		"makis":     "makis_pass",
+		"gerasimos": "bcrypt_pass",
+		"argon2":    "kataras_pass",
+	}
+
+	// The hashers are composed in any order, each hash is verified by its prefix.
+	for i, opts := range [][]UserAuthOption{
+		{SHACRYPT, BCRYPT, ARGON2},
+		{ARGON2ID, SHACRYPT, BCRYPT},
+		{BCRYPT, ARGON2, SHACRYPT},
+	} {
+		allow := AllowUsers(users, opts...)
+		for username, password := range passwords {
+			if _, ok := allow(nil, username, password); !ok {
+				t.Fatalf("[%d] expected %q to be allowed", i, username)
+			}
+
+			if _, ok := allow(nil, username, "invalid_pass"); ok {
+				t.Fatalf("[%d] expected %q with an invalid password to be rejected", i, username)
+			}
+
+			if _, ok := allow(nil, "unknown", password); ok {
+				t.Fatalf("[%d] expected an unknown username to be rejected", i)
+			}
+		}
+	}
+
+	// A hash of an unknown scheme (or a plain password) is rejected on load.
+	func() {
+		defer func() {
+			v := recover()
+			if v == nil || !strings.Contains(v.(string), `user "plain": unsupported password hash`) {
+				t.Fatalf("expected a panic of an unsupported hash but got: %v", v)
+			}
+		}()
+
+		AllowUsers(map[string]string{"kataras": users["kataras"], "plain": "plain_pass"}, SHACRYPT, BCRYPT)
+	}()
+
+	// A single hasher keeps comparing every stored password with it.
+	allow := AllowUsers(map[string]string{"makis": users["makis"]}, SHACRYPT)
+	if _, ok := allow(nil, "makis", "makis_pass"); !ok {
+		t.Fatalf("expected makis to be allowed")
+	}
+}
@@ -1,15 +1,64 @@
 package basicauth
 
 import (
+	"encoding/json"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 )
 
 type (
 	// ErrHTTPVersion is fired when Options.HTTPSOnly was enabled
 	// and the current request is a plain http one.
-	ErrHTTPVersion struct{}
+	ErrHTTPVersion struct {
+		// Code is the status code to send, see Options.HTTPSOnlyCode.
+		// Zero means 505 (StatusHTTPVersionNotSupported).
+		Code int
+	}
+
+	// ErrPreAuth is fired when the Options.PreAuth returned a non-nil error.
+	ErrPreAuth struct {
+		// Err is the error returned by the PreAuth.
+		Err error
+		// Code is the status code to send, see Options.PreAuthCode.
+		// Zero means 403 (StatusForbidden).
+		Code int
+	}
+
+	// ErrDisabled is fired when the middleware was disabled (see BasicAuth.Disable)
+	// and the Options.BlockWhenDisabled is true.
+	ErrDisabled struct{}
+
+	// ErrStoreUnavailable is fired when the Options.Store failed to store a new credential
+	// and the Options.StoreFailurePolicy is StoreFailClosed.
+	ErrStoreUnavailable struct {
+		Username string
+		// Err is the error returned by the CredentialStore.
+		Err error
+	}
+
+	// ErrHostNotAllowed is fired when Options.AllowedHosts was set
+	// and the request's Host is not part of it.
+	ErrHostNotAllowed struct {
+		Host string
+	}
+
+	// ErrOriginNotAllowed is fired when Options.AllowedOrigins was set
+	// and the Origin of a state-changing request is not part of it.
+	ErrOriginNotAllowed struct {
+		Origin string
+		// Code is the status code to send, see Options.OriginRejectCode.
+		// Zero means 403 (StatusForbidden).
+		Code int
+	}
+
+	// ErrCircuitOpen is fired when the Options.FailureCircuit is open
+	// and requests are rejected for at least "RetryAfter" time.
+	ErrCircuitOpen struct {
+		RetryAfter time.Duration
+	}
 
 	// ErrCredentialsForbidden is fired when Options.MaxTries have been consumed
 	// by the user and the client is forbidden to retry at least for "Age" time.
@@ -18,6 +67,24 @@ type (
 		Password string
 		Tries    int
 		Age      time.Duration
+		// Reason is the failure reason of the last try, if any, see ErrCredentialsInvalid.Reason.
+		Reason error
+	}
+
+	// ErrCredentialsLocked is fired when the client is locked out
+	// after a failure, see Options.LockoutBackoff,
+	// and it should retry after at least "RetryAfter" time.
+	ErrCredentialsLocked struct {
+		Username   string
+		Tries      int
+		RetryAfter time.Duration
+	}
+
+	// ErrTooManyRequests is fired when the Options.RateLimit was exceeded
+	// and the client should retry after at least "RetryAfter" time.
+	ErrTooManyRequests struct {
+		Username   string
+		RetryAfter time.Duration
 	}
 
 	// ErrCredentialsMissing is fired when the authorization header is empty or malformed.
@@ -26,7 +93,18 @@ type (
 
 		AuthenticateHeader      string
 		AuthenticateHeaderValue string
-		Code                    int
+		// AuthenticateHeaderValues holds all challenges,
+		// when Options.Realms is used. The first one is the AuthenticateHeaderValue.
+		AuthenticateHeaderValues []string
+		Code                     int
+	}
+
+	// ErrSessionLimit is fired when the user logs in with a new credential
+	// while it has already Options.MaxSessionsPerUser stored credentials
+	// and the Options.EvictOldestSession is false.
+	ErrSessionLimit struct {
+		Username string
+		Max      int
 	}
 
 	// ErrCredentialsInvalid is fired when the user input does not match with an existing user.
@@ -34,10 +112,57 @@ type (
 		Username     string
 		Password     string
 		CurrentTries int
+		// Reason is the failure reason, if the Options.Allow reported one
+		// by returning an error value as the user, e.g. ErrUserNotFound or ErrPasswordMismatch.
+		// It is never sent to the client by the DefaultErrorHandler,
+		// custom error handlers can use it (through errors.As) to render different messages.
+		Reason error
+
+		AuthenticateHeader      string
+		AuthenticateHeaderValue string
+		// AuthenticateHeaderValues holds all challenges,
+		// when Options.Realms is used. The first one is the AuthenticateHeaderValue.
+		AuthenticateHeaderValues []string
+		Code                     int
+	}
+
+	// ErrCredentialsRotated is fired when a stored username:password combination
+	// was invalidated (see BasicAuth.Invalidate) or it is no longer allowed,
+	// e.g. the shared password was rotated. The DefaultErrorHandler re-asks for credentials,
+	// custom error handlers can tell the client to fetch the new credentials.
+	ErrCredentialsRotated struct {
+		Username string
+		Password string
 
 		AuthenticateHeader      string
 		AuthenticateHeaderValue string
-		Code                    int
+		// AuthenticateHeaderValues holds all challenges,
+		// when Options.Realms is used. The first one is the AuthenticateHeaderValue.
+		AuthenticateHeaderValues []string
+		Code                     int
+	}
+
+	// ErrUserNotFound is reported by the AllowUsers as the failure reason,
+	// see ErrCredentialsInvalid.Reason, when the username does not exist.
+	ErrUserNotFound struct {
+		Username string
+	}
+
+	// ErrPasswordMismatch is reported by the AllowUsers as the failure reason,
+	// see ErrCredentialsInvalid.Reason, when the username exists but the password does not match.
+	ErrPasswordMismatch struct {
+		Username string
+		// User is the stored user value, if any.
+		User interface{}
+	}
+
+	// ErrPasswordCompromised is reported by the AllowUsers as the failure reason,
+	// see ErrCredentialsInvalid.Reason, when the password matches
+	// but it is known to be compromised, see WithCompromisedCheck.
+	ErrPasswordCompromised struct {
+		Username string
+		// User is the stored user value, if any.
+		User interface{}
 	}
 
 	// ErrCredentialsExpired is fired when the username:password combination is valid
@@ -48,7 +173,10 @@ type (
 
 		AuthenticateHeader      string
 		AuthenticateHeaderValue string
-		Code                    int
+		// AuthenticateHeaderValues holds all challenges,
+		// when Options.Realms is used. The first one is the AuthenticateHeaderValue.
+		AuthenticateHeaderValues []string
+		Code                     int
 	}
 )
 
@@ -56,10 +184,61 @@ func (e ErrHTTPVersion) Error() string {
 	return "http version not supported"
 }
 
+func (e ErrPreAuth) Error() string {
+	return fmt.Sprintf("pre-auth: %v", e.Err)
+}
+
+// Unwrap returns the error of the PreAuth.
+func (e ErrPreAuth) Unwrap() error {
+	return e.Err
+}
+
+func (e ErrDisabled) Error() string {
+	return "authentication disabled"
+}
+
+func (e ErrStoreUnavailable) Error() string {
+	return fmt.Sprintf("store: unavailable for <%s>: %v", e.Username, e.Err)
+}
+
+// Unwrap returns the error of the CredentialStore.
+func (e ErrStoreUnavailable) Unwrap() error {
+	return e.Err
+}
+
+func (e ErrHostNotAllowed) Error() string {
+	return fmt.Sprintf("host: <%s> not allowed", e.Host)
+}
+
+func (e ErrOriginNotAllowed) Error() string {
+	return fmt.Sprintf("origin: <%s> not allowed", e.Origin)
+}
+
+func (e ErrCircuitOpen) Error() string {
+	return fmt.Sprintf("circuit: open, retry after <%s>", e.RetryAfter)
+}
+
 func (e ErrCredentialsForbidden) Error() string {
 	return fmt.Sprintf("credentials: forbidden <%s:%s> for <%s> after <%d> attempts", e.Username, e.Password, e.Age, e.Tries)
 }
 
+// Unwrap returns the failure reason of the last try, if any.
+func (e ErrCredentialsForbidden) Unwrap() error {
+	return e.Reason
+}
+
+func (e ErrCredentialsLocked) Error() string {
+	return fmt.Sprintf("credentials: locked <%s> for <%s> after <%d> attempts", e.Username, e.RetryAfter, e.Tries)
+}
+
+func (e ErrTooManyRequests) Error() string {
+	return fmt.Sprintf("rate limit: exceeded for <%s>, retry after <%s>", e.Username, e.RetryAfter)
+}
+
+func (e ErrSessionLimit) Error() string {
+	return fmt.Sprintf("credentials: <%s> reached the limit of <%d> sessions", e.Username, e.Max)
+}
+
 func (e ErrCredentialsMissing) Error() string {
 	if e.Header != "" {
 		return fmt.Sprintf("credentials: malformed <%s>", e.Header)
@@ -72,35 +251,195 @@ func (e ErrCredentialsInvalid) Error() string {
 	return fmt.Sprintf("credentials: invalid <%s:%s> current tries <%d>", e.Username, e.Password, e.CurrentTries)
 }
 
+// Unwrap returns the failure reason, if any.
+func (e ErrCredentialsInvalid) Unwrap() error {
+	return e.Reason
+}
+
+func (e ErrCredentialsRotated) Error() string {
+	return fmt.Sprintf("credentials: rotated <%s:%s>", e.Username, e.Password)
+}
+
+func (e ErrUserNotFound) Error() string {
+	return fmt.Sprintf("user: <%s> not found", e.Username)
+}
+
+func (e ErrPasswordMismatch) Error() string {
+	return fmt.Sprintf("user: <%s> password mismatch", e.Username)
+}
+
+func (e ErrPasswordCompromised) Error() string {
+	return fmt.Sprintf("user: <%s> password compromised", e.Username)
+}
+
 func (e ErrCredentialsExpired) Error() string {
 	return fmt.Sprintf("credentials: expired <%s:%s>", e.Username, e.Password)
 }
 
 // DefaultErrorHandler is the default error handler for the Options.ErrorHandler field.
 func DefaultErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	code := errorStatus(w, err)
+	if code == 0 {
+		// This will never happen.
+		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return
+	}
+
+	http.Error(w, http.StatusText(code), code)
+}
+
+// JSONErrorHandler is an alternative error handler for the Options.ErrorHandler field,
+// useful for single page applications and API clients.
+// It sets the same status code and headers (e.g. the WWW-Authenticate challenge)
+// as the DefaultErrorHandler but it writes a JSON body instead of a plain text one,
+// e.g. {"error":"credentials invalid","code":401}.
+// The password is never part of the body.
+//
+// Usage:
+//
+//	Options.ErrorHandler = basicauth.JSONErrorHandler
+func JSONErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	code := errorStatus(w, err)
+	if code == 0 {
+		code = http.StatusInternalServerError
+	}
+
+	body, _ := json.Marshal(jsonError{Error: errorMessage(err), Code: code})
+
+	h := w.Header()
+	h.Set("Content-Type", "application/json; charset=utf-8")
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	w.Write(body)
+}
+
+// jsonError is the response body of the JSONErrorHandler.
+type jsonError struct {
+	Error string `json:"error"`
+	Code  int    `json:"code"`
+}
+
+// errorStatus sets the response headers of the given error, e.g. the challenge,
+// and returns its status code. It returns zero on an unknown error.
+func errorStatus(w http.ResponseWriter, err error) int {
 	switch e := err.(type) {
 	case ErrHTTPVersion:
-		http.Error(w, http.StatusText(http.StatusHTTPVersionNotSupported), http.StatusHTTPVersionNotSupported)
+		code := e.Code
+		switch code {
+		case 0:
+			code = http.StatusHTTPVersionNotSupported
+		case http.StatusUpgradeRequired:
+			w.Header().Set("Upgrade", "TLS/1.2, HTTP/1.1")
+			w.Header().Set("Connection", "Upgrade")
+		}
+
+		return code
+	case ErrPreAuth:
+		if e.Code == 0 {
+			return http.StatusForbidden
+		}
+
+		return e.Code
+	case ErrDisabled:
+		return http.StatusServiceUnavailable
+	case ErrStoreUnavailable:
+		return http.StatusServiceUnavailable
+	case ErrHostNotAllowed:
+		return http.StatusBadRequest
+	case ErrOriginNotAllowed:
+		if e.Code == 0 {
+			return http.StatusForbidden
+		}
+
+		return e.Code
+	case ErrCircuitOpen:
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(e.RetryAfter.Seconds()))))
+		return http.StatusServiceUnavailable
 	case ErrCredentialsForbidden:
 		// If a (proxy) server receives valid credentials that are inadequate to access a given resource,
 		// the server should respond with the 403 Forbidden status code.
 		// Unlike 401 Unauthorized or 407 Proxy Authentication Required, authentication is impossible for this user.
-		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return http.StatusForbidden
+	case ErrCredentialsLocked:
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(e.RetryAfter.Seconds()))))
+		return http.StatusTooManyRequests
+	case ErrTooManyRequests:
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(e.RetryAfter.Seconds()))))
+		return http.StatusTooManyRequests
+	case ErrSessionLimit:
+		return http.StatusForbidden
 	case ErrCredentialsMissing:
-		unauthorize(w, e.AuthenticateHeader, e.AuthenticateHeaderValue, e.Code)
+		return unauthorize(w, e.AuthenticateHeader, headerValues(e.AuthenticateHeaderValue, e.AuthenticateHeaderValues), e.Code)
 	case ErrCredentialsInvalid:
-		unauthorize(w, e.AuthenticateHeader, e.AuthenticateHeaderValue, e.Code)
+		return unauthorize(w, e.AuthenticateHeader, headerValues(e.AuthenticateHeaderValue, e.AuthenticateHeaderValues), e.Code)
 	case ErrCredentialsExpired:
-		unauthorize(w, e.AuthenticateHeader, e.AuthenticateHeaderValue, e.Code)
+		return unauthorize(w, e.AuthenticateHeader, headerValues(e.AuthenticateHeaderValue, e.AuthenticateHeaderValues), e.Code)
+	case ErrCredentialsRotated:
+		return unauthorize(w, e.AuthenticateHeader, headerValues(e.AuthenticateHeaderValue, e.AuthenticateHeaderValues), e.Code)
 	default:
-		// This will never happen.
-		http.Error(w, "unknown error", http.StatusInternalServerError)
+		return 0
 	}
 }
 
-// unauthorize sends a 401 status code (or 407 if Proxy was set to true)
-// which client should catch and prompt for username:password credentials.
-func unauthorize(w http.ResponseWriter, authHeader, authHeaderValue string, code int) {
-	w.Header().Set(authHeader, authHeaderValue)
-	http.Error(w, http.StatusText(code), code)
+// errorMessage returns a short description of the given error which is safe to send to the client,
+// unlike the Error methods it does not include the credentials.
+func errorMessage(err error) string {
+	switch err.(type) {
+	case ErrHTTPVersion:
+		return "http version not supported"
+	case ErrPreAuth:
+		return "pre-auth failed"
+	case ErrDisabled:
+		return "authentication disabled"
+	case ErrStoreUnavailable:
+		return "store unavailable"
+	case ErrHostNotAllowed:
+		return "host not allowed"
+	case ErrOriginNotAllowed:
+		return "origin not allowed"
+	case ErrCircuitOpen:
+		return "too many failures"
+	case ErrCredentialsForbidden:
+		return "credentials forbidden"
+	case ErrCredentialsLocked:
+		return "credentials locked"
+	case ErrTooManyRequests:
+		return "too many requests"
+	case ErrSessionLimit:
+		return "session limit reached"
+	case ErrCredentialsMissing:
+		return "credentials missing"
+	case ErrCredentialsInvalid:
+		return "credentials invalid"
+	case ErrCredentialsExpired:
+		return "credentials expired"
+	case ErrCredentialsRotated:
+		return "credentials rotated"
+	default:
+		return "unknown error"
+	}
+}
+
+// unauthorize sets the challenge header of a 401 status code (or 407 if Proxy was set to true)
+// which client should catch and prompt for username:password credentials, and returns that code.
+// Each header value is sent as a separate challenge, empty values are skipped
+// (see Options.ChallengeFor).
+func unauthorize(w http.ResponseWriter, authHeader string, authHeaderValues []string, code int) int {
+	w.Header().Del(authHeader)
+	for _, authHeaderValue := range authHeaderValues {
+		if authHeaderValue != "" {
+			w.Header().Add(authHeader, authHeaderValue)
+		}
+	}
+
+	return code
+}
+
+// headerValues returns the values if not empty, otherwise the single value.
+func headerValues(value string, values []string) []string {
+	if len(values) > 0 {
+		return values
+	}
+
+	return []string{value}
 }
@@ -0,0 +1,34 @@
+package basicauth
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestJSONErrorHandler(t *testing.T) {
+	auth := New(Options{
+		Allow:        AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		Realm:        DefaultRealm,
+		MaxTries:     2,
+		ErrorHandler: JSONErrorHandler,
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	testHandler(t, handler, http.MethodGet, "/").
+		statusCode(http.StatusUnauthorized).
+		headerEq("WWW-Authenticate", `Basic realm="Authorization Required"`).
+		jsonEq(jsonError{Error: "credentials missing", Code: http.StatusUnauthorized})
+
+	te := testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "invalid_pass")).
+		statusCode(http.StatusUnauthorized).
+		headerEq("WWW-Authenticate", `Basic realm="Authorization Required"`).
+		jsonEq(jsonError{Error: "credentials invalid", Code: http.StatusUnauthorized})
+
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "invalid_pass"), withCookie(te.cookie(DefaultMaxTriesCookie))).
+		statusCode(http.StatusForbidden).
+		headerEq("WWW-Authenticate", "").
+		jsonEq(jsonError{Error: "credentials forbidden", Code: http.StatusForbidden})
+
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).
+		statusCode(http.StatusOK)
+}
@@ -0,0 +1,119 @@
+package basicauth
+
+import (
+	"net/http"
+	"time"
+)
+
+// DefaultEventsBuffer is the capacity of the channel returned by the BasicAuth.Events method.
+const DefaultEventsBuffer = 64
+
+// EventType is the type of an AuthEvent.
+type EventType uint8
+
+const (
+	// EventSuccess is fired when a request was allowed.
+	EventSuccess EventType = iota + 1
+	// EventFailure is fired when a request was rejected, see AuthEvent.Err.
+	EventFailure
+	// EventLogout is fired when a user was logged out.
+	EventLogout
+)
+
+// String returns the text representation of the event type.
+func (t EventType) String() string {
+	switch t {
+	case EventSuccess:
+		return "success"
+	case EventFailure:
+		return "failure"
+	case EventLogout:
+		return "logout"
+	default:
+		return "unknown"
+	}
+}
+
+// AuthEvent describes an authentication event,
+// see the BasicAuth.Events method.
+type AuthEvent struct {
+	Type       EventType
+	Time       time.Time
+	Username   string
+	RemoteAddr string
+	// ClientIP is the client IP of the request, see Options.ClientIP.
+	ClientIP string
+	// Err is the failure reason, on EventFailure.
+	Err error
+	// CorrelationID is the value of the Options.CorrelationHeader, if any.
+	CorrelationID string
+}
+
+// Events returns a channel which streams the success, failure and logout events.
+// It lets external code subscribe to the authentication events without polling.
+//
+// The channel is bounded to DefaultEventsBuffer events and the sends are non-blocking:
+// if the channel is full (e.g. nobody reads from it) then the new events are dropped,
+// so a slow subscriber never blocks the requests.
+// All callers share the same channel, which is created on the first call:
+// no events are recorded before that.
+func (b *BasicAuth) Events() <-chan AuthEvent {
+	if ch := b.events.Load(); ch != nil {
+		return *ch
+	}
+
+	ch := make(chan AuthEvent, DefaultEventsBuffer)
+	if !b.events.CompareAndSwap(nil, &ch) {
+		return *b.events.Load()
+	}
+
+	return ch
+}
+
+// emit sends an event without blocking, it is dropped if the events channel is full
+// or if nobody subscribed through the Events method.
+func (b *BasicAuth) emit(r *http.Request, typ EventType, username string, err error) {
+	events := b.events.Load()
+	if events == nil {
+		return
+	}
+
+	ev := AuthEvent{
+		Type:          typ,
+		Time:          time.Now(),
+		Username:      username,
+		RemoteAddr:    r.RemoteAddr,
+		ClientIP:      b.clientIP(r),
+		Err:           err,
+		CorrelationID: b.correlationID(r),
+	}
+
+	select {
+	case *events <- ev:
+	default:
+	}
+}
+
+// errorUsername returns the username of the given credentials error, if any.
+func errorUsername(err error) string {
+	switch e := err.(type) {
+	case ErrCredentialsForbidden:
+		return e.Username
+	case ErrCredentialsInvalid:
+		return e.Username
+	case ErrCredentialsExpired:
+		return e.Username
+	case ErrCredentialsRotated:
+		return e.Username
+	case ErrStoreUnavailable:
+		return e.Username
+	case ErrSessionLimit:
+		return e.Username
+	case ErrCredentialsLocked:
+		return e.Username
+	case ErrTooManyRequests:
+		return e.Username
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,93 @@
+package basicauth
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestEvents(t *testing.T) {
+	b, auth := NewBasicAuth(Options{
+		Allow: AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/logout" {
+			Logout(r)
+		}
+	}))
+
+	// No events are recorded before the first subscription.
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).statusCode(http.StatusOK)
+	events := b.Events()
+	if got := len(events); got != 0 {
+		t.Fatalf("expected no events before Events call but got: %d", got)
+	}
+
+	if b.Events() != events {
+		t.Fatalf("expected the same events channel")
+	}
+
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).statusCode(http.StatusOK)
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "invalid_pass")).statusCode(http.StatusUnauthorized)
+	testHandler(t, handler, http.MethodGet, "/logout", withBasicAuth("kataras", "kataras_pass")).statusCode(http.StatusOK)
+
+	expected := []EventType{EventSuccess, EventFailure, EventSuccess, EventLogout}
+	for i, typ := range expected {
+		ev := <-events
+		if ev.Type != typ {
+			t.Fatalf("[%d] expected event: %s but got: %s", i, typ, ev.Type)
+		}
+
+		if ev.Username != "kataras" {
+			t.Fatalf("[%d] expected username: kataras but got: %q", i, ev.Username)
+		}
+
+		if (ev.Err != nil) != (typ == EventFailure) {
+			t.Fatalf("[%d] unexpected event error: %v", i, ev.Err)
+		}
+	}
+
+	// Events are dropped when the channel is full, the requests never block.
+	for i := 0; i < DefaultEventsBuffer+10; i++ {
+		testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).statusCode(http.StatusOK)
+	}
+
+	if expected, got := DefaultEventsBuffer, len(events); expected != got {
+		t.Fatalf("expected %d buffered events but got: %d", expected, got)
+	}
+}
+
+func TestOnSuccessOnFailure(t *testing.T) {
+	var (
+		successes []string
+		failures  []string
+	)
+
+	auth := New(Options{
+		Allow:    AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		MaxTries: 2,
+		OnSuccess: func(r *http.Request, user interface{}) {
+			if GetUser(r) != user {
+				t.Fatalf("expected the user to be set to the request")
+			}
+			successes = append(successes, user.(*SimpleUser).Username)
+		},
+		OnFailure: func(r *http.Request, username string, err error) {
+			failures = append(failures, fmt.Sprintf("%s %T", username, err))
+		},
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).statusCode(http.StatusOK)
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "invalid_pass")).statusCode(http.StatusUnauthorized)
+	testHandler(t, handler, http.MethodGet, "/").statusCode(http.StatusUnauthorized)
+
+	if expected, got := []string{"kataras"}, successes; !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected successes: %v but got: %v", expected, got)
+	}
+
+	if expected, got := []string{"kataras basicauth.ErrCredentialsInvalid", " basicauth.ErrCredentialsMissing"}, failures; !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected failures: %v but got: %v", expected, got)
+	}
+}
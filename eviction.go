@@ -0,0 +1,116 @@
+package basicauth
+
+import (
+	"container/list"
+	"net/http"
+)
+
+// EvictionPolicy is the policy of the stored credentials
+// when their number reaches the Options.MaxEntries.
+// See the Options.EvictionPolicy field.
+type EvictionPolicy uint8
+
+const (
+	// EvictionNone does not evict any credential, the new ones are not stored
+	// until there is room again (e.g. after a logout, an expiration or a GC cycle).
+	// Their requests are still authenticated, through the Options.Allow each time.
+	EvictionNone EvictionPolicy = iota
+	// EvictionFIFO evicts the first stored credential (the oldest login).
+	EvictionFIFO
+	// EvictionLRU evicts the least recently used credential,
+	// so the hot credentials stay resident and the cold ones are evicted.
+	EvictionLRU
+)
+
+// String returns the text representation of the eviction policy.
+func (p EvictionPolicy) String() string {
+	switch p {
+	case EvictionNone:
+		return "none"
+	case EvictionFIFO:
+		return "fifo"
+	case EvictionLRU:
+		return "lru"
+	default:
+		return "unknown"
+	}
+}
+
+// putCredentialLocked stores the given credential, evicting another one if
+// the Options.MaxEntries was reached, and reports whether it was stored.
+// It returns the key of the evicted credential, if any,
+// so the caller can remove it from the Options.Store too (see deleteCredential).
+// The caller should hold the write lock.
+func (b *BasicAuth) putCredentialLocked(fullUser string, c *credential) (evicted string, stored bool) {
+	if b.order == nil { // Unbounded.
+		b.credentials[fullUser] = c
+		return "", true
+	}
+
+	if old, ok := b.credentials[fullUser]; ok {
+		b.order.Remove(old.elem)
+	} else if len(b.credentials) >= b.opts.MaxEntries {
+		if b.opts.EvictionPolicy == EvictionNone {
+			return "", false
+		}
+
+		// The back is the first stored (FIFO) or the least recently used (LRU) one.
+		evicted = b.order.Back().Value.(string)
+		b.removeCredentialLocked(evicted)
+	}
+
+	c.elem = b.order.PushFront(fullUser)
+	b.credentials[fullUser] = c
+	return evicted, true
+}
+
+// logNotStored logs that the credential of the given username was not stored
+// because the Options.MaxEntries was reached, see EvictionNone.
+func (b *BasicAuth) logNotStored(r *http.Request, username string) {
+	if b.opts.ErrorLogger == nil {
+		return
+	}
+
+	if id := b.correlationID(r); id != "" {
+		b.opts.ErrorLogger.Printf("[%s] credentials: <%s> not stored: MaxEntries (%d) reached", id, username, b.opts.MaxEntries)
+	} else {
+		b.opts.ErrorLogger.Printf("credentials: <%s> not stored: MaxEntries (%d) reached", username, b.opts.MaxEntries)
+	}
+}
+
+// removeCredentialLocked removes the stored credential of the given key, if any.
+// The caller should hold the write lock.
+func (b *BasicAuth) removeCredentialLocked(fullUser string) {
+	c, ok := b.credentials[fullUser]
+	if !ok {
+		return
+	}
+
+	if c.elem != nil {
+		b.order.Remove(c.elem)
+		c.elem = nil
+	}
+	delete(b.credentials, fullUser)
+}
+
+// touchCredential marks the given stored credential as the most recently used one,
+// when the Options.EvictionPolicy is EvictionLRU.
+func (b *BasicAuth) touchCredential(c *credential) {
+	if b.opts.MaxEntries <= 0 || b.opts.EvictionPolicy != EvictionLRU {
+		return
+	}
+
+	b.mu.Lock()
+	if c.elem != nil { // Not removed in the meantime (a stale element of a Reset is ignored by the list).
+		b.order.MoveToFront(c.elem)
+	}
+	b.mu.Unlock()
+}
+
+func newEvictionList(opts Options) *list.List {
+	if opts.MaxEntries <= 0 {
+		return nil
+	}
+
+	return list.New()
+}
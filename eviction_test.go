@@ -0,0 +1,143 @@
+package basicauth
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"testing"
+)
+
+func TestEvictionPolicy(t *testing.T) {
+	users := map[string]string{"a": "a_pass", "b": "b_pass", "c": "c_pass"}
+
+	var tests = []struct {
+		policy EvictionPolicy
+		// the stored usernames after: a, b, a (again), c.
+		expected []string
+	}{
+		{EvictionLRU, []string{"a", "c"}},  // b is the least recently used.
+		{EvictionFIFO, []string{"b", "c"}}, // a is the first stored.
+		{EvictionNone, []string{"a", "b"}}, // c is not stored.
+	}
+
+	for _, tt := range tests {
+		b, auth := NewBasicAuth(Options{
+			Allow:          AllowUsers(users),
+			MaxEntries:     2,
+			EvictionPolicy: tt.policy,
+		})
+		handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+		for _, username := range []string{"a", "b", "a", "c"} {
+			testHandler(t, handler, http.MethodGet, "/", withBasicAuth(username, users[username])).
+				statusCode(http.StatusOK)
+		}
+
+		if expected, got := len(tt.expected), b.Len(); expected != got {
+			t.Fatalf("[%s] expected %d stored credentials but got: %d", tt.policy, expected, got)
+		}
+
+		for _, username := range tt.expected {
+			if len(b.SessionInfo(username)) != 1 {
+				t.Fatalf("[%s] expected %q to be stored", tt.policy, username)
+			}
+		}
+	}
+}
+
+func TestEvictionLRUOrder(t *testing.T) {
+	users := map[string]string{"a": "a_pass", "b": "b_pass", "c": "c_pass", "d": "d_pass"}
+
+	b, auth := NewBasicAuth(Options{
+		Allow:          AllowUsers(users),
+		MaxEntries:     3,
+		EvictionPolicy: EvictionLRU,
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/logout" {
+			Logout(r)
+		}
+	}))
+
+	login := func(username string) {
+		t.Helper()
+		testHandler(t, handler, http.MethodGet, "/", withBasicAuth(username, users[username])).
+			statusCode(http.StatusOK)
+	}
+
+	stored := func(expected ...string) {
+		t.Helper()
+		if b.Len() != len(expected) {
+			t.Fatalf("expected %d stored credentials but got: %d", len(expected), b.Len())
+		}
+
+		for _, username := range expected {
+			if len(b.SessionInfo(username)) != 1 {
+				t.Fatalf("expected %q to be stored", username)
+			}
+		}
+	}
+
+	login("a")
+	login("b")
+	login("c")
+	login("a") // the order is now: a, c, b.
+	login("d") // evicts b.
+	stored("a", "c", "d")
+
+	login("c") // the order is now: c, d, a.
+	login("b") // evicts a.
+	stored("b", "c", "d")
+
+	// A logout makes room without eviction.
+	testHandler(t, handler, http.MethodGet, "/logout", withBasicAuth("d", users["d"])).statusCode(http.StatusOK)
+	login("a")
+	stored("a", "b", "c")
+
+	b.Reset()
+	stored()
+	login("a")
+	login("b")
+	login("c")
+	login("d") // evicts a.
+	stored("b", "c", "d")
+}
+
+func TestEvictionStore(t *testing.T) {
+	users := map[string]string{"a": "a_pass", "b": "b_pass", "c": "c_pass"}
+
+	for _, policy := range []EvictionPolicy{EvictionFIFO, EvictionNone} {
+		buf := new(bytes.Buffer)
+		store := newTestStore(nil)
+		_, auth := NewBasicAuth(Options{
+			Allow:          AllowUsers(users),
+			MaxEntries:     2,
+			EvictionPolicy: policy,
+			Store:          store,
+			ErrorLogger:    log.New(buf, "", 0),
+		})
+		handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+		for _, username := range []string{"a", "b", "c"} {
+			testHandler(t, handler, http.MethodGet, "/", withBasicAuth(username, users[username])).
+				statusCode(http.StatusOK)
+		}
+
+		// The cap bounds the store too.
+		if expected, got := 2, store.Len(); expected != got {
+			t.Fatalf("[%s] expected %d credentials in the store but got: %d", policy, expected, got)
+		}
+
+		evicted := "a"
+		if policy == EvictionNone {
+			evicted = "c"
+			if expected, got := "credentials: <c> not stored: MaxEntries (2) reached\n", buf.String(); expected != got {
+				t.Fatalf("[%s] expected log: %q but got: %q", policy, expected, got)
+			}
+		}
+
+		if _, ok := store.Get(fullUserKey(evicted, users[evicted])); ok {
+			t.Fatalf("[%s] expected %q to be removed from the store", policy, evicted)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package basicauth
+
+import (
+	"context"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// DefaultExecTimeout is the maximum duration
+// an external program of AllowExec is allowed to run.
+const DefaultExecTimeout = 5 * time.Second
+
+// AllowExec is an AuthFunc which delegates the authentication
+// to an external program, like the checkpassword-style helpers.
+// The "argv" input argument is the program's name and its arguments.
+//
+// The username and the password are passed through the standard input
+// (never through the arguments), each one followed by a new line.
+// Credentials which contain control characters (e.g. a new line which would shift the fields)
+// are rejected without running the program.
+// An exit code of 0 means success, anything else (or a timeout of DefaultExecTimeout) is a failure.
+// The program's output is ignored and the password is never logged.
+//
+// Usage:
+//
+//	New(Options{Allow: AllowExec([]string{"/usr/local/bin/checkpassword"})})
+func AllowExec(argv []string) AuthFunc {
+	if len(argv) == 0 {
+		panic("AllowExec: program name is required")
+	}
+
+	return func(r *http.Request, username, password string) (interface{}, bool) {
+		if hasControlChar(username) || hasControlChar(password) {
+			return nil, false
+		}
+
+		ctx := context.Background()
+		if r != nil {
+			ctx = r.Context()
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, DefaultExecTimeout)
+		defer cancel()
+
+		cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+		cmd.Stdin = strings.NewReader(username + "\n" + password + "\n")
+
+		return nil, cmd.Run() == nil
+	}
+}
+
+// hasControlChar reports whether the given string contains an ASCII control character.
+func hasControlChar(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 || c == 0x7f {
+			return true
+		}
+	}
+
+	return false
+}
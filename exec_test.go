@@ -0,0 +1,55 @@
+package basicauth
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestAllowExec(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a posix shell")
+	}
+
+	dir, err := ioutil.TempDir("", "checkpassword")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	script := filepath.Join(dir, "checkpassword.sh")
+	contents := `#!/bin/sh
+read username
+read password
+[ "$username" = "kataras" ] && [ "$password" = "kataras_pass" ]
+`
+	if err = ioutil.WriteFile(script, []byte(contents), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	allow := AllowExec([]string{script})
+
+	var tests = []struct {
+		username, password string
+		ok                 bool
+	}{
+		{"kataras", "kataras_pass", true},
+		{"kataras", "invalid_pass", false},
+		{"makis", "kataras_pass", false},
+		// A new line would shift the fields.
+		{"kataras\nkataras_pass", "invalid_pass", false},
+		{"kataras", "kataras_pass\x00", false},
+	}
+
+	for i, tt := range tests {
+		if _, ok := allow(nil, tt.username, tt.password); tt.ok != ok {
+			t.Fatalf("[%d] expected: %v but got: %v (username=%s,password=%s)", i, tt.ok, ok, tt.username, tt.password)
+		}
+	}
+
+	if _, ok := AllowExec([]string{filepath.Join(dir, "missing")})(nil, "kataras", "kataras_pass"); ok {
+		t.Fatalf("expected a missing program to fail")
+	}
+}
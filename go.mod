@@ -4,5 +4,8 @@ go 1.23.2
 
 require (
 	golang.org/x/crypto v0.28.0
+	golang.org/x/text v0.19.0
 	gopkg.in/yaml.v3 v3.0.1
 )
+
+require golang.org/x/sys v0.26.0 // indirect
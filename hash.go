@@ -0,0 +1,98 @@
+package basicauth
+
+import (
+	"fmt"
+	"strings"
+)
+
+// hashScheme is a password hash scheme of a UserAuthOption, e.g. BCRYPT,
+// detected by the prefix of the stored hash.
+// See the withScheme function.
+type hashScheme struct {
+	prefixes []string
+	verify   func(stored, userPassword string) bool
+	validate func(stored string) error // optional.
+	dummy    string
+}
+
+func (s hashScheme) match(stored string) bool {
+	for _, prefix := range s.prefixes {
+		if strings.HasPrefix(stored, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hashSchemes is the list of the hash schemes of a UserAuthOptions.
+type hashSchemes []hashScheme
+
+// find returns the hash scheme of the given stored hash.
+func (l hashSchemes) find(stored string) (hashScheme, bool) {
+	for _, s := range l {
+		if s.match(stored) {
+			return s, true
+		}
+	}
+
+	return hashScheme{}, false
+}
+
+func (l hashSchemes) compare(stored, userPassword string) bool {
+	s, ok := l.find(stored)
+	return ok && s.verify(stored, userPassword)
+}
+
+func (l hashSchemes) validate(stored string) error {
+	s, ok := l.find(stored)
+	if !ok {
+		var prefixes []string
+		for _, s := range l {
+			prefixes = append(prefixes, s.prefixes...)
+		}
+
+		return fmt.Errorf("unsupported password hash, expected one of the prefixes: %s", strings.Join(prefixes, ", "))
+	}
+
+	if s.validate == nil {
+		return nil
+	}
+
+	return s.validate(stored)
+}
+
+// withScheme returns a UserAuthOption which adds the given hash scheme.
+// A single scheme verifies all the stored passwords, as before,
+// more schemes (e.g. BCRYPT and SHACRYPT) are composed:
+// each stored hash is verified, and validated at load time,
+// by the scheme of its prefix and a stored password of an unknown prefix is rejected.
+// A scheme of the same (first) prefix replaces the previous one, e.g. ARGON2ID after ARGON2.
+func withScheme(scheme hashScheme) UserAuthOption {
+	return func(opts *UserAuthOptions) {
+		replaced := false
+		for i, s := range opts.schemes {
+			if s.prefixes[0] == scheme.prefixes[0] {
+				opts.schemes[i] = scheme
+				replaced = true
+				break
+			}
+		}
+
+		if !replaced {
+			opts.schemes = append(opts.schemes, scheme)
+		}
+
+		if len(opts.schemes) == 1 {
+			opts.ComparePassword = scheme.verify
+			opts.ValidateHash = scheme.validate
+		} else {
+			schemes := append(hashSchemes(nil), opts.schemes...)
+			opts.ComparePassword = schemes.compare
+			opts.ValidateHash = schemes.validate
+		}
+
+		// The first one, the unknown usernames are compared against it.
+		opts.DummyPassword = opts.schemes[0].dummy
+	}
+}
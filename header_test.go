@@ -76,7 +76,7 @@ func TestHeaderDecode(t *testing.T) {
 	}
 
 	for i, tt := range tests {
-		fullUser, username, password, ok := decodeHeader(tt.header)
+		username, password, ok := decodeHeader(tt.header, colonChar)
 		if expected, got := tt.ok, ok; expected != got {
 			t.Fatalf("[%d] expected: %v but got: %v (header=%s)", i, expected, got, tt.header)
 		}
@@ -88,16 +88,21 @@ func TestHeaderDecode(t *testing.T) {
 		if expected, got := tt.password, password; expected != got {
 			t.Fatalf("[%d] expected password: %q but got: %q", i, expected, got)
 		}
+	}
+}
 
-		if tt.username != "" || tt.password != "" {
-			if expected, got := tt.username+colonLiteral+tt.password, fullUser; expected != got {
-				t.Fatalf("[%d] expected username:password to be: %q but got: %q", i, expected, got)
-			}
-		} else {
-			if fullUser != "" {
-				t.Fatalf("[%d] expected username:password to be empty but got: %q", i, fullUser)
-			}
-		}
+func TestHeaderDecodeSeparator(t *testing.T) {
+	// base64 of "user|pa:ss".
+	username, password, ok := decodeHeader("Basic dXNlcnxwYTpzcw==", '|')
+	if !ok {
+		t.Fatalf("expected the header to be decoded")
+	}
+
+	if username != "user" || password != "pa:ss" {
+		t.Fatalf("unexpected decoded credentials: %q, %q", username, password)
+	}
 
+	if _, _, ok = decodeHeader("Basic dXNlcjpwYXNz", '|'); ok {
+		t.Fatalf("expected a colon separated header to fail on a custom separator")
 	}
 }
@@ -0,0 +1,125 @@
+package basicauth
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// parseIP parses the host part of the given address,
+// e.g. the http.Request.RemoteAddr field.
+// It accepts both "host:port" and plain "host" forms,
+// including IPv6 ones like "[::1]:8080", "[::1]" and "::1".
+// Reports nil if the address does not contain a valid IP.
+func parseIP(addr string) net.IP {
+	addr = strings.TrimSpace(addr)
+	if addr == "" {
+		return nil
+	}
+
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	} else if strings.HasPrefix(addr, "[") && strings.HasSuffix(addr, "]") {
+		addr = addr[1 : len(addr)-1] // e.g. [::1] without a port.
+	}
+
+	// Strip any IPv6 zone, e.g. fe80::1%eth0.
+	if idx := strings.IndexByte(addr, '%'); idx > 0 {
+		addr = addr[:idx]
+	}
+
+	return net.ParseIP(addr)
+}
+
+// remoteIP returns the IP of the direct peer of the given request.
+func remoteIP(r *http.Request) net.IP {
+	return parseIP(r.RemoteAddr)
+}
+
+// ClientIPFromHeaders returns an Options.ClientIP function which reads the client IP
+// from the first of the given headers which holds a valid IP, e.g. "X-Forwarded-For", "X-Real-IP".
+// On comma-separated lists (e.g. "client, proxy1") the right-most valid IP is used,
+// it is the one appended by the nearest proxy, the rest can be forged by the client.
+// It falls back to the IP of the RemoteAddr.
+//
+// The headers can be set by any client, so they are trusted only when it is configured:
+// use it only when the server is reachable exclusively through proxies which set (or override) them.
+func ClientIPFromHeaders(headers ...string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		for _, key := range headers {
+			values := r.Header.Values(key)
+			for i := len(values) - 1; i >= 0; i-- {
+				parts := strings.Split(values[i], ",")
+				for j := len(parts) - 1; j >= 0; j-- {
+					if ip := parseIP(parts[j]); ip != nil {
+						return ip.String()
+					}
+				}
+			}
+		}
+
+		if ip := remoteIP(r); ip != nil {
+			return ip.String()
+		}
+
+		return ""
+	}
+}
+
+// ipList holds a set of IP networks,
+// see the parseIPList function.
+type ipList []*net.IPNet
+
+// parseIPList parses a list of IPs and CIDRs,
+// e.g. []string{"127.0.0.1", "::1", "10.0.0.0/8", "2001:db8::/32"}.
+// Single IPs are stored as networks of their full length.
+func parseIPList(entries []string) (ipList, error) {
+	list := make(ipList, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if strings.IndexByte(entry, '/') > 0 {
+			_, ipNet, err := net.ParseCIDR(entry)
+			if err != nil {
+				return nil, err
+			}
+
+			list = append(list, ipNet)
+			continue
+		}
+
+		ip := parseIP(entry)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid ip: %s", entry)
+		}
+
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+
+		list = append(list, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+
+	return list, nil
+}
+
+// contains reports whether the given IP is part of the list.
+// IPv4-mapped IPv6 addresses (e.g. ::ffff:10.0.0.1) match their IPv4 networks.
+func (l ipList) contains(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+
+	for _, ipNet := range l {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
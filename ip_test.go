@@ -0,0 +1,109 @@
+package basicauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseIP(t *testing.T) {
+	var tests = []struct {
+		addr     string
+		expected string
+	}{
+		{"127.0.0.1:8080", "127.0.0.1"},
+		{"127.0.0.1", "127.0.0.1"},
+		{"[::1]:8080", "::1"},
+		{"[::1]", "::1"},
+		{"::1", "::1"},
+		{"[fe80::1%eth0]:8080", "fe80::1"},
+		{"[::ffff:10.0.0.1]:8080", "10.0.0.1"},
+		{"invalid", "<nil>"},
+		{"", "<nil>"},
+	}
+
+	for i, tt := range tests {
+		if got := parseIP(tt.addr).String(); tt.expected != got {
+			t.Fatalf("[%d] expected ip of %q to be: %s but got: %s", i, tt.addr, tt.expected, got)
+		}
+	}
+}
+
+func TestIPList(t *testing.T) {
+	list, err := parseIPList([]string{"::1", "2001:db8::/32", "10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		addr string
+		ok   bool
+	}{
+		{"[::1]:8080", true},
+		{"[::2]:8080", false},
+		{"[2001:db8::1]:443", true},
+		{"[2001:db9::1]:443", false},
+		{"10.1.2.3:8080", true},
+		{"[::ffff:10.1.2.3]:8080", true}, // IPv4-mapped IPv6 address.
+		{"192.168.1.1:8080", true},
+		{"192.168.1.2:8080", false},
+		{"invalid", false},
+	}
+
+	for i, tt := range tests {
+		if got := list.contains(parseIP(tt.addr)); tt.ok != got {
+			t.Fatalf("[%d] expected %q to be contained: %v but got: %v", i, tt.addr, tt.ok, got)
+		}
+	}
+
+	if _, err = parseIPList([]string{"2001:db8::/129"}); err == nil {
+		t.Fatalf("expected an error on invalid CIDR")
+	}
+
+	if _, err = parseIPList([]string{"not_an_ip"}); err == nil {
+		t.Fatalf("expected an error on invalid IP")
+	}
+}
+
+func TestClientIPFromHeaders(t *testing.T) {
+	clientIP := ClientIPFromHeaders("X-Forwarded-For", "X-Real-IP")
+
+	tests := []struct {
+		headers  map[string]string
+		expected string
+	}{
+		{nil, "192.0.2.1"},
+		{map[string]string{"X-Real-IP": "203.0.113.7"}, "203.0.113.7"},
+		{map[string]string{"X-Forwarded-For": "198.51.100.1, 203.0.113.9"}, "203.0.113.9"},
+		{map[string]string{"X-Forwarded-For": "198.51.100.1, invalid", "X-Real-IP": "203.0.113.7"}, "198.51.100.1"},
+		{map[string]string{"X-Forwarded-For": "invalid", "X-Real-IP": "[2001:db8::1]:8080"}, "2001:db8::1"},
+	}
+
+	for i, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil) // RemoteAddr is 192.0.2.1:1234.
+		for key, value := range tt.headers {
+			r.Header.Set(key, value)
+		}
+
+		if got := clientIP(r); tt.expected != got {
+			t.Fatalf("[%d] expected client ip: %q but got: %q", i, tt.expected, got)
+		}
+	}
+
+	// Used by the failures backoff and the server-side counters.
+	auth := New(Options{
+		Allow:      AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		MaxTries:   1,
+		MaxTriesBy: ByIP,
+		ClientIP:   clientIP,
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	proxy := withRemoteAddr("10.0.0.1:1234")
+	testHandler(t, handler, http.MethodGet, "/", proxy, withHeader("X-Real-IP", "203.0.113.7"), withBasicAuth("kataras", "invalid_pass")).
+		statusCode(http.StatusForbidden)
+	testHandler(t, handler, http.MethodGet, "/", proxy, withHeader("X-Real-IP", "203.0.113.7"), withBasicAuth("kataras", "kataras_pass")).
+		statusCode(http.StatusForbidden)
+	testHandler(t, handler, http.MethodGet, "/", proxy, withHeader("X-Real-IP", "203.0.113.8"), withBasicAuth("kataras", "kataras_pass")).
+		statusCode(http.StatusOK)
+}
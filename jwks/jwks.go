@@ -0,0 +1,401 @@
+// Package jwks provides a bearer token verifier for the basicauth middleware,
+// it validates JSON Web Tokens against a remote JSON Web Key Set (JWKS).
+// It lives in its own package so the core basicauth package stays dependency-free.
+//
+// Supported algorithms: RS256, RS384, RS512, ES256, ES384 and ES512.
+package jwks
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultRefreshEvery is the default duration that the fetched keys are cached.
+	DefaultRefreshEvery = time.Hour
+	// DefaultMinRefreshInterval is the default minimum duration between two fetches
+	// when a token is signed by an unknown key.
+	DefaultMinRefreshInterval = time.Minute
+	// DefaultFetchTimeout is the default timeout of a key set fetch.
+	DefaultFetchTimeout = 10 * time.Second
+)
+
+// defaultClient is the HTTP client used to fetch the keys when the KeySet.Client is nil.
+var defaultClient = &http.Client{Timeout: DefaultFetchTimeout}
+
+var (
+	// ErrMalformed is returned when the token is not a valid JWT.
+	ErrMalformed = errors.New("jwks: malformed token")
+	// ErrUnsupportedAlgorithm is returned when the token's algorithm is not supported.
+	ErrUnsupportedAlgorithm = errors.New("jwks: unsupported algorithm")
+	// ErrKeyNotFound is returned when the token's key id is not part of the key set.
+	ErrKeyNotFound = errors.New("jwks: key not found")
+	// ErrInvalidSignature is returned when the token's signature does not match.
+	ErrInvalidSignature = errors.New("jwks: invalid signature")
+	// ErrExpired is returned when the token's "exp" claim is in the past.
+	ErrExpired = errors.New("jwks: token expired")
+	// ErrNotValidYet is returned when the token's "nbf" claim is in the future.
+	ErrNotValidYet = errors.New("jwks: token not valid yet")
+)
+
+// Claims holds the payload of a verified token.
+// It is the user value stored by the middleware,
+// it completes the basicauth.User interface through the "sub" claim.
+type Claims map[string]interface{}
+
+// GetUsername returns the "sub" (subject) claim.
+func (c Claims) GetUsername() string {
+	sub, _ := c["sub"].(string)
+	return sub
+}
+
+// GetPassword returns an empty string, tokens do not carry a password.
+func (c Claims) GetPassword() string {
+	return ""
+}
+
+// KeySet fetches and caches the keys of a remote JSON Web Key Set.
+type KeySet struct {
+	// URL is the JWKS endpoint, e.g. https://example.com/.well-known/jwks.json.
+	URL string
+	// Client is the HTTP client used to fetch the keys.
+	// Defaults to a client with a timeout of DefaultFetchTimeout.
+	Client *http.Client
+	// RefreshEvery is the duration that the fetched keys are cached.
+	// Defaults to DefaultRefreshEvery.
+	RefreshEvery time.Duration
+	// MinRefreshInterval is the minimum duration between two fetches
+	// when a token is signed by an unknown key (e.g. after a key rotation).
+	// Defaults to DefaultMinRefreshInterval.
+	MinRefreshInterval time.Duration
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+	// fetching is the in-flight fetch, if any, so concurrent requests share it.
+	fetching *fetchCall
+}
+
+// fetchCall is a fetch of the key set, shared by concurrent requests.
+type fetchCall struct {
+	done chan struct{}
+	keys map[string]crypto.PublicKey
+	err  error
+}
+
+// NewKeySet returns a new KeySet of the given JWKS endpoint.
+// The keys are fetched lazily, on the first verification.
+func NewKeySet(url string) *KeySet {
+	return &KeySet{
+		URL:                url,
+		Client:             defaultClient,
+		RefreshEvery:       DefaultRefreshEvery,
+		MinRefreshInterval: DefaultMinRefreshInterval,
+	}
+}
+
+// AllowJWT returns a bearer token verification function which validates
+// the token's signature against the keys of the given JWKS endpoint,
+// the fetched keys are cached and refreshed periodically.
+// On success the user value is the token's Claims.
+//
+// Note that only the signature and the "exp" and "nbf" claims are validated,
+// wrap the result to validate other claims, e.g. the audience or the issuer.
+//
+// Usage:
+//
+//	basicauth.New(basicauth.Options{Allow: ..., TokenAllow: jwks.AllowJWT(jwksURL)})
+func AllowJWT(jwksURL string) func(r *http.Request, token string) (interface{}, bool) {
+	return NewKeySet(jwksURL).Allow
+}
+
+// Allow verifies the given token and returns its claims as the user value.
+func (ks *KeySet) Allow(r *http.Request, token string) (interface{}, bool) {
+	claims, err := ks.Verify(token)
+	if err != nil {
+		return nil, false
+	}
+
+	return claims, true
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify validates the given token and returns its claims.
+func (ks *KeySet) Verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, ErrMalformed
+	}
+
+	hash, ok := hashes[h.Alg]
+	if !ok {
+		return nil, ErrUnsupportedAlgorithm
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	key, err := ks.key(h.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	hasher := hash.New()
+	hasher.Write([]byte(parts[0] + "." + parts[1]))
+	if err = verify(h.Alg, key, hash, hasher.Sum(nil), signature); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrMalformed
+	}
+
+	now := float64(time.Now().Unix())
+	if exp, ok := claims["exp"].(float64); ok && now >= exp {
+		return nil, ErrExpired
+	}
+
+	if nbf, ok := claims["nbf"].(float64); ok && now < nbf {
+		return nil, ErrNotValidYet
+	}
+
+	return claims, nil
+}
+
+var hashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+	"ES256": crypto.SHA256,
+	"ES384": crypto.SHA384,
+	"ES512": crypto.SHA512,
+}
+
+func verify(alg string, key crypto.PublicKey, hash crypto.Hash, digest, signature []byte) error {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			return ErrUnsupportedAlgorithm
+		}
+
+		if rsa.VerifyPKCS1v15(k, hash, digest, signature) != nil {
+			return ErrInvalidSignature
+		}
+	case *ecdsa.PublicKey:
+		if !strings.HasPrefix(alg, "ES") {
+			return ErrUnsupportedAlgorithm
+		}
+
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return ErrInvalidSignature
+		}
+
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return ErrInvalidSignature
+		}
+	default:
+		return ErrUnsupportedAlgorithm
+	}
+
+	return nil
+}
+
+// key returns the public key of the given key id,
+// the key set is fetched when it's missing, outdated or the key id is unknown.
+// The fetch runs outside of the lock and concurrent requests share it,
+// the ones with a cached key do not wait for it.
+func (ks *KeySet) key(kid string) (crypto.PublicKey, error) {
+	ks.mu.Lock()
+	now := time.Now()
+	key, ok := ks.keys[kid]
+	stale := ks.keys == nil || now.Sub(ks.fetchedAt) > ks.RefreshEvery
+	if !ok && !stale && now.Sub(ks.fetchedAt) > ks.MinRefreshInterval {
+		stale = true // unknown key, e.g. rotated.
+	}
+
+	if !stale {
+		ks.mu.Unlock()
+		if !ok {
+			return nil, ErrKeyNotFound
+		}
+
+		return key, nil
+	}
+
+	call := ks.fetching
+	if call == nil {
+		call = &fetchCall{done: make(chan struct{})}
+		ks.fetching = call
+		ks.mu.Unlock()
+
+		call.keys, call.err = ks.fetch()
+
+		ks.mu.Lock()
+		if call.err == nil {
+			ks.keys, ks.fetchedAt = call.keys, now
+		}
+		ks.fetching = nil
+		ks.mu.Unlock()
+		close(call.done)
+	} else {
+		ks.mu.Unlock()
+		if ok { // keep serving the cached key while it's refreshed.
+			return key, nil
+		}
+
+		<-call.done
+	}
+
+	if call.err != nil {
+		if ok { // keep serving the cached key.
+			return key, nil
+		}
+		return nil, call.err
+	}
+
+	if key, ok = call.keys[kid]; !ok {
+		return nil, ErrKeyNotFound
+	}
+
+	return key, nil
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	// RSA.
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC.
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (ks *KeySet) fetch() (map[string]crypto.PublicKey, error) {
+	client := ks.Client
+	if client == nil {
+		client = defaultClient
+	}
+
+	resp, err := client.Get(ks.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("jwks: fetch: unexpected status code: %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("jwks: fetch: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue // skip unsupported keys.
+		}
+
+		keys[jwk.Kid] = key
+	}
+
+	return keys, nil
+}
+
+func (jwk jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, ErrUnsupportedAlgorithm
+		}
+
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, ErrUnsupportedAlgorithm
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
+
+func decodeSegment(s string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
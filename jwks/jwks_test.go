@@ -0,0 +1,185 @@
+package jwks
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestServer(t *testing.T, kid string, key *rsa.PublicKey) (*httptest.Server, *int) {
+	t.Helper()
+
+	var fetches int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": kid,
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &fetches
+}
+
+func sign(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	t.Helper()
+
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": kid})
+	payload, _ := json.Marshal(claims)
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	digest := crypto.SHA256.New()
+	digest.Write([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest.Sum(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestAllowJWT(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv, fetches := newTestServer(t, "key-1", &key.PublicKey)
+	allow := AllowJWT(srv.URL)
+
+	token := sign(t, key, "key-1", map[string]interface{}{
+		"sub": "kataras",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+
+	user, ok := allow(nil, token)
+	if !ok {
+		t.Fatalf("expected a valid token")
+	}
+	if got := user.(Claims).GetUsername(); got != "kataras" {
+		t.Fatalf("expected username: kataras but got: %s", got)
+	}
+
+	// Tampered payload, the signature does not match.
+	parts := strings.Split(token, ".")
+	tamperedPayload, _ := json.Marshal(map[string]interface{}{"sub": "admin"})
+	parts[1] = base64.RawURLEncoding.EncodeToString(tamperedPayload)
+	if _, ok = allow(nil, strings.Join(parts, ".")); ok {
+		t.Fatalf("expected a tampered token to fail")
+	}
+
+	// Signed by a key which is not part of the key set.
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok = allow(nil, sign(t, otherKey, "key-1", map[string]interface{}{"sub": "kataras"})); ok {
+		t.Fatalf("expected a token signed by a foreign key to fail")
+	}
+
+	expired := sign(t, key, "key-1", map[string]interface{}{
+		"sub": "kataras",
+		"exp": time.Now().Add(-time.Minute).Unix(),
+	})
+	if _, ok = allow(nil, expired); ok {
+		t.Fatalf("expected an expired token to fail")
+	}
+
+	if _, ok = allow(nil, "not.a.token"); ok {
+		t.Fatalf("expected a malformed token to fail")
+	}
+
+	if expected := 1; *fetches != expected {
+		t.Fatalf("expected the key set to be fetched: %d time(s) but got: %d", expected, *fetches)
+	}
+}
+
+func TestKeySetRefresh(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv, fetches := newTestServer(t, "key-1", &key.PublicKey)
+	ks := NewKeySet(srv.URL)
+	ks.MinRefreshInterval = 0
+
+	if _, err = ks.Verify(sign(t, key, "key-1", map[string]interface{}{"sub": "kataras"})); err != nil {
+		t.Fatal(err)
+	}
+
+	// Unknown key id triggers a refetch.
+	if _, err = ks.Verify(sign(t, key, "key-2", map[string]interface{}{"sub": "kataras"})); err != ErrKeyNotFound {
+		t.Fatalf("expected error: %v but got: %v", ErrKeyNotFound, err)
+	}
+
+	if expected := 2; *fetches != expected {
+		t.Fatalf("expected the key set to be fetched: %d time(s) but got: %d", expected, *fetches)
+	}
+}
+
+func TestKeySetFetchOutsideLock(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv, _ := newTestServer(t, "key-1", &key.PublicKey)
+	ks := NewKeySet(srv.URL)
+	ks.MinRefreshInterval = 0
+
+	token := sign(t, key, "key-1", map[string]interface{}{"sub": "kataras"})
+	if _, err = ks.Verify(token); err != nil {
+		t.Fatal(err)
+	}
+
+	// The endpoint hangs on the next fetch.
+	unblock := make(chan struct{})
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+	}))
+	t.Cleanup(func() {
+		close(unblock)
+		hanging.Close()
+	})
+
+	ks.mu.Lock()
+	ks.URL = hanging.URL
+	ks.mu.Unlock()
+
+	go ks.Verify(sign(t, key, "key-2", map[string]interface{}{"sub": "kataras"})) // triggers the hanging fetch.
+	time.Sleep(50 * time.Millisecond)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := ks.Verify(token)
+		done <- err
+	}()
+
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected a cached key to be served while the key set is fetched")
+	}
+
+	if ks.Client.Timeout != DefaultFetchTimeout {
+		t.Fatalf("expected the default client timeout: %s but got: %s", DefaultFetchTimeout, ks.Client.Timeout)
+	}
+}
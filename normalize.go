@@ -0,0 +1,45 @@
+package basicauth
+
+import "golang.org/x/text/unicode/norm"
+
+// NormalizationForm is the Unicode normalization form
+// which is applied to the user input, see Options.NormalizeForm.
+type NormalizationForm uint8
+
+const (
+	// NormalizeNone does not normalize the user input.
+	NormalizeNone NormalizationForm = iota
+	// NormalizeNFC is the canonical composition form, recommended by RFC 8265 for usernames and passwords.
+	NormalizeNFC
+	// NormalizeNFD is the canonical decomposition form.
+	NormalizeNFD
+	// NormalizeNFKC is the compatibility composition form.
+	NormalizeNFKC
+	// NormalizeNFKD is the compatibility decomposition form.
+	NormalizeNFKD
+)
+
+// normalize returns the given string in the normalization form.
+func (f NormalizationForm) normalize(s string) string {
+	switch f {
+	case NormalizeNFC:
+		return norm.NFC.String(s)
+	case NormalizeNFD:
+		return norm.NFD.String(s)
+	case NormalizeNFKC:
+		return norm.NFKC.String(s)
+	case NormalizeNFKD:
+		return norm.NFKD.String(s)
+	default:
+		return s
+	}
+}
+
+// normalizeCredentials returns the user input in the Options.NormalizeForm.
+func (b *BasicAuth) normalizeCredentials(username, password string) (string, string) {
+	if f := b.opts.NormalizeForm; f != NormalizeNone {
+		return f.normalize(username), f.normalize(password)
+	}
+
+	return username, password
+}
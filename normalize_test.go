@@ -0,0 +1,59 @@
+package basicauth
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestNormalizeForm(t *testing.T) {
+	const (
+		nfc = "jos\u00e9"  // é as a single code point.
+		nfd = "jose\u0301" // e followed by a combining acute accent.
+	)
+
+	b, auth := NewBasicAuth(Options{
+		Allow:         AllowUsers(map[string]string{nfc: "café_pass"}),
+		NormalizeForm: NormalizeNFC,
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(GetUser(r).(User).GetUsername()))
+	}))
+
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth(nfc, "café_pass")).
+		statusCode(http.StatusOK).bodyEq(nfc)
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth(nfd, "café_pass")).
+		statusCode(http.StatusOK).bodyEq(nfc)
+
+	if expected, got := 1, b.Len(); expected != got {
+		t.Fatalf("expected %d stored credentials but got: %d", expected, got)
+	}
+
+	// Without normalization the NFD variant is a different user.
+	auth = New(Options{
+		Allow: AllowUsers(map[string]string{nfc: "café_pass"}),
+	})
+	handler = auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth(nfd, "café_pass")).
+		statusCode(http.StatusUnauthorized)
+}
+
+func TestNormalizationForm(t *testing.T) {
+	var tests = []struct {
+		form     NormalizationForm
+		input    string
+		expected string
+	}{
+		{NormalizeNone, "e\u0301", "e\u0301"},
+		{NormalizeNFC, "e\u0301", "\u00e9"},
+		{NormalizeNFD, "\u00e9", "e\u0301"},
+		{NormalizeNFKC, "\ufb01", "fi"}, // the "fi" ligature.
+		{NormalizeNFKD, "\u00e9", "e\u0301"},
+	}
+
+	for i, tt := range tests {
+		if got := tt.form.normalize(tt.input); got != tt.expected {
+			t.Fatalf("[%d] expected: %q but got: %q", i, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package basicauth
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// PBKDF2 it is a UserAuthOption, it compares a PBKDF2-HMAC hash of the Django encoding,
+// e.g. pbkdf2_sha256$<iterations>$<salt>$<base64 hash>, with its user input in constant time.
+// Both the "pbkdf2_sha256" and the "pbkdf2_sha1" variants are accepted, distinguished by the prefix.
+// The iterations, the salt and the digest are read from each stored hash,
+// so the iterations can be increased over time without code changes.
+//
+// It can be composed with the rest of the hash options, e.g. BCRYPT,
+// so a single user list can mix hash schemes, each one is detected by its prefix.
+//
+// Usage:
+//
+//	Options.Allow = AllowUsers(..., PBKDF2) OR
+//	Options.Allow = AllowUsersFile("users.yml", PBKDF2, BCRYPT)
+func PBKDF2(opts *UserAuthOptions) {
+	withScheme(hashScheme{
+		prefixes: []string{pbkdf2SHA256Prefix, pbkdf2SHA1Prefix},
+		verify:   verifyPBKDF2,
+		validate: validatePBKDF2,
+		dummy:    dummyPBKDF2Hash,
+	})(opts)
+}
+
+const (
+	pbkdf2SHA256Prefix = "pbkdf2_sha256$"
+	pbkdf2SHA1Prefix   = "pbkdf2_sha1$"
+)
+
+// dummyPBKDF2Hash is a pbkdf2_sha256 hash of the Django 4.2 default iterations,
+// compared against on unknown usernames, see UserAuthOptions.DummyPassword.
+const dummyPBKDF2Hash = "pbkdf2_sha256$600000$basicauthdummy$YGcEkQmrMJ76vEc+nKgG+o3SlVDGBkP8Gh4itREBeeE="
+
+var errPBKDF2Malformed = errors.New("pbkdf2: malformed hash")
+
+// pbkdf2Hash is a decoded Django PBKDF2 encoded hash.
+type pbkdf2Hash struct {
+	newHash    func() hash.Hash
+	iterations int
+	salt       string
+	key        []byte
+}
+
+func parsePBKDF2(encoded string) (*pbkdf2Hash, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 {
+		return nil, errPBKDF2Malformed
+	}
+
+	h := new(pbkdf2Hash)
+	switch parts[0] + "$" {
+	case pbkdf2SHA256Prefix:
+		h.newHash = sha256.New
+	case pbkdf2SHA1Prefix:
+		h.newHash = sha1.New
+	default:
+		return nil, fmt.Errorf("pbkdf2: unsupported algorithm: %s", parts[0])
+	}
+
+	var err error
+	if h.iterations, err = strconv.Atoi(parts[1]); err != nil {
+		return nil, errPBKDF2Malformed
+	}
+	if h.iterations <= 0 {
+		return nil, fmt.Errorf("pbkdf2: invalid iterations: %d", h.iterations)
+	}
+
+	if h.salt = parts[2]; h.salt == "" {
+		return nil, errPBKDF2Malformed
+	}
+
+	if h.key, err = base64.StdEncoding.DecodeString(parts[3]); err != nil || len(h.key) == 0 {
+		return nil, errPBKDF2Malformed
+	}
+
+	return h, nil
+}
+
+// verifyPBKDF2 compares a Django PBKDF2 encoded hash with its user input in constant time,
+// the parameters are read from the encoded hash.
+func verifyPBKDF2(stored, userPassword string) bool {
+	h, err := parsePBKDF2(stored)
+	if err != nil {
+		return false
+	}
+
+	key := pbkdf2.Key([]byte(userPassword), []byte(h.salt), h.iterations, len(h.key), h.newHash)
+	return subtle.ConstantTimeCompare(key, h.key) == 1
+}
+
+// validatePBKDF2 reports an error if the given encoded hash is malformed.
+func validatePBKDF2(stored string) error {
+	_, err := parsePBKDF2(stored)
+	return err
+}
@@ -0,0 +1,69 @@
+package basicauth
+
+import (
+	"strings"
+	"testing"
+)
+
+const (
+	// kataras_pass, 1000 iterations.
+	testPBKDF2SHA256Hash = "pbkdf2_sha256$1000$katarassalt$3SQj2cpRdAwkKMCNKy8+kCuC1Oxq9q+NvEIGiUlybO0="
+	// kataras_pass, 1000 iterations.
+	testPBKDF2SHA1Hash = "pbkdf2_sha1$1000$katarassalt$DjaSOS+avRr+pRgGOsTLOqC9F5Q="
+)
+
+func TestPBKDF2(t *testing.T) {
+	allow := AllowUsers(map[string]string{
+		"kataras": testPBKDF2SHA256Hash,
+		"makis":   testPBKDF2SHA1Hash,
+		"george":  testArgon2Hash,
+	}, PBKDF2, ARGON2)
+
+	var tests = []struct {
+		username, password string
+		ok                 bool
+	}{
+		{"kataras", "kataras_pass", true},
+		{"makis", "kataras_pass", true},
+		{"george", "kataras_pass", true},
+		{"kataras", "invalid_pass", false},
+		{"makis", "invalid_pass", false},
+		{"kataras", testPBKDF2SHA256Hash, false},
+		{"unknown", "kataras_pass", false},
+	}
+
+	for i, tt := range tests {
+		if _, ok := allow(nil, tt.username, tt.password); tt.ok != ok {
+			t.Fatalf("[%d] expected: %v but got: %v (username=%s,password=%s)", i, tt.ok, ok, tt.username, tt.password)
+		}
+	}
+
+	if _, err := parsePBKDF2(dummyPBKDF2Hash); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, tt := range []struct {
+		hash     string
+		expected string
+	}{
+		{"pbkdf2_sha256$1000$katarassalt", "malformed hash"},
+		{"pbkdf2_sha256$many$katarassalt$3SQj2cpRdAwk", "malformed hash"},
+		{"pbkdf2_sha256$0$katarassalt$3SQj2cpRdAwk", "invalid iterations"},
+		{"pbkdf2_sha512$1000$katarassalt$3SQj2cpRdAwk", "unsupported password hash"},
+	} {
+		func() {
+			defer func() {
+				v := recover()
+				if v == nil {
+					t.Fatalf("[%d] expected a load error", i)
+				}
+
+				if got := v.(string); !strings.Contains(got, tt.expected) {
+					t.Fatalf("[%d] expected a load error containing: %q but got: %q", i, tt.expected, got)
+				}
+			}()
+
+			AllowUsers(map[string]string{"kataras": tt.hash}, PBKDF2, BCRYPT)
+		}()
+	}
+}
@@ -0,0 +1,120 @@
+package basicauth
+
+import (
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
+
+// PasswordPolicy describes the requirements of a plain password.
+// See the WithPasswordPolicy function.
+type PasswordPolicy struct {
+	// MinLength is the minimum number of characters.
+	MinLength int
+	// RequireUpper requires at least one upper case letter.
+	RequireUpper bool
+	// RequireLower requires at least one lower case letter.
+	RequireLower bool
+	// RequireDigit requires at least one digit.
+	RequireDigit bool
+	// RequireSymbol requires at least one punctuation or symbol character.
+	RequireSymbol bool
+}
+
+// Validate returns a non-nil error if the given password
+// does not meet the policy's requirements.
+func (p PasswordPolicy) Validate(password string) error {
+	if n := utf8.RuneCountInString(password); n < p.MinLength {
+		return fmt.Errorf("password policy: at least %d characters required but got %d", p.MinLength, n)
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			hasSymbol = true
+		}
+	}
+
+	switch {
+	case p.RequireUpper && !hasUpper:
+		return fmt.Errorf("password policy: an upper case letter is required")
+	case p.RequireLower && !hasLower:
+		return fmt.Errorf("password policy: a lower case letter is required")
+	case p.RequireDigit && !hasDigit:
+		return fmt.Errorf("password policy: a digit is required")
+	case p.RequireSymbol && !hasSymbol:
+		return fmt.Errorf("password policy: a symbol is required")
+	}
+
+	return nil
+}
+
+// WithPasswordPolicy is a UserAuthOption which enforces the given password policy
+// on the stored passwords of the AllowUsers and AllowUsersFile functions at load time.
+// A weak password causes a panic on initialization, so insecure configuration is caught early.
+//
+// Note that it makes sense only for plain passwords (e.g. development setups),
+// do NOT use it with hashed passwords (e.g. BCRYPT).
+//
+// Usage:
+//
+//	Default(users, WithPasswordPolicy(PasswordPolicy{MinLength: 12, RequireDigit: true}))
+func WithPasswordPolicy(policy PasswordPolicy) UserAuthOption {
+	return func(opts *UserAuthOptions) {
+		opts.PasswordPolicy = &policy
+	}
+}
+
+// WithCompromisedCheck is a UserAuthOption which rejects a matched password
+// if the "isCompromised" predicate reports true for it, e.g. a lookup to a local
+// bloom filter of leaked password hashes (the dataset itself is out of the scope of this package).
+// The predicate is called with the user input only after a successful comparison,
+// the login fails with an ErrPasswordCompromised reason (see ErrCredentialsInvalid.Reason).
+//
+// Usage:
+//
+//	Default(users, BCRYPT, WithCompromisedCheck(leaked.Contains))
+func WithCompromisedCheck(isCompromised func(password string) bool) UserAuthOption {
+	return func(opts *UserAuthOptions) {
+		opts.IsCompromised = isCompromised
+	}
+}
+
+// isCompromised reports whether the given, matched, user input is a compromised password.
+func (opts UserAuthOptions) isCompromised(password string) bool {
+	return opts.IsCompromised != nil && opts.IsCompromised(password)
+}
+
+// validatePassword validates the given stored password against
+// the configured password policy and hash validation, if any, and panics on failure.
+func (opts UserAuthOptions) validatePassword(username, password string) {
+	if err := opts.checkPassword(username, password); err != nil {
+		panic(err.Error())
+	}
+}
+
+// checkPassword is like validatePassword but it returns the failure as an error.
+func (opts UserAuthOptions) checkPassword(username, password string) error {
+	if opts.ValidateHash != nil {
+		if err := opts.ValidateHash(password); err != nil {
+			return fmt.Errorf("user %q: %w", username, err)
+		}
+	}
+
+	if opts.PasswordPolicy == nil {
+		return nil
+	}
+
+	if err := opts.PasswordPolicy.Validate(password); err != nil {
+		return fmt.Errorf("user %q: %w", username, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package basicauth
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestWithPasswordPolicy(t *testing.T) {
+	policy := WithPasswordPolicy(PasswordPolicy{
+		MinLength:    10,
+		RequireUpper: true,
+		RequireDigit: true,
+	})
+
+	var tests = []struct {
+		users interface{}
+		ok    bool
+	}{
+		{map[string]string{"kataras": "Strong_pass42"}, true},
+		{[]Map{{"username": "kataras", "password": "Strong_pass42"}}, true},
+		{map[string]string{"kataras": "weak"}, false},
+		{map[string]string{"kataras": "weak_but_long42"}, false},
+		{[]Map{{"username": "kataras", "password": "Weak_pass"}}, false},
+	}
+
+	for i, tt := range tests {
+		func() {
+			defer func() {
+				v := recover()
+				if tt.ok && v != nil {
+					t.Fatalf("[%d] expected no panic but got: %v", i, v)
+				}
+
+				if !tt.ok && (v == nil || !strings.Contains(v.(string), "password policy")) {
+					t.Fatalf("[%d] expected a password policy panic but got: %v", i, v)
+				}
+			}()
+
+			AllowUsers(tt.users, policy)
+		}()
+	}
+}
+
+func TestWithCompromisedCheck(t *testing.T) {
+	leaked := map[string]struct{}{"123456": {}}
+	isCompromised := func(password string) bool {
+		_, ok := leaked[password]
+		return ok
+	}
+
+	allows := []AuthFunc{
+		AllowUsers(map[string]string{"kataras": "123456", "makis": "makis_pass"}, WithCompromisedCheck(isCompromised)),
+		AllowUsers([]Map{{"username": "kataras", "password": "123456"}, {"username": "makis", "password": "makis_pass"}},
+			WithCompromisedCheck(isCompromised)),
+	}
+
+	for i, allow := range allows {
+		var reason error
+		auth := New(Options{
+			Allow: allow,
+			ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+				var compromised ErrPasswordCompromised
+				if errors.As(err, &compromised) {
+					reason = compromised
+				}
+
+				DefaultErrorHandler(w, r, err)
+			},
+		})
+		handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		}))
+
+		testHandler(t, handler, http.MethodGet, "/", withBasicAuth("makis", "makis_pass")).
+			statusCode(http.StatusOK).bodyEq("ok")
+		if reason != nil {
+			t.Fatalf("[%d] expected no reason but got: %v", i, reason)
+		}
+
+		testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "123456")).
+			statusCode(http.StatusUnauthorized)
+		if e, ok := reason.(ErrPasswordCompromised); !ok || e.Username != "kataras" {
+			t.Fatalf("[%d] expected an ErrPasswordCompromised reason but got: %v", i, reason)
+		}
+
+		// A mismatch is not checked against the predicate.
+		reason = nil
+		testHandler(t, handler, http.MethodGet, "/", withBasicAuth("makis", "123456")).
+			statusCode(http.StatusUnauthorized)
+		if reason != nil {
+			t.Fatalf("[%d] expected no compromised reason but got: %v", i, reason)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package basicauth
+
+import (
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RateLimitBy is the key of the RateLimit token buckets, see the RateLimit.By field.
+type RateLimitBy uint8
+
+const (
+	// RateLimitGlobal shares a single token bucket across all requests.
+	RateLimitGlobal RateLimitBy = iota
+	// RateLimitByIP keeps a token bucket per client IP, see Options.ClientIP.
+	RateLimitByIP
+	// RateLimitByUsername keeps a token bucket per username.
+	RateLimitByUsername
+)
+
+// String returns the text representation of the rate limit key.
+func (by RateLimitBy) String() string {
+	switch by {
+	case RateLimitGlobal:
+		return "global"
+	case RateLimitByIP:
+		return "ip"
+	case RateLimitByUsername:
+		return "username"
+	default:
+		return "unknown"
+	}
+}
+
+// RateLimit holds the configuration of a token bucket rate limiter
+// of the authentication attempts, e.g. against credential-stuffing.
+// Each attempt which reaches the Options.Allow takes a token of its bucket,
+// the buckets are refilled by Rate tokens per second, up to Burst tokens.
+// When a bucket is empty the attempts are rejected with the ErrTooManyRequests
+// (429 Too Many Requests with a Retry-After header) without calling the Allow.
+// See the Options.RateLimit field.
+type RateLimit struct {
+	// Rate is the number of the attempts allowed per second.
+	// Zero disables the rate limiter.
+	Rate float64
+	// Burst is the maximum number of the attempts allowed at once.
+	//
+	// Defaults to the Rate, rounded up.
+	Burst int
+	// By is the key of the token buckets.
+	//
+	// Defaults to RateLimitGlobal.
+	By RateLimitBy
+}
+
+// rateLimiter implements the RateLimit.
+type rateLimiter struct {
+	cfg RateLimit
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	pruned  time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(cfg RateLimit) *rateLimiter {
+	if cfg.Burst <= 0 {
+		cfg.Burst = int(math.Ceil(cfg.Rate))
+	}
+
+	return &rateLimiter{
+		cfg:     cfg,
+		buckets: make(map[string]*tokenBucket),
+		pruned:  time.Now(),
+	}
+}
+
+// take takes a token of the given key's bucket and returns zero,
+// or the duration until the next token when the bucket is empty.
+func (l *rateLimiter) take(key string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.pruned) > l.fullAfter() {
+		l.pruneLocked(now)
+	}
+
+	burst := float64(l.cfg.Burst)
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: burst, last: now}
+		l.buckets[key] = bucket
+	}
+
+	if elapsed := now.Sub(bucket.last); elapsed > 0 {
+		bucket.tokens = math.Min(burst, bucket.tokens+elapsed.Seconds()*l.cfg.Rate)
+		bucket.last = now
+	}
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return 0
+	}
+
+	return time.Duration((1 - bucket.tokens) / l.cfg.Rate * float64(time.Second))
+}
+
+// fullAfter returns the duration that an empty bucket needs to be refilled.
+func (l *rateLimiter) fullAfter() time.Duration {
+	return time.Duration(float64(l.cfg.Burst) / l.cfg.Rate * float64(time.Second))
+}
+
+// pruneLocked removes the buckets which are full by now, they are equal to new ones.
+func (l *rateLimiter) pruneLocked(now time.Time) {
+	fullAfter := l.fullAfter()
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.last) >= fullAfter {
+			delete(l.buckets, key)
+		}
+	}
+
+	l.pruned = now
+}
+
+// rateLimitKey returns the token bucket key of the given request and username.
+func (b *BasicAuth) rateLimitKey(r *http.Request, username string) string {
+	switch b.limiter.cfg.By {
+	case RateLimitByIP:
+		return b.clientIP(r)
+	case RateLimitByUsername:
+		return username
+	default:
+		return ""
+	}
+}
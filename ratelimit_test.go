@@ -0,0 +1,60 @@
+package basicauth
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(RateLimit{Rate: 2, Burst: 3})
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if retryAfter := l.take("", now); retryAfter != 0 {
+			t.Fatalf("[%d] expected a token but got retry after: %s", i, retryAfter)
+		}
+	}
+
+	if expected, got := 500*time.Millisecond, l.take("", now); expected != got {
+		t.Fatalf("expected retry after: %s but got: %s", expected, got)
+	}
+
+	// Refilled by 2 tokens per second.
+	now = now.Add(time.Second)
+	for i := 0; i < 2; i++ {
+		if retryAfter := l.take("", now); retryAfter != 0 {
+			t.Fatalf("[%d] expected a token but got retry after: %s", i, retryAfter)
+		}
+	}
+	if retryAfter := l.take("", now); retryAfter == 0 {
+		t.Fatalf("expected an empty bucket")
+	}
+
+	// Other keys have their own buckets and the full ones are pruned.
+	if retryAfter := l.take("other", now); retryAfter != 0 {
+		t.Fatalf("expected a token but got retry after: %s", retryAfter)
+	}
+	l.take("", now.Add(time.Hour))
+	if expected, got := 1, len(l.buckets); expected != got {
+		t.Fatalf("expected %d buckets after prune but got: %d", expected, got)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	auth := New(Options{
+		Allow:     AllowUsers(map[string]string{"kataras": "kataras_pass", "makis": "makis_pass"}),
+		RateLimit: &RateLimit{Rate: 0.5, Burst: 1, By: RateLimitByUsername},
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "invalid_pass")).
+		statusCode(http.StatusUnauthorized)
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).
+		statusCode(http.StatusTooManyRequests).headerEq("Retry-After", "2")
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("makis", "makis_pass")).
+		statusCode(http.StatusOK)
+	// Requests without credentials do not reach the limiter.
+	testHandler(t, handler, http.MethodGet, "/").
+		statusCode(http.StatusUnauthorized)
+}
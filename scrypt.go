@@ -0,0 +1,164 @@
+package basicauth
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// SCRYPT it is a UserAuthOption, it compares a scrypt encoded hash with its user input in constant time.
+// The cost parameters are read from each stored hash, all of the following forms are accepted:
+//
+//	$scrypt$ln=<log2(N)>,r=<r>,p=<p>$<salt>$<hash> (e.g. passlib)
+//	$scrypt$N=<N>,r=<r>,p=<p>$<salt>$<hash>
+//	$scrypt$<N>:<r>:<p>$<salt>$<hash>
+//
+// The salt and the hash are base64 encoded, with or without padding,
+// the "./" alphabet of passlib is accepted too. The salt is used decoded
+// and the key length is the length of the decoded hash.
+//
+// It can be composed with the rest of the hash options, e.g. BCRYPT,
+// so a single user list can mix hash schemes, each one is detected by its prefix.
+//
+// Usage:
+//
+//	Options.Allow = AllowUsers(..., SCRYPT) OR
+//	Options.Allow = AllowUsersFile("users.yml", SCRYPT, BCRYPT)
+func SCRYPT(opts *UserAuthOptions) {
+	withScheme(hashScheme{
+		prefixes: []string{scryptPrefix},
+		verify:   verifyScrypt,
+		validate: validateScrypt,
+		dummy:    dummyScryptHash,
+	})(opts)
+}
+
+const scryptPrefix = "$scrypt$"
+
+// dummyScryptHash is a scrypt hash of N=16384, r=8, p=1,
+// compared against on unknown usernames, see UserAuthOptions.DummyPassword.
+const dummyScryptHash = "$scrypt$ln=14,r=8,p=1$YmFzaWNhdXRoZHVtbXk$viRlGNMIyQA+HVI7eyB3fagdQEvoGjFtTowKSFKLT6o"
+
+var errScryptMalformed = errors.New("scrypt: malformed hash")
+
+// scryptHash is a decoded scrypt encoded hash.
+type scryptHash struct {
+	n, r, p int
+	salt    []byte
+	key     []byte
+}
+
+func parseScrypt(encoded string) (*scryptHash, error) {
+	if !strings.HasPrefix(encoded, scryptPrefix) {
+		return nil, errScryptMalformed
+	}
+
+	parts := strings.Split(encoded[len(scryptPrefix):], "$")
+	if len(parts) != 3 {
+		return nil, errScryptMalformed
+	}
+
+	h := new(scryptHash)
+	if err := h.parseParams(parts[0]); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if h.salt, err = decodeScryptBase64(parts[1]); err != nil {
+		return nil, errScryptMalformed
+	}
+
+	if h.key, err = decodeScryptBase64(parts[2]); err != nil || len(h.key) == 0 {
+		return nil, errScryptMalformed
+	}
+
+	return h, nil
+}
+
+// parseParams parses the "ln=14,r=8,p=1", "N=16384,r=8,p=1" or "16384:8:1" cost parameters.
+func (h *scryptHash) parseParams(s string) error {
+	if fields := strings.Split(s, ":"); len(fields) == 3 {
+		var err error
+		if h.n, err = strconv.Atoi(fields[0]); err != nil {
+			return errScryptMalformed
+		}
+		if h.r, err = strconv.Atoi(fields[1]); err != nil {
+			return errScryptMalformed
+		}
+		if h.p, err = strconv.Atoi(fields[2]); err != nil {
+			return errScryptMalformed
+		}
+	} else {
+		for _, field := range strings.Split(s, ",") {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 {
+				return errScryptMalformed
+			}
+
+			v, err := strconv.Atoi(kv[1])
+			if err != nil {
+				return errScryptMalformed
+			}
+
+			switch kv[0] {
+			case "ln":
+				if v < 1 || v > 62 {
+					return fmt.Errorf("scrypt: invalid cost: ln=%d", v)
+				}
+				h.n = 1 << v
+			case "N":
+				h.n = v
+			case "r":
+				h.r = v
+			case "p":
+				h.p = v
+			default:
+				return errScryptMalformed
+			}
+		}
+	}
+
+	if h.n <= 1 || h.n&(h.n-1) != 0 {
+		return fmt.Errorf("scrypt: invalid cost: N=%d is not a power of 2", h.n)
+	}
+
+	if h.r <= 0 || h.p <= 0 {
+		return fmt.Errorf("scrypt: invalid parameters: r=%d, p=%d", h.r, h.p)
+	}
+
+	return nil
+}
+
+// decodeScryptBase64 decodes a standard base64 value, with or without padding,
+// including the passlib's adapted alphabet which uses "." instead of "+".
+func decodeScryptBase64(s string) ([]byte, error) {
+	s = strings.TrimRight(strings.ReplaceAll(s, ".", "+"), "=")
+	return base64.RawStdEncoding.DecodeString(s)
+}
+
+// verifyScrypt compares a scrypt encoded hash with its user input in constant time,
+// the parameters are read from the encoded hash.
+func verifyScrypt(stored, userPassword string) bool {
+	h, err := parseScrypt(stored)
+	if err != nil {
+		return false
+	}
+
+	key, err := scrypt.Key([]byte(userPassword), h.salt, h.n, h.r, h.p, len(h.key))
+	if err != nil {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare(key, h.key) == 1
+}
+
+// validateScrypt reports an error if the given encoded hash is malformed.
+func validateScrypt(stored string) error {
+	_, err := parseScrypt(stored)
+	return err
+}
@@ -0,0 +1,76 @@
+package basicauth
+
+import (
+	"strings"
+	"testing"
+)
+
+const (
+	// kataras_pass, N=1024, r=8, p=1.
+	testScryptHash = "$scrypt$ln=10,r=8,p=1$a2F0YXJhc19zYWx0$FD3RoD6zByJkxFgWokb/AoHXCx0TNxU0DCxjiDjMIRU"
+	// kataras_pass, N=1024, r=8, p=1, padded and of a 64 bytes key.
+	testScryptColonHash = "$scrypt$1024:8:1$a2F0YXJhc19zYWx0$FD3RoD6zByJkxFgWokb/AoHXCx0TNxU0DCxjiDjMIRW5ViOUdG5toxrX3CBIm/HDvH7LgevdZxGh9WepubAZ5w=="
+)
+
+func TestSCRYPT(t *testing.T) {
+	allow := AllowUsers(map[string]string{
+		"kataras": testScryptHash,
+		"makis":   testScryptColonHash,
+		"george":  "$scrypt$N=1024,r=8,p=1$a2F0YXJhc19zYWx0$FD3RoD6zByJkxFgWokb/AoHXCx0TNxU0DCxjiDjMIRU",
+	}, SCRYPT)
+
+	var tests = []struct {
+		username, password string
+		ok                 bool
+	}{
+		{"kataras", "kataras_pass", true},
+		{"makis", "kataras_pass", true},
+		{"george", "kataras_pass", true},
+		{"kataras", "invalid_pass", false},
+		{"kataras", testScryptHash, false},
+		{"unknown", "kataras_pass", false},
+	}
+
+	for i, tt := range tests {
+		if _, ok := allow(nil, tt.username, tt.password); tt.ok != ok {
+			t.Fatalf("[%d] expected: %v but got: %v (username=%s,password=%s)", i, tt.ok, ok, tt.username, tt.password)
+		}
+	}
+
+	if !verifyScrypt(dummyScryptHash, dummyPassword) {
+		t.Fatalf("expected the dummy hash to be valid")
+	}
+
+	// The passlib's alphabet.
+	if !verifyScrypt(strings.ReplaceAll(dummyScryptHash, "+", "."), dummyPassword) {
+		t.Fatalf("expected the passlib's alphabet to be accepted")
+	}
+
+	// Composed with other schemes.
+	AllowUsers(map[string]string{"kataras": testScryptHash, "makis": testArgon2Hash}, SCRYPT, ARGON2)
+
+	for i, tt := range []struct {
+		hash     string
+		expected string
+	}{
+		{"kataras_pass", "unsupported password hash"},
+		{"$scrypt$ln=10,r=8$a2F0YXJhc19zYWx0", "malformed hash"},
+		{"$scrypt$1000:8:1$a2F0YXJhc19zYWx0$FD3RoD6z", "not a power of 2"},
+		{"$scrypt$ln=10,r=0,p=1$a2F0YXJhc19zYWx0$FD3RoD6z", "invalid parameters"},
+	} {
+		func() {
+			defer func() {
+				v := recover()
+				if v == nil {
+					t.Fatalf("[%d] expected a load error", i)
+				}
+
+				if got := v.(string); !strings.Contains(got, tt.expected) {
+					t.Fatalf("[%d] expected a load error containing: %q but got: %q", i, tt.expected, got)
+				}
+			}()
+
+			AllowUsers(map[string]string{"kataras": tt.hash}, SCRYPT, BCRYPT)
+		}()
+	}
+}
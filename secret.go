@@ -0,0 +1,86 @@
+package basicauth
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	envSecretPrefix  = "env:"
+	fileSecretPrefix = "file:"
+)
+
+// AllowUsersSecretsFile same as AllowUsersFile but each password of the
+// users file is a reference to the secret instead of the secret itself,
+// resolved once on initialization. This keeps the secrets out of the main configuration.
+//
+// The reference syntax is:
+//
+//	env:VAR       - the value of the VAR environment variable.
+//	file:/path    - the contents of the file at /path, trailing new lines are removed.
+//
+// A password without one of the above prefixes, a missing environment variable
+// or an unreadable file causes a panic on initialization.
+//
+// Example Code:
+//
+//	New(Options{Allow: AllowUsersSecretsFile("users.yml", BCRYPT)})
+//
+// The users.yml file looks like the following:
+//
+//	kataras: env:KATARAS_PASSWORD
+//	makis: file:/run/secrets/makis_password
+func AllowUsersSecretsFile(jsonOrYamlFilename string, opts ...UserAuthOption) AuthFunc {
+	return allowUsersFile(jsonOrYamlFilename, resolveSecret, opts...)
+}
+
+// resolveSecret returns the secret value of the given reference.
+// See AllowUsersSecretsFile for the reference syntax.
+func resolveSecret(ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, envSecretPrefix):
+		name := ref[len(envSecretPrefix):]
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("secret: environment variable %q is missing", name)
+		}
+
+		return value, nil
+	case strings.HasPrefix(ref, fileSecretPrefix):
+		data, err := ReadFile(ref[len(fileSecretPrefix):])
+		if err != nil {
+			return "", fmt.Errorf("secret: %w", err)
+		}
+
+		return strings.TrimRight(string(data), "\r\n"), nil
+	default:
+		return "", fmt.Errorf("secret: expected an env: or file: reference")
+	}
+}
+
+// WithSecretRing returns a UserAuthOption for single-secret setups, e.g. service accounts,
+// where the secret rotates on a schedule. Every user of the list authenticates
+// with the "current" or the "previous" secret, the stored passwords are ignored,
+// so a rotation does not break the clients which still use the previous secret mid-deploy.
+// An empty "previous" accepts the current secret only, e.g. when the rotation is completed.
+// Both secrets are compared in constant time. It panics on an empty "current" secret.
+//
+// Usage:
+//
+//	Options.Allow = AllowUsers(map[string]string{"ci-*": ""}, WithSecretRing(os.Getenv("CI_SECRET"), os.Getenv("CI_SECRET_PREVIOUS")))
+func WithSecretRing(current, previous string) UserAuthOption {
+	if current == "" {
+		panic("secret ring: empty current secret")
+	}
+
+	return WithVerifier(func(_, userPassword string) bool {
+		ok := subtle.ConstantTimeCompare([]byte(current), []byte(userPassword)) == 1
+		if previous != "" && subtle.ConstantTimeCompare([]byte(previous), []byte(userPassword)) == 1 {
+			ok = true
+		}
+
+		return ok
+	})
+}
@@ -0,0 +1,87 @@
+package basicauth
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAllowUsersSecretsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	secretFile := filepath.Join(dir, "makis_password")
+	if err = ioutil.WriteFile(secretFile, []byte("makis_pass\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("BASICAUTH_TEST_KATARAS_PASSWORD", "kataras_pass")
+	defer os.Unsetenv("BASICAUTH_TEST_KATARAS_PASSWORD")
+
+	usersFile := filepath.Join(dir, "users.yml")
+	contents := "kataras: env:BASICAUTH_TEST_KATARAS_PASSWORD\nmakis: file:" + secretFile + "\n"
+	if err = ioutil.WriteFile(usersFile, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	allow := AllowUsersSecretsFile(usersFile)
+
+	var tests = []struct {
+		username, password string
+		ok                 bool
+	}{
+		{"kataras", "kataras_pass", true},
+		{"makis", "makis_pass", true},
+		{"kataras", "env:BASICAUTH_TEST_KATARAS_PASSWORD", false},
+		{"makis", "file:" + secretFile, false},
+	}
+
+	for i, tt := range tests {
+		if _, ok := allow(nil, tt.username, tt.password); tt.ok != ok {
+			t.Fatalf("[%d] expected: %v but got: %v (username=%s,password=%s)", i, tt.ok, ok, tt.username, tt.password)
+		}
+	}
+}
+
+func TestResolveSecret(t *testing.T) {
+	for _, ref := range []string{"inline_password", "env:BASICAUTH_TEST_MISSING", "file:/missing/file"} {
+		if _, err := resolveSecret(ref); err == nil {
+			t.Fatalf("expected an error for reference: %q", ref)
+		}
+	}
+}
+
+func TestWithSecretRing(t *testing.T) {
+	allow := AllowUsers(map[string]string{"ci-*": "", "deploy": ""}, WithSecretRing("secret_v3", "secret_v2"))
+
+	var tests = []struct {
+		username, password string
+		ok                 bool
+	}{
+		{"ci-build", "secret_v3", true},
+		{"deploy", "secret_v3", true},
+		{"ci-build", "secret_v2", true}, // the previous one.
+		{"deploy", "secret_v1", false},  // an older one.
+		{"deploy", "", false},
+		{"unknown", "secret_v3", false},
+	}
+
+	for i, tt := range tests {
+		if _, ok := allow(nil, tt.username, tt.password); tt.ok != ok {
+			t.Fatalf("[%d] expected: %v but got: %v (username=%s,password=%s)", i, tt.ok, ok, tt.username, tt.password)
+		}
+	}
+
+	// Rotation completed.
+	allow = AllowUsers(map[string]string{"deploy": ""}, WithSecretRing("secret_v3", ""))
+	if _, ok := allow(nil, "deploy", "secret_v2"); ok {
+		t.Fatalf("expected the previous secret to be rejected")
+	}
+	if _, ok := allow(nil, "deploy", ""); ok {
+		t.Fatalf("expected an empty secret to be rejected")
+	}
+}
@@ -0,0 +1,55 @@
+package basicauth
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// SelfTest verifies that the Options.Allow function accepts
+// each one of the given users, e.g. on startup, to catch
+// user list field-mapping mistakes (a struct without Username and Password fields,
+// a wrong json tag and e.t.c.) before the first user request does.
+// The users are read the same way the AllowUsers reads them,
+// all of its forms are accepted.
+//
+// It only works when the plain passwords of the users are known,
+// e.g. on development, it can NOT test hashed (e.g. BCRYPT) passwords,
+// that's why the users are given here and not read from the Options.Allow.
+// The Allow function is called with an empty GET request.
+//
+// It returns one error per user which failed, or nil.
+//
+// Usage:
+//
+//	users := []User{...}
+//	b, auth := NewBasicAuth(Options{Allow: AllowUsers(users)})
+//	if errs := b.SelfTest(users); len(errs) > 0 { ... }
+func (b *BasicAuth) SelfTest(users interface{}) (errs []error) {
+	if users == nil {
+		return nil
+	}
+
+	r, err := http.NewRequest(http.MethodGet, "/", nil)
+	if err != nil {
+		return []error{err}
+	}
+
+	defer func() {
+		if v := recover(); v != nil { // unsupported type.
+			errs = append(errs, fmt.Errorf("selftest: %v", v))
+		}
+	}()
+
+	rangeUsers(users, func(id, username, password string, _ interface{}, ok bool) {
+		if !ok || username == "" || password == "" {
+			errs = append(errs, fmt.Errorf("selftest: user %s: missing username or password", id))
+			return
+		}
+
+		if _, ok := (*b.allowFn.Load())(r, username, password); !ok {
+			errs = append(errs, fmt.Errorf("selftest: user %s: %q was not allowed", id, username))
+		}
+	})
+
+	return errs
+}
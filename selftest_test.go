@@ -0,0 +1,59 @@
+package basicauth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSelfTest(t *testing.T) {
+	type (
+		user struct {
+			Username string
+			Password string
+		}
+
+		// misconfigured, the json tag hides the username field.
+		taggedUser struct {
+			Username string `json:"user"`
+			Password string `json:"password"`
+		}
+	)
+
+	users := []user{{"kataras", "kataras_pass"}, {"makis", "makis_pass"}}
+	b, _ := NewBasicAuth(Options{Allow: AllowUsers(users)})
+
+	if errs := b.SelfTest(users); len(errs) > 0 {
+		t.Fatalf("expected no errors but got: %v", errs)
+	}
+
+	taggedUsers := []taggedUser{{"kataras", "kataras_pass"}}
+	b, _ = NewBasicAuth(Options{Allow: AllowUsers(taggedUsers)})
+
+	errs := b.SelfTest(taggedUsers)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "missing username") {
+		t.Fatalf("expected a missing username error but got: %v", errs)
+	}
+
+	// Allow does not match the configured users.
+	b, _ = NewBasicAuth(Options{Allow: AllowUsers(map[string]string{"kataras": "kataras_pass"})})
+
+	errs = b.SelfTest(map[string]string{"kataras": "kataras_pass", "makis": "makis_pass"})
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), `"makis" was not allowed`) {
+		t.Fatalf("expected a not allowed error but got: %v", errs)
+	}
+
+	// The username: password form of a map[string]interface{}, mixed with the record one.
+	mapUsers := map[string]interface{}{
+		"kataras": "kataras_pass",
+		"makis":   map[string]interface{}{"password": "makis_pass", "age": 27},
+	}
+	b, _ = NewBasicAuth(Options{Allow: AllowUsers(mapUsers)})
+
+	if errs = b.SelfTest(mapUsers); len(errs) > 0 {
+		t.Fatalf("expected no errors but got: %v", errs)
+	}
+
+	if errs = b.SelfTest(42); len(errs) != 1 || !strings.Contains(errs[0].Error(), "unsupported type") {
+		t.Fatalf("expected an unsupported type error but got: %v", errs)
+	}
+}
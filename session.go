@@ -0,0 +1,281 @@
+package basicauth
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// SessionMeta holds the metadata of a stored credential,
+// recorded on its first successful login.
+// See the BasicAuth.SessionInfo method.
+type SessionMeta struct {
+	Username  string
+	ClientIP  string
+	UserAgent string
+	FirstSeen time.Time
+	// ExpiresAt is nil when the Options.MaxAge is zero.
+	ExpiresAt *time.Time
+}
+
+// credential is the value of the stored credentials.
+type credential struct {
+	expiresAt *time.Time
+	meta      SessionMeta
+	// lastIP is the client IP of the last request with this credential.
+	lastIP string
+	// rotated reports whether the credential was invalidated, see Invalidate.
+	rotated bool
+	// user is the cached user value, see Options.CacheAllow.
+	user interface{}
+	// temporary reports whether the credential was allowed through AddTemporary,
+	// it is not served from the Options.CacheAllow.
+	temporary bool
+	// elem is the element of the storing order, see Options.MaxEntries.
+	elem *list.Element
+	// localOnly reports whether the credential could not be written
+	// to the Options.Store, see StoreFailOpen.
+	localOnly bool
+}
+
+// fullUserKey returns the key of the stored credential of the given username and password:
+// the hex encoded SHA-256 hash of the (length-prefixed) username and the password,
+// so a memory dump (or the Options.Store) does not reveal the passwords.
+func fullUserKey(username, password string) string {
+	h := sha256.New()
+	var n [binary.MaxVarintLen64]byte
+	h.Write(n[:binary.PutUvarint(n[:], uint64(len(username)))])
+	h.Write([]byte(username))
+	h.Write([]byte(password))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (b *BasicAuth) newCredential(r *http.Request, username string) *credential {
+	ip := b.clientIP(r)
+	return &credential{
+		meta: SessionMeta{
+			Username:  username,
+			ClientIP:  ip,
+			UserAgent: r.UserAgent(),
+			FirstSeen: time.Now(),
+		},
+		lastIP: ip,
+	}
+}
+
+// clientIP returns the client IP of the request as string, see Options.ClientIP,
+// or the remote address as it is when it's not a valid IP.
+func (b *BasicAuth) clientIP(r *http.Request) string {
+	if b.opts.ClientIP != nil {
+		if ip := b.opts.ClientIP(r); ip != "" {
+			return ip
+		}
+	}
+
+	if ip := remoteIP(r); ip != nil {
+		return ip.String()
+	}
+
+	return r.RemoteAddr
+}
+
+// checkClientIP fires the Options.OnNewClientIP
+// when the stored credential is used from a new client IP.
+func (b *BasicAuth) checkClientIP(r *http.Request, c *credential) {
+	ip := b.clientIP(r)
+
+	b.mu.Lock()
+	changed := c.lastIP != ip
+	if changed {
+		c.lastIP = ip
+	}
+	meta := c.meta
+	b.mu.Unlock()
+
+	if changed && b.opts.OnNewClientIP != nil {
+		b.opts.OnNewClientIP(r, meta)
+	}
+}
+
+// isExpired reports whether the given stored credential has been expired,
+// see Options.IsExpired.
+// The credential's expiration can be changed by the Options.Store concurrently, see loadCredential.
+func (b *BasicAuth) isExpired(r *http.Request, user interface{}, c *credential) bool {
+	var expiresAt time.Time
+	b.mu.RLock()
+	if c.expiresAt != nil {
+		expiresAt = *c.expiresAt
+	}
+	storedAt := c.meta.FirstSeen
+	b.mu.RUnlock()
+
+	if b.opts.IsExpired != nil {
+		return b.opts.IsExpired(r, user, storedAt, expiresAt)
+	}
+
+	return !expiresAt.IsZero() && expiresAt.Before(time.Now())
+}
+
+// SessionInfo returns the metadata of the stored credentials of the given username,
+// ordered by their first-seen time. Useful for operations and anomaly detection.
+func (b *BasicAuth) SessionInfo(username string) []SessionMeta {
+	var sessions []SessionMeta
+
+	b.mu.RLock()
+	for _, c := range b.credentials {
+		if c.meta.Username == username {
+			meta := c.meta
+			if c.expiresAt != nil { // Copy, so the caller cannot modify the stored one.
+				t := *c.expiresAt
+				meta.ExpiresAt = &t
+			}
+			sessions = append(sessions, meta)
+		}
+	}
+	b.mu.RUnlock()
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].FirstSeen.Before(sessions[j].FirstSeen)
+	})
+
+	return sessions
+}
+
+// Invalidate marks the stored credentials of the given username as rotated,
+// e.g. after an admin rotated a shared password.
+// The next request with one of those credentials is rejected with the ErrCredentialsRotated error,
+// which an ErrorHandler can turn into a message telling the client to fetch the new credentials.
+// Note that a stored credential which is no longer accepted by the Options.Allow
+// is reported as rotated too, without an Invalidate call.
+//
+// It returns the number of the invalidated credentials.
+func (b *BasicAuth) Invalidate(username string) int {
+	n := 0
+
+	b.mu.Lock()
+	for _, c := range b.credentials {
+		if c.meta.Username == username && !c.rotated {
+			c.rotated = true
+			n++
+		}
+	}
+	b.mu.Unlock()
+
+	return n
+}
+
+// limitSessionsLocked reports whether the new credential of the given key and username can be stored,
+// see Options.MaxSessionsPerUser. It removes the oldest ones when the Options.EvictOldestSession is true
+// and returns their keys, so the caller can remove them from the Options.Store too.
+// The caller should hold the write lock, so concurrent logins cannot go past the limit.
+func (b *BasicAuth) limitSessionsLocked(fullUser, username string) ([]string, bool) {
+	max := b.opts.MaxSessionsPerUser
+	if max <= 0 {
+		return nil, true
+	}
+
+	type session struct {
+		key       string
+		firstSeen time.Time
+	}
+
+	var sessions []session
+	for key, c := range b.credentials {
+		// The same credential stored by a concurrent request is replaced, it does not count.
+		if key != fullUser && c.meta.Username == username && !c.rotated {
+			sessions = append(sessions, session{key, c.meta.FirstSeen})
+		}
+	}
+
+	if len(sessions) < max {
+		return nil, true
+	}
+
+	if !b.opts.EvictOldestSession {
+		return nil, false
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].firstSeen.Before(sessions[j].firstSeen)
+	})
+
+	evicted := make([]string, 0, len(sessions)-max+1)
+	for _, s := range sessions[:len(sessions)-max+1] {
+		b.removeCredentialLocked(s.key)
+		evicted = append(evicted, s.key)
+	}
+
+	return evicted, true
+}
+
+// cachedUser returns the cached user value of the given stored credential
+// and reports whether it is still valid, see Options.CacheAllow.
+func (b *BasicAuth) cachedUser(fullUser string) (interface{}, bool) {
+	if !b.opts.CacheAllow {
+		return nil, false
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	c, ok := b.credentials[fullUser]
+	if !ok || c.rotated || c.temporary || c.expiresAt == nil || !c.expiresAt.After(time.Now()) {
+		return nil, false
+	}
+
+	return c.user, true
+}
+
+// takeCredential removes the stored credential of the given key
+// and reports whether it was there.
+func (b *BasicAuth) takeCredential(fullUser string) bool {
+	b.mu.Lock()
+	_, ok := b.credentials[fullUser]
+	if ok {
+		b.removeCredentialLocked(fullUser)
+	}
+	b.mu.Unlock()
+	b.deleteCredential(fullUser)
+
+	return ok
+}
+
+// Reset removes all the stored credentials, so their sessions start over on the next request:
+// the expiration (see Options.MaxAge), the session metadata and the Options.CacheAllow users are dropped.
+// The credentials of this instance are removed from the Options.Store too,
+// the ones stored only by other instances are kept, as the store cannot list its keys.
+// Useful for tests and admin operations, when a full wipe is needed
+// without recreating the middleware.
+func (b *BasicAuth) Reset() {
+	b.mu.Lock()
+	var keys []string
+	if b.opts.Store != nil {
+		keys = make([]string, 0, len(b.credentials))
+		for key := range b.credentials {
+			keys = append(keys, key)
+		}
+	}
+
+	b.credentials = make(map[string]*credential)
+	if b.order != nil {
+		b.order = list.New()
+	}
+	b.mu.Unlock()
+
+	for _, key := range keys {
+		b.deleteCredential(key)
+	}
+}
+
+// Len returns the number of the stored credentials.
+func (b *BasicAuth) Len() int {
+	b.mu.RLock()
+	n := len(b.credentials)
+	b.mu.RUnlock()
+
+	return n
+}
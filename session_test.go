@@ -0,0 +1,381 @@
+package basicauth
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSessionInfo(t *testing.T) {
+	var alerts []SessionMeta
+	b, auth := NewBasicAuth(Options{
+		Allow:  AllowUsers(map[string]string{"kataras": "kataras_pass", "makis": "makis_pass"}),
+		MaxAge: time.Hour,
+		OnNewClientIP: func(r *http.Request, meta SessionMeta) {
+			alerts = append(alerts, meta)
+		},
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	withRemoteAddr := func(addr string) requestOption {
+		return func(r *http.Request) error {
+			r.RemoteAddr = addr
+			return nil
+		}
+	}
+
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass"),
+		withRemoteAddr("10.0.0.1:1234"), withHeader("User-Agent", "test-agent")).statusCode(http.StatusOK)
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("makis", "makis_pass"),
+		withRemoteAddr("10.0.0.2:1234")).statusCode(http.StatusOK)
+
+	sessions := b.SessionInfo("kataras")
+	if expected, got := 1, len(sessions); expected != got {
+		t.Fatalf("expected %d session but got: %d", expected, got)
+	}
+
+	meta := sessions[0]
+	if meta.Username != "kataras" || meta.ClientIP != "10.0.0.1" || meta.UserAgent != "test-agent" {
+		t.Fatalf("unexpected session metadata: %#+v", meta)
+	}
+	if meta.FirstSeen.IsZero() || meta.ExpiresAt == nil || !meta.ExpiresAt.After(meta.FirstSeen) {
+		t.Fatalf("unexpected session times: %#+v", meta)
+	}
+
+	// A copy, the stored expiration cannot be modified through it.
+	expiresAt := *meta.ExpiresAt
+	*meta.ExpiresAt = time.Time{}
+	if got := b.SessionInfo("kataras")[0].ExpiresAt; !got.Equal(expiresAt) {
+		t.Fatalf("expected the stored expiration: %s but got: %s", expiresAt, got)
+	}
+
+	if len(alerts) != 0 {
+		t.Fatalf("expected no alerts but got: %#+v", alerts)
+	}
+
+	// Same credential, same IP, no alert.
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass"),
+		withRemoteAddr("10.0.0.1:4321")).statusCode(http.StatusOK)
+	// Same credential, new IP, alert with the first-seen metadata.
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass"),
+		withRemoteAddr("[::1]:4321")).statusCode(http.StatusOK)
+
+	if expected, got := 1, len(alerts); expected != got {
+		t.Fatalf("expected %d alert but got: %d", expected, got)
+	}
+	if alerts[0].ClientIP != "10.0.0.1" {
+		t.Fatalf("expected alert with the first-seen client IP but got: %#+v", alerts[0])
+	}
+
+	if sessions = b.SessionInfo("invalid"); len(sessions) != 0 {
+		t.Fatalf("expected no sessions but got: %#+v", sessions)
+	}
+}
+
+func TestInvalidate(t *testing.T) {
+	users := map[string]string{"kataras": "kataras_pass", "makis": "makis_pass"}
+
+	var rotated []string
+	b, auth := NewBasicAuth(Options{
+		Allow: func(r *http.Request, username, password string) (interface{}, bool) {
+			pass, ok := users[username]
+			return nil, ok && pass == password
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			if e, ok := err.(ErrCredentialsRotated); ok {
+				rotated = append(rotated, e.Username)
+			}
+			DefaultErrorHandler(w, r, err)
+		},
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).statusCode(http.StatusOK)
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("makis", "makis_pass")).statusCode(http.StatusOK)
+
+	// Explicit invalidation.
+	if expected, got := 1, b.Invalidate("kataras"); expected != got {
+		t.Fatalf("expected %d invalidated credential but got: %d", expected, got)
+	}
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).statusCode(http.StatusUnauthorized)
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).statusCode(http.StatusOK) // re-authenticated.
+
+	// The password was rotated on the backend.
+	users["makis"] = "makis_new_pass"
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("makis", "makis_pass")).statusCode(http.StatusUnauthorized)
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("makis", "makis_pass")).statusCode(http.StatusUnauthorized) // a plain invalid one now.
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("makis", "makis_new_pass")).statusCode(http.StatusOK)
+
+	if expected := []string{"kataras", "makis"}; !reflect.DeepEqual(expected, rotated) {
+		t.Fatalf("expected rotated errors for: %v but got: %v", expected, rotated)
+	}
+}
+
+func TestCacheAllow(t *testing.T) {
+	var calls int
+	allow := AllowUsers(map[string]string{"kataras": "kataras_pass"})
+
+	b, auth := NewBasicAuth(Options{
+		Allow: func(r *http.Request, username, password string) (interface{}, bool) {
+			calls++
+			return allow(r, username, password)
+		},
+		MaxAge:     100 * time.Millisecond,
+		CacheAllow: true,
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(GetUser(r).(*SimpleUser).Username))
+	}))
+
+	for i := 0; i < 3; i++ {
+		testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).
+			statusCode(http.StatusOK).bodyEq("kataras")
+	}
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "invalid_pass")).
+		statusCode(http.StatusUnauthorized)
+
+	if expected := 2; calls != expected {
+		t.Fatalf("expected Allow calls: %d but got: %d", expected, calls)
+	}
+
+	time.Sleep(120 * time.Millisecond) // expired, Allow is called again.
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).
+		statusCode(http.StatusUnauthorized) // expired.
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).
+		statusCode(http.StatusOK)
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).
+		statusCode(http.StatusOK)
+
+	if expected := 4; calls != expected {
+		t.Fatalf("expected Allow calls: %d but got: %d", expected, calls)
+	}
+
+	b.Invalidate("kataras")
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).
+		statusCode(http.StatusUnauthorized)
+}
+
+func TestReset(t *testing.T) {
+	b, auth := NewBasicAuth(Options{
+		Allow: AllowUsers(map[string]string{"kataras": "kataras_pass", "makis": "makis_pass"}),
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).statusCode(http.StatusOK)
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("makis", "makis_pass")).statusCode(http.StatusOK)
+
+	if expected, got := 2, b.Len(); expected != got {
+		t.Fatalf("expected %d stored credentials but got: %d", expected, got)
+	}
+
+	b.Reset()
+	if expected, got := 0, b.Len(); expected != got {
+		t.Fatalf("expected %d stored credentials but got: %d", expected, got)
+	}
+
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).statusCode(http.StatusOK)
+	if expected, got := 1, b.Len(); expected != got {
+		t.Fatalf("expected %d stored credentials but got: %d", expected, got)
+	}
+}
+
+func TestResetStore(t *testing.T) {
+	store := newTestStore(nil)
+	b, auth := NewBasicAuth(Options{
+		Allow:  AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		MaxAge: time.Hour,
+		Store:  store,
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).statusCode(http.StatusOK)
+	expiresAt := *b.SessionInfo("kataras")[0].ExpiresAt
+
+	b.Reset()
+	if expected, got := 0, store.Len(); expected != got {
+		t.Fatalf("expected %d credentials in the store but got: %d", expected, got)
+	}
+
+	// A new session, not restored from the store with its old expiration.
+	time.Sleep(time.Millisecond)
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).statusCode(http.StatusOK)
+	if sessions := b.SessionInfo("kataras"); len(sessions) != 1 || !sessions[0].ExpiresAt.After(expiresAt) {
+		t.Fatalf("expected a new session but got: %v", sessions)
+	}
+}
+
+func TestIsExpired(t *testing.T) {
+	var revokedSince atomic.Int64 // unix nanoseconds.
+
+	_, auth := NewBasicAuth(Options{
+		Allow:  AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		MaxAge: time.Hour,
+		IsExpired: func(r *http.Request, user interface{}, storedAt, expiresAt time.Time) bool {
+			if user.(*SimpleUser).Username != "kataras" {
+				t.Fatalf("expected the authenticated user but got: %#+v", user)
+			}
+
+			return !storedAt.After(time.Unix(0, revokedSince.Load())) || expiresAt.Before(time.Now())
+		},
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).statusCode(http.StatusOK)
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).statusCode(http.StatusOK)
+
+	// Revoke all credentials stored until now, despite their future expiration.
+	revokedSince.Store(time.Now().UnixNano())
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).statusCode(http.StatusUnauthorized)
+	// Stored again, after the revocation.
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).statusCode(http.StatusOK)
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).statusCode(http.StatusOK)
+}
+
+func TestFullUserKey(t *testing.T) {
+	b, auth := NewBasicAuth(Options{
+		Allow:               AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		MaxAge:              time.Hour,
+		CredentialSeparator: ';',
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	testHandler(t, handler, http.MethodGet, "/", withHeader("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("kataras;kataras_pass")))).
+		statusCode(http.StatusOK)
+
+	b.mu.RLock()
+	for key := range b.credentials {
+		if strings.Contains(key, "kataras") {
+			t.Fatalf("expected a hashed key but got: %q", key)
+		}
+
+		if expected := fullUserKey("kataras", "kataras_pass"); expected != key {
+			t.Fatalf("expected key: %q but got: %q", expected, key)
+		}
+	}
+	b.mu.RUnlock()
+
+	// The username and password boundary is part of the key.
+	if fullUserKey("a:b", "c") == fullUserKey("a", "b:c") {
+		t.Fatalf("expected different keys for different usernames")
+	}
+}
+
+func TestMaxSessionsPerUser(t *testing.T) {
+	// A user with more than one valid passwords, e.g. app passwords.
+	allow := func(r *http.Request, username, password string) (interface{}, bool) {
+		return nil, username == "kataras" && strings.HasPrefix(password, "app_pass_")
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	for _, evict := range []bool{false, true} {
+		b, auth := NewBasicAuth(Options{
+			Allow:              allow,
+			MaxAge:             time.Hour,
+			MaxSessionsPerUser: 2,
+			EvictOldestSession: evict,
+		})
+
+		testHandler(t, auth(handler), http.MethodGet, "/", withBasicAuth("kataras", "app_pass_1")).statusCode(http.StatusOK)
+		time.Sleep(time.Millisecond) // distinct first-seen times.
+		testHandler(t, auth(handler), http.MethodGet, "/", withBasicAuth("kataras", "app_pass_2")).statusCode(http.StatusOK)
+		// The existing sessions are not affected.
+		testHandler(t, auth(handler), http.MethodGet, "/", withBasicAuth("kataras", "app_pass_1")).statusCode(http.StatusOK)
+
+		if evict {
+			testHandler(t, auth(handler), http.MethodGet, "/", withBasicAuth("kataras", "app_pass_3")).statusCode(http.StatusOK)
+
+			b.mu.RLock()
+			_, first := b.credentials[fullUserKey("kataras", "app_pass_1")]
+			_, third := b.credentials[fullUserKey("kataras", "app_pass_3")]
+			b.mu.RUnlock()
+			if first || !third {
+				t.Fatalf("expected the first session to be evicted by the third one")
+			}
+		} else {
+			testHandler(t, auth(handler), http.MethodGet, "/", withBasicAuth("kataras", "app_pass_3")).statusCode(http.StatusForbidden)
+		}
+
+		if expected, got := 2, len(b.SessionInfo("kataras")); expected != got {
+			t.Fatalf("[evict=%v] expected %d sessions but got: %d", evict, expected, got)
+		}
+	}
+}
+
+func TestMaxSessionsPerUserConcurrent(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	b, auth := NewBasicAuth(Options{
+		Allow: func(r *http.Request, username, password string) (interface{}, bool) {
+			return nil, username == "kataras" && strings.HasPrefix(password, "app_pass_")
+		},
+		MaxAge:             time.Hour,
+		MaxSessionsPerUser: 2,
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	var (
+		wg      sync.WaitGroup
+		allowed int32
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.SetBasicAuth("kataras", fmt.Sprintf("app_pass_%d", i))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code == http.StatusOK {
+				atomic.AddInt32(&allowed, 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if expected, got := 2, len(b.SessionInfo("kataras")); expected != got {
+		t.Fatalf("expected %d sessions but got: %d", expected, got)
+	}
+	if expected, got := int32(2), atomic.LoadInt32(&allowed); expected != got {
+		t.Fatalf("expected %d allowed logins but got: %d", expected, got)
+	}
+}
+
+func TestMaxSessionsPerUserStoreFailure(t *testing.T) {
+	store := newTestStore(nil)
+	b, auth := NewBasicAuth(Options{
+		Allow: func(r *http.Request, username, password string) (interface{}, bool) {
+			return nil, username == "kataras" && strings.HasPrefix(password, "app_pass_")
+		},
+		MaxAge:             time.Hour,
+		MaxSessionsPerUser: 1,
+		EvictOldestSession: true,
+		Store:              store,
+		StoreFailurePolicy: StoreFailClosed,
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "app_pass_1")).statusCode(http.StatusOK)
+
+	store.mu.Lock()
+	store.err = errors.New("connection refused")
+	store.mu.Unlock()
+
+	// The new session is rejected and the existing one is not evicted.
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "app_pass_2")).statusCode(http.StatusServiceUnavailable)
+	if sessions := b.SessionInfo("kataras"); len(sessions) != 1 {
+		t.Fatalf("expected the existing session to be kept but got: %v", sessions)
+	}
+	if _, ok := store.Get(fullUserKey("kataras", "app_pass_1")); !ok {
+		t.Fatalf("expected the existing session to be kept in the store")
+	}
+}
@@ -0,0 +1,284 @@
+package basicauth
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CredentialStore is an external storage of the credentials expiration,
+// e.g. a Redis-backed one, which is shared across multiple instances of the application.
+// The keys are the stored credentials keys and the values their expiration time
+// (nil when the Options.MaxAge is zero).
+// See the Options.Store field.
+type CredentialStore interface {
+	// Get returns the expiration time of the given key and reports whether it exists.
+	Get(key string) (*time.Time, bool)
+	// Set stores the given key with its expiration time.
+	// A non-nil error (e.g. the store is unreachable) is handled
+	// by the Options.StoreFailurePolicy.
+	Set(key string, expiresAt *time.Time) error
+	// Delete removes the given key, if exists.
+	Delete(key string)
+	// GC removes the keys expired before "now" and returns their number.
+	GC(now time.Time) int
+}
+
+// StoreFailurePolicy is the behavior of the middleware
+// when the CredentialStore fails to store a credential.
+// See the Options.StoreFailurePolicy field.
+type StoreFailurePolicy uint8
+
+const (
+	// StoreFailOpen authenticates the request anyway and logs the error through the Options.ErrorLogger,
+	// the credential is kept locally only.
+	StoreFailOpen StoreFailurePolicy = iota
+	// StoreFailClosed rejects the request with an ErrStoreUnavailable error (503 Service Unavailable).
+	StoreFailClosed
+)
+
+// String returns the text representation of the store failure policy.
+func (p StoreFailurePolicy) String() string {
+	switch p {
+	case StoreFailOpen:
+		return "fail-open"
+	case StoreFailClosed:
+		return "fail-closed"
+	default:
+		return "unknown"
+	}
+}
+
+// MemoryStore is an in-process CredentialStore, backed by a map.
+// It can be shared across multiple BasicAuth instances of the same process
+// and it is a reference for custom (e.g. Redis-backed) implementations.
+// It implements the AttemptStore too.
+// It is safe for concurrent use.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	entries  map[string]*time.Time
+	attempts map[string]*attempt
+}
+
+// attempt is a server-side failures counter of the MemoryStore.
+type attempt struct {
+	tries       int
+	lockedUntil time.Time
+	expiresAt   time.Time
+}
+
+var (
+	_ CredentialStore = (*MemoryStore)(nil)
+	_ AttemptStore    = (*MemoryStore)(nil)
+)
+
+// NewMemoryStore returns a new empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries:  make(map[string]*time.Time),
+		attempts: make(map[string]*attempt),
+	}
+}
+
+// Get returns the expiration time of the given key and reports whether it exists.
+func (s *MemoryStore) Get(key string) (*time.Time, bool) {
+	s.mu.RLock()
+	expiresAt, ok := s.entries[key]
+	s.mu.RUnlock()
+	return expiresAt, ok
+}
+
+// Set stores the given key with its expiration time. It never fails.
+func (s *MemoryStore) Set(key string, expiresAt *time.Time) error {
+	s.mu.Lock()
+	s.entries[key] = expiresAt
+	s.mu.Unlock()
+	return nil
+}
+
+// Delete removes the given key, if exists.
+func (s *MemoryStore) Delete(key string) {
+	s.mu.Lock()
+	delete(s.entries, key)
+	s.mu.Unlock()
+}
+
+// GC removes the keys expired before "now" and returns their number.
+// The keys without expiration are kept. The expired failures counters are removed too.
+func (s *MemoryStore) GC(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for key, expiresAt := range s.entries {
+		if expiresAt != nil && expiresAt.Before(now) {
+			delete(s.entries, key)
+			n++
+		}
+	}
+
+	for key, a := range s.attempts {
+		if a.expiresAt.Before(now) {
+			delete(s.attempts, key)
+		}
+	}
+
+	return n
+}
+
+// GetAttempts returns the failures of the given key
+// and the end of its lockout window, if any.
+func (s *MemoryStore) GetAttempts(key string) (int, time.Time) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	a, ok := s.attempts[key]
+	if !ok || a.expiresAt.Before(time.Now()) {
+		return 0, time.Time{}
+	}
+
+	return a.tries, a.lockedUntil
+}
+
+// IncrAttempts increments the failures of the given key and returns the new amount.
+// It never fails.
+func (s *MemoryStore) IncrAttempts(key string, ttl time.Duration) (int, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.attempts[key]
+	if !ok || a.expiresAt.Before(now) {
+		a = new(attempt)
+		s.attempts[key] = a
+	}
+	a.tries++
+	a.expiresAt = now.Add(ttl)
+
+	return a.tries, nil
+}
+
+// LockAttempts sets the end of the lockout window of the given key, if exists.
+// It never fails.
+func (s *MemoryStore) LockAttempts(key string, until time.Time) error {
+	s.mu.Lock()
+	if a, ok := s.attempts[key]; ok {
+		a.lockedUntil = until
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// ResetAttempts removes the failures of the given key, if any.
+func (s *MemoryStore) ResetAttempts(key string) {
+	s.mu.Lock()
+	delete(s.attempts, key)
+	s.mu.Unlock()
+}
+
+// Len returns the number of the stored keys.
+func (s *MemoryStore) Len() int {
+	s.mu.RLock()
+	n := len(s.entries)
+	s.mu.RUnlock()
+	return n
+}
+
+// loadCredential reconciles the local credential of the given key with the Options.Store, if any,
+// and returns the one to use: a credential which is missing from the store
+// (e.g. logged out through another instance) is removed locally too
+// and a credential which is stored by another instance is restored locally with its expiration.
+func (b *BasicAuth) loadCredential(r *http.Request, key, username string, c *credential, ok bool) (*credential, bool) {
+	if b.opts.Store == nil {
+		return c, ok
+	}
+
+	if ok {
+		b.mu.RLock()
+		localOnly, expiresAt := c.localOnly, c.expiresAt
+		b.mu.RUnlock()
+
+		if localOnly { // The store failed on login, retry.
+			if b.opts.Store.Set(key, expiresAt) == nil {
+				b.mu.Lock()
+				c.localOnly = false
+				b.mu.Unlock()
+			}
+
+			return c, true
+		}
+	}
+
+	expiresAt, found := b.opts.Store.Get(key)
+	if !found {
+		if ok {
+			b.mu.Lock()
+			b.removeCredentialLocked(key)
+			b.mu.Unlock()
+		}
+
+		return nil, false
+	}
+
+	var (
+		evicted string
+		stored  = true
+	)
+
+	b.mu.Lock()
+	if !ok {
+		c = b.newCredential(r, username)
+		evicted, stored = b.putCredentialLocked(key, c)
+	}
+	c.expiresAt = expiresAt
+	b.mu.Unlock()
+
+	if evicted != "" {
+		b.deleteCredential(evicted)
+	}
+
+	if !stored { // Still valid, with the expiration of the store.
+		b.logNotStored(r, username)
+	}
+
+	return c, true
+}
+
+// storeCredential writes the new credential to the Options.Store, if any,
+// and reports whether the request should continue, see Options.StoreFailurePolicy.
+func (b *BasicAuth) storeCredential(w http.ResponseWriter, r *http.Request, key, username string, c *credential) bool {
+	if b.opts.Store == nil {
+		return true
+	}
+
+	err := b.opts.Store.Set(key, c.expiresAt)
+	if err == nil {
+		return true
+	}
+
+	storeErr := ErrStoreUnavailable{Username: username, Err: err}
+	if b.opts.StoreFailurePolicy == StoreFailClosed {
+		b.handleError(w, r, storeErr)
+		return false
+	}
+
+	c.localOnly = true
+
+	if b.opts.ErrorLogger != nil {
+		if id := b.correlationID(r); id != "" {
+			b.opts.ErrorLogger.Printf("[%s] %v (%s)", id, storeErr, b.opts.StoreFailurePolicy)
+		} else {
+			b.opts.ErrorLogger.Printf("%v (%s)", storeErr, b.opts.StoreFailurePolicy)
+		}
+	}
+
+	return true
+}
+
+// deleteCredential removes the given key from the Options.Store, if any.
+func (b *BasicAuth) deleteCredential(key string) {
+	if b.opts.Store != nil {
+		b.opts.Store.Delete(key)
+	}
+}
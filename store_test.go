@@ -0,0 +1,278 @@
+package basicauth
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testStore is a CredentialStore which records its keys and fails on Set when "err" is not nil.
+type testStore struct {
+	mu   sync.Mutex
+	keys map[string]*time.Time
+	err  error
+}
+
+func newTestStore(err error) *testStore {
+	return &testStore{keys: make(map[string]*time.Time), err: err}
+}
+
+func (s *testStore) Get(key string) (*time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	exp, ok := s.keys[key]
+	return exp, ok
+}
+
+func (s *testStore) Set(key string, expiresAt *time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+
+	s.keys[key] = expiresAt
+	return nil
+}
+
+func (s *testStore) Delete(key string) {
+	s.mu.Lock()
+	delete(s.keys, key)
+	s.mu.Unlock()
+}
+
+func (s *testStore) GC(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for key, exp := range s.keys {
+		if exp != nil && exp.Before(now) {
+			delete(s.keys, key)
+			n++
+		}
+	}
+
+	return n
+}
+
+func (s *testStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.keys)
+}
+
+func TestStore(t *testing.T) {
+	store := newTestStore(nil)
+	auth := New(Options{
+		Allow:  AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		MaxAge: time.Minute,
+		Store:  store,
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/logout" {
+			Logout(r)
+		}
+	}))
+
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).statusCode(http.StatusOK)
+	if exp, ok := store.Get(fullUserKey("kataras", "kataras_pass")); !ok || exp == nil {
+		t.Fatalf("expected a stored credential with expiration but got: %v, %v", exp, ok)
+	}
+
+	testHandler(t, handler, http.MethodGet, "/logout", withBasicAuth("kataras", "kataras_pass")).statusCode(http.StatusOK)
+	if expected, got := 0, store.Len(); expected != got {
+		t.Fatalf("expected %d stored credentials after logout but got: %d", expected, got)
+	}
+}
+
+func TestStoreFailurePolicy(t *testing.T) {
+	storeErr := errors.New("connection refused")
+
+	var tests = []struct {
+		policy       StoreFailurePolicy
+		expectedCode int
+		// the expected number of the local credentials.
+		expectedLen int
+	}{
+		{StoreFailOpen, http.StatusOK, 1},
+		{StoreFailClosed, http.StatusServiceUnavailable, 0},
+	}
+
+	for _, tt := range tests {
+		var (
+			logs   bytes.Buffer
+			reason error
+		)
+
+		b, auth := NewBasicAuth(Options{
+			Allow:              AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+			Store:              newTestStore(storeErr),
+			StoreFailurePolicy: tt.policy,
+			ErrorLogger:        log.New(&logs, "", 0),
+			ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+				reason = err
+				DefaultErrorHandler(w, r, err)
+			},
+		})
+		handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+		testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).statusCode(tt.expectedCode)
+
+		if !strings.Contains(logs.String(), "store: unavailable for <kataras>: connection refused") {
+			t.Fatalf("[%s] expected the store error to be logged but got: %q", tt.policy, logs.String())
+		}
+
+		if expected, got := tt.expectedLen, b.Len(); expected != got {
+			t.Fatalf("[%s] expected %d local credentials but got: %d", tt.policy, expected, got)
+		}
+
+		if tt.policy == StoreFailClosed {
+			if !errors.Is(reason, storeErr) {
+				t.Fatalf("[%s] expected the store error as the reason but got: %v", tt.policy, reason)
+			}
+		} else if reason != nil {
+			t.Fatalf("[%s] expected no error handler call but got: %v", tt.policy, reason)
+		}
+	}
+}
+
+func TestMemoryStoreShared(t *testing.T) {
+	store := NewMemoryStore()
+	newAuth := func() (*BasicAuth, http.Handler) {
+		b, auth := NewBasicAuth(Options{
+			Allow:  AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+			MaxAge: time.Minute,
+			Store:  store,
+		})
+		return b, auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/logout" {
+				Logout(r)
+			}
+		}))
+	}
+
+	key := fullUserKey("kataras", "kataras_pass")
+	a, handlerA := newAuth()
+	b, handlerB := newAuth()
+
+	testHandler(t, handlerA, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).statusCode(http.StatusOK)
+	expiresAt, ok := store.Get(key)
+	if !ok || expiresAt == nil {
+		t.Fatalf("expected a stored credential with expiration but got: %v, %v", expiresAt, ok)
+	}
+
+	// Restored through the store, with the same expiration.
+	testHandler(t, handlerB, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).statusCode(http.StatusOK)
+	if sessions := b.SessionInfo("kataras"); len(sessions) != 1 || !sessions[0].ExpiresAt.Equal(*expiresAt) {
+		t.Fatalf("expected the credential to be restored with expiration: %s but got: %v", expiresAt, sessions)
+	}
+
+	// Logged out through the first instance, the second one logs in again.
+	testHandler(t, handlerA, http.MethodGet, "/logout", withBasicAuth("kataras", "kataras_pass")).statusCode(http.StatusOK)
+	if expected, got := 0, store.Len(); expected != got {
+		t.Fatalf("expected %d stored credentials after logout but got: %d", expected, got)
+	}
+	testHandler(t, handlerB, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).statusCode(http.StatusOK)
+	if _, ok = store.Get(key); !ok {
+		t.Fatalf("expected the credential to be stored again")
+	}
+
+	// Expired through the store.
+	past := time.Now().Add(-time.Second)
+	store.Set(key, &past)
+	testHandler(t, handlerA, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).statusCode(http.StatusUnauthorized)
+	if _, ok = store.Get(key); ok {
+		t.Fatalf("expected the expired credential to be removed from the store")
+	}
+
+	// The GC runs on the store too.
+	store.Set("stale", &past)
+	store.Set("forever", nil)
+	a.gc()
+	if _, ok = store.Get("stale"); ok {
+		t.Fatalf("expected the expired key to be removed by the GC")
+	}
+	if _, ok = store.Get("forever"); !ok {
+		t.Fatalf("expected the key without expiration to be kept by the GC")
+	}
+}
+
+func TestStoreFailOpenRetry(t *testing.T) {
+	store := newTestStore(errors.New("connection refused"))
+	auth := New(Options{
+		Allow:       AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		Store:       store,
+		ErrorLogger: log.New(io.Discard, "", 0),
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).statusCode(http.StatusOK)
+	if expected, got := 0, store.Len(); expected != got {
+		t.Fatalf("expected %d stored credentials but got: %d", expected, got)
+	}
+
+	store.mu.Lock()
+	store.err = nil
+	store.mu.Unlock()
+
+	// The local only credential is written to the store when it is available again.
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).statusCode(http.StatusOK)
+	if expected, got := 1, store.Len(); expected != got {
+		t.Fatalf("expected %d stored credentials but got: %d", expected, got)
+	}
+}
+
+// Run with -race.
+func TestStoreConcurrent(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	store := NewMemoryStore()
+	b, auth := NewBasicAuth(Options{
+		Allow:  AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		MaxAge: time.Minute,
+		Store:  store,
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).statusCode(http.StatusOK)
+
+	var (
+		wg    sync.WaitGroup
+		codes = make(chan int, 8*50)
+	)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 50; j++ {
+				r := httptest.NewRequest(http.MethodGet, "/", nil)
+				r.SetBasicAuth("kataras", "kataras_pass")
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, r)
+				codes <- w.Code
+				b.SessionInfo("kataras")
+			}
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	for code := range codes {
+		if code != http.StatusOK {
+			t.Fatalf("expected status code: %d but got: %d", http.StatusOK, code)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package basicauth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"time"
+)
+
+// temporaryCredential holds a credential registered through AddTemporary.
+type temporaryCredential struct {
+	password  string
+	expiresAt time.Time // zero means no time limit.
+	usesLeft  int       // zero or negative means unlimited uses.
+}
+
+// AddTemporary registers a time-limited and/or single-use credential,
+// useful for sharing temporary access. The temporary credentials
+// are checked before the Options.Allow field, so they combine with the normal users.
+//
+// The entry self-destructs after "maxUses" successful logins
+// or after "ttl" duration, whichever comes first.
+// A zero ttl means no time limit and a zero maxUses means unlimited uses,
+// at least one of them should be set, otherwise an error is returned.
+// Adding a temporary credential with an existing username replaces the previous one.
+//
+// Note that each request with valid credentials counts as a use,
+// as the basic authentication sends the credentials on every request.
+// The temporary credentials are never served from the Options.CacheAllow.
+//
+// Usage:
+//
+//	b, auth := basicauth.NewBasicAuth(opts)
+//	b.AddTemporary("guest", "one_time_password", 24*time.Hour, 1)
+func (b *BasicAuth) AddTemporary(username, password string, ttl time.Duration, maxUses int) error {
+	if ttl <= 0 && maxUses <= 0 {
+		return errors.New("BasicAuth: AddTemporary: a ttl or a maxUses is required")
+	}
+
+	c := &temporaryCredential{
+		password: password,
+		usesLeft: maxUses,
+	}
+	if ttl > 0 {
+		c.expiresAt = time.Now().Add(ttl)
+	}
+
+	b.temporaryMu.Lock()
+	if b.temporary == nil {
+		b.temporary = make(map[string]*temporaryCredential)
+	}
+	b.temporary[username] = c
+	b.temporaryMu.Unlock()
+
+	return nil
+}
+
+// useTemporary reports whether the given username and password
+// match a temporary credential and consumes one use of it.
+func (b *BasicAuth) useTemporary(username, password string) bool {
+	b.temporaryMu.Lock()
+	defer b.temporaryMu.Unlock()
+
+	c, ok := b.temporary[username]
+	if !ok {
+		return false
+	}
+
+	if !c.expiresAt.IsZero() && c.expiresAt.Before(time.Now()) {
+		delete(b.temporary, username)
+		return false
+	}
+
+	if subtle.ConstantTimeCompare([]byte(c.password), []byte(password)) != 1 {
+		return false
+	}
+
+	if c.usesLeft > 0 {
+		c.usesLeft--
+		if c.usesLeft == 0 {
+			delete(b.temporary, username)
+		}
+	}
+
+	return true
+}
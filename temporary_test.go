@@ -0,0 +1,80 @@
+package basicauth
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAddTemporary(t *testing.T) {
+	b, auth := NewBasicAuth(Options{
+		Allow: AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+	})
+
+	b.AddTemporary("guest", "one_time_pass", 0, 1)
+	b.AddTemporary("visitor", "visitor_pass", 50*time.Millisecond, 0)
+
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(GetUser(r).(*SimpleUser).Username))
+	}))
+
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("guest", "invalid_pass")).
+		statusCode(http.StatusUnauthorized)
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("guest", "one_time_pass")).
+		statusCode(http.StatusOK).bodyEq("guest")
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("guest", "one_time_pass")).
+		statusCode(http.StatusUnauthorized)
+
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("visitor", "visitor_pass")).
+		statusCode(http.StatusOK).bodyEq("visitor")
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("visitor", "visitor_pass")).
+		statusCode(http.StatusOK).bodyEq("visitor")
+	time.Sleep(60 * time.Millisecond)
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("visitor", "visitor_pass")).
+		statusCode(http.StatusUnauthorized)
+
+	// The normal users are still allowed.
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).
+		statusCode(http.StatusOK).bodyEq("kataras")
+}
+
+func TestAddTemporaryCacheAllow(t *testing.T) {
+	b, auth := NewBasicAuth(Options{
+		Allow:      AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		MaxAge:     time.Hour,
+		CacheAllow: true,
+	})
+
+	if err := b.AddTemporary("guest", "one_time_pass", 0, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.AddTemporary("visitor", "visitor_pass", 50*time.Millisecond, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// The one-time credential is not served from the cache on its second use.
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("guest", "one_time_pass")).
+		statusCode(http.StatusOK)
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("guest", "one_time_pass")).
+		statusCode(http.StatusUnauthorized)
+
+	// The time-limited credential expires before the MaxAge.
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("visitor", "visitor_pass")).
+		statusCode(http.StatusOK)
+	time.Sleep(60 * time.Millisecond)
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("visitor", "visitor_pass")).
+		statusCode(http.StatusUnauthorized)
+
+	// The normal users are still cached.
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).
+		statusCode(http.StatusOK)
+	if _, ok := b.cachedUser(fullUserKey("kataras", "kataras_pass")); !ok {
+		t.Fatalf("expected the normal user to be cached")
+	}
+
+	if err := b.AddTemporary("forever", "forever_pass", 0, 0); err == nil {
+		t.Fatalf("expected an error for a temporary credential without ttl and maxUses")
+	}
+}
@@ -92,6 +92,17 @@ func (te *testie) headerEq(key, expected string) *testie {
 	return te
 }
 
+func (te *testie) cookie(name string) *http.Cookie {
+	for _, c := range te.resp.Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+
+	te.fatalf("expected cookie %q to be set", name)
+	return nil
+}
+
 func testHandler(t *testing.T, handler http.Handler, method, url string, reqOpts ...requestOption) *testie {
 	t.Helper()
 
@@ -149,6 +160,13 @@ func withHeader(key string, value string) requestOption {
 	}
 }
 
+func withCookie(c *http.Cookie) requestOption {
+	return func(r *http.Request) error {
+		r.AddCookie(c)
+		return nil
+	}
+}
+
 func withBasicAuth(username, password string) requestOption {
 	return func(r *http.Request) error {
 		r.SetBasicAuth(username, password)
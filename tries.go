@@ -0,0 +1,164 @@
+package basicauth
+
+import (
+	"net/http"
+	"time"
+)
+
+// MaxTriesBy is the key of the sign in failures counter, see the Options.MaxTriesBy field.
+// The ByIP and ByUsername can be combined, e.g. ByIP|ByUsername.
+type MaxTriesBy uint8
+
+const (
+	// ByCookie keeps the failures counter on the client side, see Options.MaxTriesCookie.
+	// It is the default one, note that the client can delete the cookie.
+	ByCookie MaxTriesBy = 0
+	// ByIP keeps the failures counter on the server side, per client IP.
+	ByIP MaxTriesBy = 1
+	// ByUsername keeps the failures counter on the server side, per username.
+	ByUsername MaxTriesBy = 2
+)
+
+// String returns the text representation of the tries key.
+func (by MaxTriesBy) String() string {
+	switch by {
+	case ByCookie:
+		return "cookie"
+	case ByIP:
+		return "ip"
+	case ByUsername:
+		return "username"
+	case ByIP | ByUsername:
+		return "ip+username"
+	default:
+		return "unknown"
+	}
+}
+
+// AttemptStore is an optional interface which a CredentialStore (see Options.Store)
+// can implement to share the server-side sign in failures counters too,
+// see the Options.MaxTriesBy field. The MemoryStore implements it.
+// When the Options.Store does not implement it, the counters are kept in memory.
+type AttemptStore interface {
+	// GetAttempts returns the failures of the given key
+	// and the end of its lockout window, if any (see Options.LockoutBackoff).
+	GetAttempts(key string) (tries int, lockedUntil time.Time)
+	// IncrAttempts atomically increments the failures of the given key,
+	// they expire after "ttl" time, and returns the new amount.
+	IncrAttempts(key string, ttl time.Duration) (int, error)
+	// LockAttempts sets the end of the lockout window of the given key.
+	LockAttempts(key string, until time.Time) error
+	// ResetAttempts removes the failures of the given key, if any.
+	ResetAttempts(key string)
+}
+
+// maxTries returns the MaxTries of the given username: the MaxTriesUser override
+// which was reported on its last failed attempt, if any, otherwise the Options.MaxTries.
+// The override is resolved on a failed attempt (see ErrPasswordMismatch),
+// so it is known by the checks which run before the Options.Allow on the next ones.
+func (b *BasicAuth) maxTries(username string) int {
+	b.userMaxTriesMu.RLock()
+	n, ok := b.userMaxTries[username]
+	b.userMaxTriesMu.RUnlock()
+
+	if ok {
+		return n
+	}
+
+	return b.opts.MaxTries
+}
+
+// setMaxTries records the MaxTriesUser override of the given username, see maxTries.
+func (b *BasicAuth) setMaxTries(username string, n int) {
+	b.userMaxTriesMu.Lock()
+	if b.userMaxTries == nil {
+		b.userMaxTries = make(map[string]int)
+	}
+	b.userMaxTries[username] = n
+	b.userMaxTriesMu.Unlock()
+}
+
+// triesKey returns the server-side failures counter key of the given request and username.
+// It is hashed, like the credentials keys, so the store does not hold usernames or IPs.
+func (b *BasicAuth) triesKey(r *http.Request, username string) string {
+	var ip string
+	if b.opts.MaxTriesBy&ByIP != 0 {
+		ip = b.clientIP(r)
+	}
+	if b.opts.MaxTriesBy&ByUsername == 0 {
+		username = ""
+	}
+
+	return "tries:" + fullUserKey(ip, username)
+}
+
+// getTries returns the current failures of the request (and its username)
+// and the end of its lockout window, if any.
+func (b *BasicAuth) getTries(r *http.Request, username string) (int, time.Time) {
+	if b.attempts == nil {
+		return b.getCurrentTries(r)
+	}
+
+	return b.attempts.GetAttempts(b.triesKey(r, username))
+}
+
+// addTry records a new failure of the request (and its username), after the given "tries",
+// and returns the new amount of the failures.
+func (b *BasicAuth) addTry(w http.ResponseWriter, r *http.Request, username string, tries, maxTries int) int {
+	if b.attempts == nil {
+		tries++
+		b.setCurrentTriesLockout(w, tries, b.lockout(tries, maxTries))
+		return tries
+	}
+
+	key := b.triesKey(r, username)
+	n, err := b.attempts.IncrAttempts(key, b.triesCookieMaxAge)
+	if err != nil {
+		b.logAttemptsError(r, err)
+		n = tries + 1
+	}
+
+	if until := b.lockout(n, maxTries); !until.IsZero() {
+		if err = b.attempts.LockAttempts(key, until); err != nil {
+			b.logAttemptsError(r, err)
+		}
+	}
+
+	return n
+}
+
+// resetTries removes the failures of the request (and its username).
+func (b *BasicAuth) resetTries(w http.ResponseWriter, r *http.Request, username string) {
+	if b.attempts == nil {
+		b.resetCurrentTries(w)
+		return
+	}
+
+	b.attempts.ResetAttempts(b.triesKey(r, username))
+}
+
+// lockout returns the end of the lockout window after the given failures,
+// zero if there is none, see Options.LockoutBackoff.
+func (b *BasicAuth) lockout(tries, maxTries int) time.Time {
+	if b.opts.LockoutBackoff == nil || tries >= maxTries {
+		return time.Time{}
+	}
+
+	if d := b.opts.LockoutBackoff(tries); d > 0 {
+		return time.Now().Add(d)
+	}
+
+	return time.Time{}
+}
+
+func (b *BasicAuth) logAttemptsError(r *http.Request, err error) {
+	if b.opts.ErrorLogger == nil {
+		return
+	}
+
+	if id := b.correlationID(r); id != "" {
+		b.opts.ErrorLogger.Printf("[%s] tries: store: %v", id, err)
+	} else {
+		b.opts.ErrorLogger.Printf("tries: store: %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package basicauth
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func withRemoteAddr(addr string) requestOption {
+	return func(r *http.Request) error {
+		r.RemoteAddr = addr
+		return nil
+	}
+}
+
+func TestMaxTriesBy(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+
+	// By IP, deleting the cookie does not reset the counter.
+	auth := New(Options{
+		Allow:      AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		MaxTries:   2,
+		MaxTriesBy: ByIP,
+	})
+	h := auth(http.HandlerFunc(handler))
+
+	client, other := withRemoteAddr("10.0.0.1:1234"), withRemoteAddr("10.0.0.2:1234")
+	testHandler(t, h, http.MethodGet, "/", client, withBasicAuth("kataras", "invalid_pass")).
+		statusCode(http.StatusUnauthorized)
+	// A successful sign in resets it.
+	testHandler(t, h, http.MethodGet, "/", client, withBasicAuth("kataras", "kataras_pass")).
+		statusCode(http.StatusOK)
+	testHandler(t, h, http.MethodGet, "/", client, withBasicAuth("kataras", "invalid_pass")).
+		statusCode(http.StatusUnauthorized)
+	testHandler(t, h, http.MethodGet, "/", client, withBasicAuth("makis", "invalid_pass")).
+		statusCode(http.StatusForbidden)
+	// Rejected even with valid credentials.
+	testHandler(t, h, http.MethodGet, "/", client, withBasicAuth("kataras", "kataras_pass")).
+		statusCode(http.StatusForbidden)
+	testHandler(t, h, http.MethodGet, "/", other, withBasicAuth("kataras", "kataras_pass")).
+		statusCode(http.StatusOK)
+
+	// By username, shared across instances through the store.
+	store := NewMemoryStore()
+	opts := Options{
+		Allow:      AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		MaxTries:   2,
+		MaxTriesBy: ByUsername,
+		Store:      store,
+	}
+	first, second := New(opts)(http.HandlerFunc(handler)), New(opts)(http.HandlerFunc(handler))
+
+	testHandler(t, first, http.MethodGet, "/", client, withBasicAuth("kataras", "invalid_pass")).
+		statusCode(http.StatusUnauthorized)
+	testHandler(t, second, http.MethodGet, "/", other, withBasicAuth("kataras", "invalid_pass")).
+		statusCode(http.StatusForbidden)
+	testHandler(t, first, http.MethodGet, "/", other, withBasicAuth("kataras", "kataras_pass")).
+		statusCode(http.StatusForbidden)
+	testHandler(t, first, http.MethodGet, "/", client, withBasicAuth("makis", "invalid_pass")).
+		statusCode(http.StatusUnauthorized)
+
+	if n := store.GC(time.Now().Add(2 * DefaultCookieMaxAge)); n != 0 {
+		t.Fatalf("expected no credentials to be removed but got: %d", n)
+	}
+	testHandler(t, first, http.MethodGet, "/", client, withBasicAuth("kataras", "kataras_pass")).
+		statusCode(http.StatusOK)
+}
@@ -1,12 +1,22 @@
 package basicauth
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"path"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 	"gopkg.in/yaml.v3"
@@ -28,6 +38,49 @@ type User interface {
 	GetPassword() string
 }
 
+// MaxTriesUser can be implemented by custom user values
+// to override the Options.MaxTries per user, e.g. admins should lock faster
+// and service accounts should never lock (a zero or negative value).
+// It is consulted on a failed attempt of an existing username,
+// when the Options.Allow reports an ErrPasswordMismatch with that user (as the AllowUsers does),
+// and it is remembered for the next attempts of that username, including the server-side
+// check which runs before the Options.Allow (see Options.MaxTriesBy).
+// It enables the tries tracking for that user even if the Options.MaxTries is zero.
+type MaxTriesUser interface {
+	GetMaxTries() int
+}
+
+// ExpiringUser can be implemented by custom user values
+// to override the Options.MaxAge per user, e.g. admins should re-authenticate
+// every 5 minutes and service accounts should live for hours.
+// It is consulted on the first login of a credential, when its expiration is computed.
+// A zero or negative value falls back to the Options.MaxAge.
+// The value is limited by the Options.MaxAgeLimit too.
+type ExpiringUser interface {
+	ExpiresIn() time.Duration
+}
+
+// AliasedUser can be implemented by custom user values
+// to accept more than one login names, e.g. the username and the email,
+// for the same user entry of the AllowUsers function.
+// The primary username is the canonical identifier of the user:
+// the credentials are stored under it regardless of the name used to log in,
+// so all names share the same stored credential (and logout).
+// An exact username of another entry always wins over an alias.
+type AliasedUser interface {
+	GetAliases() []string
+}
+
+// canonicalUsername returns the primary username of an AliasedUser value, if any.
+func canonicalUsername(user interface{}) string {
+	if _, ok := user.(AliasedUser); !ok {
+		return ""
+	}
+
+	username, _, _ := extractUsernameAndPassword(user)
+	return username
+}
+
 // SimpleUser implements the User interface
 // and it is used internally to store the
 // current authenticated user to the HTTP request value
@@ -35,6 +88,9 @@ type User interface {
 type SimpleUser struct {
 	Username string
 	Password string
+	// Fields holds any extra attributes of the user, e.g. the fields of a map record.
+	// See the Get, GetString and GetInt methods.
+	Fields map[string]interface{}
 }
 
 // GetUsername returns the Username field.
@@ -47,12 +103,64 @@ func (u *SimpleUser) GetPassword() string {
 	return u.Password
 }
 
+// Get returns the value of the given field and reports whether it exists.
+func (u *SimpleUser) Get(field string) (interface{}, bool) {
+	v, ok := u.Fields[field]
+	return v, ok
+}
+
+// GetString returns the string value of the given field
+// and reports whether it exists and it is a string.
+func (u *SimpleUser) GetString(field string) (string, bool) {
+	v, ok := u.Fields[field].(string)
+	return v, ok
+}
+
+// GetInt returns the integer value of the given field
+// and reports whether it exists and it is an integer.
+// Whole float64 values, as decoded from JSON, are accepted too.
+func (u *SimpleUser) GetInt(field string) (int, bool) {
+	switch v := u.Fields[field].(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case float64:
+		if v == float64(int(v)) {
+			return int(v), true
+		}
+	}
+
+	return 0, false
+}
+
 // UserAuthOptions holds optional user authentication options
 // that can be given to the builtin Default and Load (and AllowUsers, AllowUsersFile) functions.
 type UserAuthOptions struct {
-	// Defaults to plain check, can be modified for encrypted passwords,
-	// see the BCRYPT optional function.
+	// Defaults to a constant-time plain check (see comparePlain),
+	// can be modified for encrypted passwords, see the BCRYPT optional function.
 	ComparePassword func(stored, userPassword string) bool
+	// DummyPassword is the stored password (or hash) that the ComparePassword
+	// is called with when the username does not exist, so the response time
+	// is roughly the same whether the username exists or not
+	// and it does not leak the existence of a username.
+	// The BCRYPT option sets it to a precomputed bcrypt hash of the default cost,
+	// custom verifiers should set it to a value of the same scheme and cost as the stored ones.
+	DummyPassword string
+	// ValidateHash if not nil then it validates each stored password (or hash) at load time,
+	// e.g. to reject too weak hashes, a non-nil error makes the AllowUsers and AllowUsersFile panic.
+	// See the WithArgon2 function.
+	ValidateHash func(stored string) error
+	// PasswordPolicy if not nil then it is enforced to the stored plain passwords at load time,
+	// see the WithPasswordPolicy optional function.
+	PasswordPolicy *PasswordPolicy
+	// IsCompromised if not nil then it is called with the user input after a successful
+	// password comparison, a true result rejects the login with an ErrPasswordCompromised reason.
+	// See the WithCompromisedCheck optional function.
+	IsCompromised func(password string) bool
+
+	// the password hash schemes, see withScheme.
+	schemes hashSchemes
 }
 
 // UserAuthOption is the option function type
@@ -61,6 +169,20 @@ type UserAuthOptions struct {
 // See BCRYPT for an implementation.
 type UserAuthOption func(*UserAuthOptions)
 
+// WithVerifier returns a UserAuthOption which plugs a custom password verification,
+// e.g. HMAC, pepper+argon2 or any vendor scheme, to the AllowUsers and AllowUsersFile functions.
+// The "verify" function accepts the stored password (or hash) and the user input
+// and it should report whether they match.
+//
+// Usage:
+//
+//	Default(..., WithVerifier(func(stored, userPassword string) bool { ... }))
+func WithVerifier(verify func(stored, userPassword string) bool) UserAuthOption {
+	return func(opts *UserAuthOptions) {
+		opts.ComparePassword = verify
+	}
+}
+
 // BCRYPT it is a UserAuthOption, it compares a bcrypt hashed password with its user input.
 // Reports true on success and false on failure.
 //
@@ -74,11 +196,38 @@ type UserAuthOption func(*UserAuthOptions)
 //	Load(..., BCRYPT) OR
 //	Options.Allow = AllowUsers(..., BCRYPT) OR
 //	OPtions.Allow = AllowUsersFile(..., BCRYPT)
+//
+// It can be composed with the ARGON2 and SHACRYPT options,
+// so a single user list can mix hash schemes, each one is detected by its prefix.
 func BCRYPT(opts *UserAuthOptions) {
-	opts.ComparePassword = func(stored, userPassword string) bool {
-		err := bcrypt.CompareHashAndPassword([]byte(stored), []byte(userPassword))
-		return err == nil
-	}
+	withScheme(hashScheme{
+		prefixes: []string{"$2a$", "$2b$", "$2y$", "$2x$"},
+		verify:   verifyBcrypt,
+		dummy:    dummyBcryptHash,
+	})(opts)
+}
+
+// dummyBcryptHash is a bcrypt hash of the default cost,
+// compared against on unknown usernames, see UserAuthOptions.DummyPassword.
+const dummyBcryptHash = "$2a$10$kSwtowjPB1hhlMAVSSclN.9R8ipmxKJ/5rfIxrPZBRxPPWcoxRp1W"
+
+// dummyPassword is the default UserAuthOptions.DummyPassword.
+const dummyPassword = "basicauth-dummy-password"
+
+func verifyBcrypt(stored, userPassword string) bool {
+	err := bcrypt.CompareHashAndPassword([]byte(stored), []byte(userPassword))
+	return err == nil
+}
+
+// comparePlain compares a plain stored password with its user input in constant time.
+// Both are hashed first, so the comparison does not leak the length of the stored password either.
+//
+// Note that the username is not compared this way: it is a map lookup,
+// which does not depend on how many of its leading characters match,
+// and an unknown username still runs a comparison, see UserAuthOptions.DummyPassword.
+func comparePlain(stored, userPassword string) bool {
+	s, u := sha256.Sum256([]byte(stored)), sha256.Sum256([]byte(userPassword))
+	return subtle.ConstantTimeCompare(s[:], u[:]) == 1
 }
 
 func toUserAuthOptions(opts []UserAuthOption) (options UserAuthOptions) {
@@ -87,9 +236,11 @@ func toUserAuthOptions(opts []UserAuthOption) (options UserAuthOptions) {
 	}
 
 	if options.ComparePassword == nil {
-		options.ComparePassword = func(stored, userPassword string) bool {
-			return stored == userPassword
-		}
+		options.ComparePassword = comparePlain
+	}
+
+	if options.DummyPassword == "" {
+		options.DummyPassword = dummyPassword
 	}
 
 	return options
@@ -99,51 +250,134 @@ func toUserAuthOptions(opts []UserAuthOption) (options UserAuthOptions) {
 // The "users" input parameter can be one of the following forms:
 //
 //	map[string]string e.g. {username: password, username: password...}.
+//	map[string]interface{} e.g. {"username": "...", "password": "...", "other_field": ...}.
+//	map[string]interface{} e.g. {"username": {"password": "...", "other_field": ...}, ...}.
+//	map[string]interface{} e.g. {"username": "password", ...}.
 //	[]map[string]interface{} e.g. []{"username": "...", "password": "...", "other_field": ...}, ...}.
 //	[]T which T completes the User interface.
 //	[]T which T contains at least Username and Password fields.
 //
+// The T can implement the AliasedUser interface to accept more login names, e.g. the email.
+//
+// On success the returned value is the matched source entry as it is,
+// e.g. the T struct value or the map[string]interface{} record,
+// so the GetUser function returns the full record instead of a bare *SimpleUser.
+// The map[string]string form has no record, its users are stored as *SimpleUser.
+// On failure the returned value is the reason, an ErrUserNotFound, an ErrPasswordMismatch
+// or an ErrPasswordCompromised (see WithCompromisedCheck).
+//
+// The user list is indexed by username once, on initialization,
+// so the user lookup is constant time regardless of the list's size and form.
+//
+// A username can be a glob pattern, e.g. "ci-*" for service accounts
+// with dynamic usernames (ci-build-42, ci-deploy...) which share a single password.
+// The pattern syntax is the one of the path.Match function:
+//
+//	'*' matches any sequence of characters, e.g. "ci-*".
+//	'?' matches any single character, e.g. "bot-??".
+//	'[' [ '^' ] { character-range } ']' matches a character class, e.g. "node-[0-9]".
+//	'\\' escapes the next character, e.g. "literal-\\*".
+//
+// An exact username always wins over a pattern. When more than one patterns match
+// then the longest (the most specific) one is used.
+//
+// The user list is frozen on initialization, see NewUserList
+// to add and remove users at runtime.
+//
 // Usage:
 // New(Options{Allow: AllowUsers(..., [BCRYPT])})
 func AllowUsers(users interface{}, opts ...UserAuthOption) AuthFunc {
-	// create a local user structure to be used in the map copy,
-	// takes longer to initialize but faster to serve.
-	type user struct {
-		password string
-		ref      interface{}
+	if m, ok := users.(map[string]string); ok {
+		return userMap(m, opts...)
 	}
-	cp := make(map[string]*user)
 
-	v := reflect.Indirect(reflect.ValueOf(users))
-	switch v.Kind() {
-	case reflect.Slice:
+	return NewUserList(users, opts...).Allow
+}
+
+// userEntry is a local user structure to be used in the users index,
+// takes longer to initialize but faster to serve.
+type userEntry struct {
+	password string
+	ref      interface{}
+}
+
+// indexUsers builds a username to user entry map of the given user list.
+// See AllowUsers for the accepted forms.
+func indexUsers(users interface{}) map[string]*userEntry {
+	index := make(map[string]*userEntry)
+
+	rangeUsers(users, func(_, username, password string, ref interface{}, ok bool) {
+		// MUST contain a username and password.
+		if ok {
+			index[username] = &userEntry{
+				password: password,
+				ref:      ref,
+			}
+		}
+	})
+
+	// Index the aliases after the usernames, so an exact username wins.
+	if v := reflect.Indirect(reflect.ValueOf(users)); v.Kind() == reflect.Slice {
 		for i := 0; i < v.Len(); i++ {
-			elem := v.Index(i).Interface()
-			// MUST contain a username and password.
-			username, password, ok := extractUsernameAndPassword(elem)
+			u, ok := v.Index(i).Interface().(AliasedUser)
 			if !ok {
 				continue
 			}
 
-			cp[username] = &user{
-				password: password,
-				ref:      elem,
+			username, _, ok := extractUsernameAndPassword(u)
+			if !ok || index[username] == nil {
+				continue
+			}
+
+			for _, alias := range u.GetAliases() {
+				if _, exists := index[alias]; !exists && alias != "" {
+					index[alias] = index[username]
+				}
 			}
 		}
+	}
+
+	return index
+}
+
+// rangeUsers calls "fn" for each user of the given user list, see AllowUsers for the accepted forms.
+// The "id" is the index or the quoted username of the user, useful for errors,
+// and "ok" reports whether the user has a username and a password.
+// The users of a map are visited in username order.
+func rangeUsers(users interface{}, fn func(id, username, password string, ref interface{}, ok bool)) {
+	v := reflect.Indirect(reflect.ValueOf(users))
+	switch v.Kind() {
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			elem := v.Index(i).Interface()
+			username, password, ok := extractUsernameAndPassword(elem)
+			fn(fmt.Sprintf("[%d]", i), username, password, elem, ok)
+		}
 	case reflect.Map:
 		elem := v.Interface()
 		switch m := elem.(type) {
 		case map[string]string:
-			return userMap(m, opts...)
+			for _, username := range sortedKeys(v) {
+				fn(strconv.Quote(username), username, m[username], nil, true)
+			}
 		case map[string]interface{}:
-			username, password, ok := mapUsernameAndPassword(m)
-			if !ok {
+			if username, password, ok := mapUsernameAndPassword(m); ok {
+				fn(strconv.Quote(username), username, password, m, true)
 				break
 			}
 
-			cp[username] = &user{
-				password: password,
-				ref:      m,
+			// type of username: {password: ..., other_field: ...}.
+			for _, username := range sortedKeys(v) {
+				id := strconv.Quote(username)
+				switch record := m[username].(type) {
+				case string: // type of username: password.
+					fn(id, username, record, nil, username != "" && record != "")
+				case map[string]interface{}:
+					password, ok := record["password"].(string)
+					fn(id, username, password, record, ok && username != "" && password != "")
+				default:
+					fn(id, username, "", nil, false)
+				}
 			}
 		default:
 			panic(fmt.Sprintf("unsupported type of map: %T", users))
@@ -151,27 +385,118 @@ func AllowUsers(users interface{}, opts ...UserAuthOption) AuthFunc {
 	default:
 		panic(fmt.Sprintf("unsupported type: %T", users))
 	}
+}
+
+// sortedKeys returns the sorted string keys of the given map value.
+func sortedKeys(m reflect.Value) []string {
+	keys := make([]string, 0, m.Len())
+	for _, k := range m.MapKeys() {
+		keys = append(keys, k.String())
+	}
+	sort.Strings(keys)
+
+	return keys
+}
 
+// userMap is the fast path of the simplest, and most common, map[string]string form,
+// the lookup map is built without reflection.
+func userMap(users map[string]string, opts ...UserAuthOption) AuthFunc {
 	options := toUserAuthOptions(opts)
+	// Copy, so later modifications of the caller's map do not race with the lookups.
+	usernamePassword := make(map[string]string, len(users))
+	for username, password := range users {
+		options.validatePassword(username, password)
+		usernamePassword[username] = password
+	}
+
+	var patterns userPatternList
+	for username, password := range usernamePassword {
+		if isUsernamePattern(username) {
+			patterns = append(patterns, userPattern{username, &userEntry{password: password}})
+		}
+	}
+	patterns.sort()
 
 	return func(_ *http.Request, username, password string) (interface{}, bool) {
-		if u, ok := cp[username]; ok { // fast map access,
-			if options.ComparePassword(u.password, password) {
-				return u.ref, true
+		pass, ok := usernamePassword[username]
+		if !ok && len(patterns) > 0 {
+			var u *userEntry
+			if u, ok = patterns.match(username); ok {
+				pass = u.password
 			}
 		}
 
-		return nil, false
+		if !ok {
+			// Compare anyway, so an unknown username takes the same time.
+			options.ComparePassword(options.DummyPassword, password)
+			return ErrUserNotFound{Username: username}, false
+		}
+
+		if !options.ComparePassword(pass, password) {
+			return ErrPasswordMismatch{Username: username}, false
+		}
+
+		if options.isCompromised(password) {
+			return ErrPasswordCompromised{Username: username}, false
+		}
+
+		return nil, true
 	}
 }
 
-func userMap(usernamePassword map[string]string, opts ...UserAuthOption) AuthFunc {
-	options := toUserAuthOptions(opts)
+// userPattern is a user entry of a glob username, e.g. "ci-*".
+type userPattern struct {
+	pattern string
+	entry   *userEntry
+}
 
-	return func(_ *http.Request, username, password string) (interface{}, bool) {
-		pass, ok := usernamePassword[username]
-		return nil, ok && options.ComparePassword(pass, password)
+// userPatternList is a list of glob usernames, the most specific first.
+type userPatternList []userPattern
+
+// isUsernamePattern reports whether the given username is a valid glob pattern.
+func isUsernamePattern(username string) bool {
+	if !strings.ContainsAny(username, "*?[") {
+		return false
+	}
+
+	_, err := path.Match(username, "")
+	return err == nil
+}
+
+// userPatterns returns the glob usernames of the given index.
+func userPatterns(index map[string]*userEntry) userPatternList {
+	var patterns userPatternList
+	for username, u := range index {
+		if isUsernamePattern(username) {
+			patterns = append(patterns, userPattern{username, u})
+		}
+	}
+	patterns.sort()
+
+	return patterns
+}
+
+// sort sorts the patterns by length (the longest first) and then alphabetically,
+// so the match is deterministic.
+func (l userPatternList) sort() {
+	sort.Slice(l, func(i, j int) bool {
+		if len(l[i].pattern) != len(l[j].pattern) {
+			return len(l[i].pattern) > len(l[j].pattern)
+		}
+
+		return l[i].pattern < l[j].pattern
+	})
+}
+
+// match returns the entry of the first pattern which matches the given username.
+func (l userPatternList) match(username string) (*userEntry, bool) {
+	for _, p := range l {
+		if ok, _ := path.Match(p.pattern, username); ok {
+			return p.entry, true
+		}
 	}
+
+	return nil, false
 }
 
 // AllowUsersFile is an AuthFunc which authenticates user input based on a (static) user list
@@ -189,7 +514,127 @@ func userMap(usernamePassword map[string]string, opts ...UserAuthOption) AuthFun
 //   - username: makis
 //     password: makis_password
 //     ...
+//
+// The format is detected by the file extension, see AllowUsersReader.
+// Large user files can be gzip compressed, e.g. "users.yml.gz".
 func AllowUsersFile(jsonOrYamlFilename string, opts ...UserAuthOption) AuthFunc {
+	return allowUsersFile(jsonOrYamlFilename, nil, opts...)
+}
+
+// Format is the format of a user list document, see AllowUsersReader.
+type Format uint8
+
+const (
+	// JSON is the format of a user list JSON document.
+	JSON Format = iota
+	// YAML is the format of a user list YAML document.
+	YAML
+)
+
+// String returns the text representation of the format.
+func (f Format) String() string {
+	switch f {
+	case JSON:
+		return "json"
+	case YAML:
+		return "yaml"
+	default:
+		return "unknown"
+	}
+}
+
+// AllowUsersReader is an AuthFunc which authenticates user input based on a (static) user list
+// read from the given reader on initialization, e.g. an embedded file or a remote object.
+// The document looks like the AllowUsersFile's one, in the given format.
+// It panics if the document cannot be read or decoded.
+//
+// Example Code:
+//
+//	f, _ := embedFS.Open("users.yml")
+//	defer f.Close()
+//	New(Options{Allow: AllowUsersReader(f, YAML, BCRYPT)})
+func AllowUsersReader(r io.Reader, format Format, opts ...UserAuthOption) AuthFunc {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	users, err := loadUsers(data, format, nil)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return AllowUsers(users, opts...)
+}
+
+// allowUsersFile loads the users from the given file,
+// if resolvePassword is not nil then it is used to resolve each stored password.
+func allowUsersFile(jsonOrYamlFilename string, resolvePassword func(string) (string, error), opts ...UserAuthOption) AuthFunc {
+	users, err := loadUsersFile(jsonOrYamlFilename, resolvePassword)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return AllowUsers(users, opts...)
+}
+
+// loadUsersFile decodes the user list of the given file, its format is detected by the extension,
+// it returns a map[string]string or a []map[string]interface{} value.
+func loadUsersFile(jsonOrYamlFilename string, resolvePassword func(string) (string, error)) (interface{}, error) {
+	data, err := ReadFile(jsonOrYamlFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	format, gz, err := fileFormat(jsonOrYamlFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	if gz {
+		if data, err = gunzip(data); err != nil {
+			return nil, err
+		}
+	}
+
+	users, err := loadUsers(data, format, resolvePassword)
+	if err == errMalformedDocument {
+		return nil, errors.New("malformed document file: " + jsonOrYamlFilename)
+	}
+
+	return users, err
+}
+
+// fileFormat returns the format of the given filename by its extension
+// and reports whether it is gzip compressed, e.g. "users.yml.gz".
+func fileFormat(src string) (Format, bool, error) {
+	var ext string
+	if idx := strings.LastIndexByte(src, '.'); idx > 0 {
+		ext = src[idx:]
+	}
+
+	gz := ext == ".gz"
+	if gz { // e.g. users.yml.gz, read the real extension.
+		src = src[:len(src)-len(ext)]
+		ext = ""
+		if idx := strings.LastIndexByte(src, '.'); idx > 0 {
+			ext = src[idx:]
+		}
+	}
+
+	switch ext {
+	case "", ".json":
+		return JSON, gz, nil
+	case ".yml", ".yaml":
+		return YAML, gz, nil
+	default:
+		return 0, false, fmt.Errorf("unexpected file extension: %s", ext)
+	}
+}
+
+// loadUsers decodes the user list of the given document,
+// it returns a map[string]string or a []map[string]interface{} value.
+func loadUsers(data []byte, format Format, resolvePassword func(string) (string, error)) (interface{}, error) {
 	var (
 		usernamePassword map[string]string
 		// no need to support too much forms, this would be for:
@@ -197,15 +642,37 @@ func AllowUsersFile(jsonOrYamlFilename string, opts ...UserAuthOption) AuthFunc
 		userList []map[string]interface{}
 	)
 
-	if err := decodeFile(jsonOrYamlFilename, &usernamePassword, &userList); err != nil {
-		panic(err)
+	if err := decode(data, format, &usernamePassword, &userList); err != nil {
+		return nil, err
+	}
+
+	if resolvePassword != nil {
+		for username, password := range usernamePassword {
+			resolved, err := resolvePassword(password)
+			if err != nil {
+				return nil, fmt.Errorf("user %q: %v", username, err)
+			}
+			usernamePassword[username] = resolved
+		}
+
+		for _, u := range userList {
+			for _, key := range []string{"password", "Password"} {
+				if password, ok := u[key].(string); ok {
+					resolved, err := resolvePassword(password)
+					if err != nil {
+						return nil, fmt.Errorf("user %v: %v", u["username"], err)
+					}
+					u[key] = resolved
+				}
+			}
+		}
 	}
 
 	if len(usernamePassword) > 0 {
 		// JSON Form: { "$username":"$pass", "$username": "$pass" }
 		// YAML Form: $username: $pass
 		// 			  $username: $pass
-		return userMap(usernamePassword, opts...)
+		return usernamePassword, nil
 	}
 
 	if len(userList) > 0 {
@@ -214,36 +681,26 @@ func AllowUsersFile(jsonOrYamlFilename string, opts ...UserAuthOption) AuthFunc
 		// - username: $username
 		//   password: $password
 		//   other_field: ...
-		return AllowUsers(userList, opts...)
+		return userList, nil
 	}
 
-	panic("malformed document file: " + jsonOrYamlFilename)
+	return nil, errMalformedDocument
 }
 
-func decodeFile(src string, dest ...interface{}) error {
-	data, err := ReadFile(src)
-	if err != nil {
-		return err
-	}
+var errMalformedDocument = errors.New("malformed document")
 
-	// We use unmarshal instead of file decoder
+func decode(data []byte, format Format, dest ...interface{}) error {
+	// We use unmarshal instead of a decoder
 	// as we may need to read it more than once (dests, see below).
-	var (
-		unmarshal func(data []byte, v interface{}) error
-		ext       string
-	)
+	var unmarshal func(data []byte, v interface{}) error
 
-	if idx := strings.LastIndexByte(src, '.'); idx > 0 {
-		ext = src[idx:]
-	}
-
-	switch ext {
-	case "", ".json":
+	switch format {
+	case JSON:
 		unmarshal = json.Unmarshal
-	case ".yml", ".yaml":
+	case YAML:
 		unmarshal = yaml.Unmarshal
 	default:
-		return fmt.Errorf("unexpected file extension: %s", ext)
+		return fmt.Errorf("unexpected format: %s", format)
 	}
 
 	var (
@@ -252,7 +709,7 @@ func decodeFile(src string, dest ...interface{}) error {
 	)
 
 	for _, d := range dest {
-		if err = unmarshal(data, d); err == nil {
+		if err := unmarshal(data, d); err == nil {
 			ok = true
 		} else {
 			lastErr = err
@@ -266,6 +723,16 @@ func decodeFile(src string, dest ...interface{}) error {
 	return nil // if at least one is succeed we are ok.
 }
 
+func gunzip(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
+
 func extractUsernameAndPassword(s interface{}) (username, password string, ok bool) {
 	if s == nil {
 		return
@@ -1,12 +1,17 @@
 package basicauth
 
 import (
+	"compress/gzip"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 	"gopkg.in/yaml.v3"
@@ -285,3 +290,566 @@ func mustGeneratePassword(t *testing.T, userPassword string) string {
 
 	return string(hashed)
 }
+
+func TestAllowUsersNestedMap(t *testing.T) {
+	allow := AllowUsers(Map{
+		"kataras": Map{"password": "kataras_pass", "role": "admin"},
+		"makis":   Map{"password": "makis_pass"},
+	})
+
+	var tests = []struct {
+		username, password string
+		ok                 bool
+		role               interface{}
+	}{
+		{"kataras", "kataras_pass", true, "admin"},
+		{"makis", "makis_pass", true, nil},
+		{"kataras", "makis_pass", false, nil},
+		{"invalid", "invalid_pass", false, nil},
+	}
+
+	for i, tt := range tests {
+		v, ok := allow(nil, tt.username, tt.password)
+		if tt.ok != ok {
+			t.Fatalf("[%d] expected: %v but got: %v (username=%s,password=%s)", i, tt.ok, ok, tt.username, tt.password)
+		}
+
+		if !ok {
+			continue
+		}
+
+		if got := v.(Map)["role"]; tt.role != got {
+			t.Fatalf("[%d] expected role: %v but got: %v", i, tt.role, got)
+		}
+	}
+}
+
+func TestAllowUsersFileGzip(t *testing.T) {
+	f, err := ioutil.TempFile("", "*users.json.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		f.Close()
+		os.Remove(f.Name())
+	}()
+
+	w := gzip.NewWriter(f)
+	w.Write([]byte(`{"kataras": "kataras_pass"}`))
+	w.Close()
+
+	allow := AllowUsersFile(f.Name())
+	if _, ok := allow(nil, "kataras", "kataras_pass"); !ok {
+		t.Fatalf("expected user to be loaded from a gzip compressed file")
+	}
+	if _, ok := allow(nil, "kataras", "invalid_pass"); ok {
+		t.Fatalf("expected invalid password to fail")
+	}
+}
+
+func TestAllowUsersReader(t *testing.T) {
+	tests := []struct {
+		format   Format
+		document string
+	}{
+		{JSON, `{"kataras": "kataras_pass"}`},
+		{JSON, `[{"username": "kataras", "password": "kataras_pass", "role": "admin"}]`},
+		{YAML, "kataras: kataras_pass"},
+		{YAML, "- username: kataras\n  password: kataras_pass\n  role: admin"},
+	}
+
+	for i, tt := range tests {
+		allow := AllowUsersReader(strings.NewReader(tt.document), tt.format)
+		if _, ok := allow(nil, "kataras", "kataras_pass"); !ok {
+			t.Fatalf("[%d] %s: expected user to be loaded", i, tt.format)
+		}
+		if _, ok := allow(nil, "kataras", "invalid_pass"); ok {
+			t.Fatalf("[%d] %s: expected invalid password to fail", i, tt.format)
+		}
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("expected a panic on a malformed document")
+			}
+		}()
+
+		AllowUsersReader(strings.NewReader("kataras: kataras_pass"), JSON)
+	}()
+}
+
+func newBenchUsers(n int) []Map {
+	users := make([]Map, n)
+	for i := range users {
+		users[i] = Map{"username": fmt.Sprintf("user%d", i), "password": fmt.Sprintf("pass%d", i)}
+	}
+
+	return users
+}
+
+// BenchmarkAllowUsersLinearScan is the baseline: a lookup scanning the user slice.
+func BenchmarkAllowUsersLinearScan(b *testing.B) {
+	users := newBenchUsers(50000)
+	allow := func(_ *http.Request, username, password string) (interface{}, bool) {
+		for _, u := range users {
+			if u["username"] == username && u["password"] == password {
+				return u, true
+			}
+		}
+
+		return nil, false
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		allow(nil, "user49999", "pass49999")
+	}
+}
+
+func BenchmarkAllowUsersIndexed(b *testing.B) {
+	allow := AllowUsers(newBenchUsers(50000))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		allow(nil, "user49999", "pass49999")
+	}
+}
+
+func TestWithVerifier(t *testing.T) {
+	reversed := func(stored, userPassword string) bool {
+		r := []rune(userPassword)
+		for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+			r[i], r[j] = r[j], r[i]
+		}
+		return stored == string(r)
+	}
+
+	for _, allow := range []AuthFunc{
+		AllowUsers(map[string]string{"kataras": "ssap_sarataK"}, WithVerifier(reversed)),
+		AllowUsers([]Map{{"username": "kataras", "password": "ssap_sarataK"}}, WithVerifier(reversed)),
+	} {
+		if _, ok := allow(nil, "kataras", "Kataras_pass"); !ok {
+			t.Fatalf("expected the custom verifier to allow the reversed password")
+		}
+
+		if _, ok := allow(nil, "kataras", "ssap_sarataK"); ok {
+			t.Fatalf("expected the custom verifier to reject the stored password as user input")
+		}
+	}
+}
+
+func TestAllowUsersPattern(t *testing.T) {
+	allowMap := AllowUsers(map[string]string{
+		"ci-*":        "ci_secret",
+		"ci-deploy-*": "deploy_secret",
+		"ci-admin":    "admin_pass",
+	})
+	allowList := AllowUsers([]Map{
+		{"username": "ci-*", "password": "ci_secret"},
+		{"username": "ci-deploy-*", "password": "deploy_secret"},
+		{"username": "ci-admin", "password": "admin_pass"},
+	})
+
+	var tests = []struct {
+		username, password string
+		ok                 bool
+	}{
+		{"ci-build-42", "ci_secret", true},
+		{"ci-build-42", "invalid_pass", false},
+		{"ci-deploy-1", "deploy_secret", true}, // the most specific pattern wins.
+		{"ci-deploy-1", "ci_secret", false},
+		{"ci-admin", "admin_pass", true}, // exact match wins.
+		{"ci-admin", "ci_secret", false},
+		{"cd-build-42", "ci_secret", false},
+	}
+
+	for _, allow := range []AuthFunc{allowMap, allowList} {
+		for i, tt := range tests {
+			if _, ok := allow(nil, tt.username, tt.password); tt.ok != ok {
+				t.Fatalf("[%d] expected: %v but got: %v (username=%s,password=%s)", i, tt.ok, ok, tt.username, tt.password)
+			}
+		}
+	}
+}
+
+func TestAllowUsersDummyCompare(t *testing.T) {
+	var compared []string
+	verify := func(stored, userPassword string) bool {
+		compared = append(compared, stored)
+		return stored == userPassword
+	}
+
+	for _, allow := range []AuthFunc{
+		AllowUsers(map[string]string{"kataras": "kataras_pass"}, WithVerifier(verify)),
+		AllowUsers([]Map{{"username": "kataras", "password": "kataras_pass"}}, WithVerifier(verify)),
+	} {
+		compared = compared[:0]
+		if _, ok := allow(nil, "unknown", "kataras_pass"); ok {
+			t.Fatalf("expected an unknown username to fail")
+		}
+
+		if len(compared) != 1 || compared[0] != dummyPassword {
+			t.Fatalf("expected a dummy comparison but got: %v", compared)
+		}
+	}
+
+	// The dummy hash must be a valid bcrypt hash so it takes the same time.
+	if _, err := bcrypt.Cost([]byte(dummyBcryptHash)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAllowUsersConstantTime(t *testing.T) {
+	tests := []struct {
+		stored, userPassword string
+		expected             bool
+	}{
+		{"kataras_pass", "kataras_pass", true},
+		{"kataras_pass", "kataras_pasS", false},
+		{"kataras_pass", "kataras", false},
+		{"kataras_pass", "", false},
+		{"", "", true},
+	}
+
+	for i, tt := range tests {
+		if got := comparePlain(tt.stored, tt.userPassword); tt.expected != got {
+			t.Fatalf("[%d] expected %v but got %v", i, tt.expected, got)
+		}
+	}
+
+	// The existent and the nonexistent usernames take the same code path:
+	// a single comparison of the same scheme.
+	var compared []string
+	verify := func(stored, userPassword string) bool {
+		compared = append(compared, stored)
+		return comparePlain(stored, userPassword)
+	}
+	allow := AllowUsers(map[string]string{"kataras": "kataras_pass"}, WithVerifier(verify))
+
+	for _, username := range []string{"kataras", "unknown"} {
+		compared = compared[:0]
+		if _, ok := allow(nil, username, "invalid_pass"); ok {
+			t.Fatalf("%s: expected to fail", username)
+		}
+
+		if len(compared) != 1 {
+			t.Fatalf("%s: expected a single comparison but got: %v", username, compared)
+		}
+	}
+
+	if _, ok := AllowUsers(map[string]string{"kataras": "kataras_pass"})(nil, "kataras", "kataras_pass"); !ok {
+		t.Fatalf("expected the default plain comparison to pass")
+	}
+}
+
+func benchmarkAllowUsersBcrypt(b *testing.B, username string) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("kataras_pass"), bcrypt.DefaultCost)
+	if err != nil {
+		b.Fatal(err)
+	}
+	allow := AllowUsers(map[string]string{"kataras": string(hash)}, BCRYPT)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		allow(nil, username, "invalid_pass")
+	}
+}
+
+// Compare the timings of the two, they should be roughly the same.
+func BenchmarkAllowUsersBcryptExistent(b *testing.B) {
+	benchmarkAllowUsersBcrypt(b, "kataras")
+}
+
+func BenchmarkAllowUsersBcryptNonexistent(b *testing.B) {
+	benchmarkAllowUsersBcrypt(b, "unknown")
+}
+
+func TestAllowUsersSourceEntry(t *testing.T) {
+	type user struct {
+		Username string
+		Password string
+		Role     string
+	}
+
+	var tests = []struct {
+		users    interface{}
+		expected interface{}
+	}{
+		{[]user{{"kataras", "kataras_pass", "admin"}}, user{"kataras", "kataras_pass", "admin"}},
+		{[]*user{{"kataras", "kataras_pass", "admin"}}, &user{"kataras", "kataras_pass", "admin"}},
+		{[]Map{{"username": "kataras", "password": "kataras_pass", "role": "admin"}},
+			Map{"username": "kataras", "password": "kataras_pass", "role": "admin"}},
+		{Map{"kataras": Map{"password": "kataras_pass", "role": "admin"}},
+			Map{"password": "kataras_pass", "role": "admin"}},
+		{map[string]string{"kataras": "kataras_pass"}, &SimpleUser{Username: "kataras", Password: "kataras_pass"}},
+	}
+
+	for i, tt := range tests {
+		auth := New(Options{Allow: AllowUsers(tt.users)})
+
+		var got interface{}
+		handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = GetUser(r)
+		}))
+
+		testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).statusCode(http.StatusOK)
+		if !reflect.DeepEqual(tt.expected, got) {
+			t.Fatalf("[%d] expected user: %#+v but got: %#+v", i, tt.expected, got)
+		}
+	}
+}
+
+func TestAllowUsersMapStringValues(t *testing.T) {
+	users := map[string]string{"kataras": "kataras_pass", "makis": "makis_pass"}
+	allowMap := AllowUsers(users)
+	allowInterface := AllowUsers(Map{"kataras": "kataras_pass", "makis": "makis_pass"})
+
+	users["kataras"] = "modified_pass" // the lookup map is a copy.
+
+	for i, allow := range []AuthFunc{allowMap, allowInterface} {
+		if _, ok := allow(nil, "kataras", "kataras_pass"); !ok {
+			t.Fatalf("[%d] expected kataras to be allowed", i)
+		}
+		if _, ok := allow(nil, "makis", "makis_pass"); !ok {
+			t.Fatalf("[%d] expected makis to be allowed", i)
+		}
+		if _, ok := allow(nil, "makis", "kataras_pass"); ok {
+			t.Fatalf("[%d] expected makis to be rejected", i)
+		}
+	}
+}
+
+func BenchmarkAllowUsersLoadMapString(b *testing.B) {
+	users := make(map[string]string, 50000)
+	for i := 0; i < 50000; i++ {
+		users[fmt.Sprintf("user%d", i)] = fmt.Sprintf("pass%d", i)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		AllowUsers(users)
+	}
+}
+
+func BenchmarkAllowUsersLoadMapRecords(b *testing.B) {
+	users := make(Map, 50000)
+	for i := 0; i < 50000; i++ {
+		users[fmt.Sprintf("user%d", i)] = Map{"password": fmt.Sprintf("pass%d", i)}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		AllowUsers(users)
+	}
+}
+
+type maxTriesUser struct {
+	Username string
+	Password string
+	MaxTries int
+}
+
+func (u maxTriesUser) GetUsername() string { return u.Username }
+func (u maxTriesUser) GetPassword() string { return u.Password }
+func (u maxTriesUser) GetMaxTries() int    { return u.MaxTries }
+
+func TestMaxTriesUser(t *testing.T) {
+	auth := New(Options{
+		Allow: AllowUsers([]maxTriesUser{
+			{"admin", "admin_pass", 1},
+			{"service", "service_pass", 0}, // never locked.
+		}),
+		MaxTries: 3,
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// The admin is locked on the first failure.
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("admin", "invalid_pass")).
+		statusCode(http.StatusForbidden)
+
+	// The service account is never locked.
+	for i := 0; i < 5; i++ {
+		testHandler(t, handler, http.MethodGet, "/", withBasicAuth("service", "invalid_pass")).
+			statusCode(http.StatusUnauthorized)
+	}
+
+	// Unknown users follow the global MaxTries.
+	te := testHandler(t, handler, http.MethodGet, "/", withBasicAuth("unknown", "invalid_pass")).
+		statusCode(http.StatusUnauthorized)
+	te = testHandler(t, handler, http.MethodGet, "/", withBasicAuth("unknown", "invalid_pass"), withCookie(te.cookie(DefaultMaxTriesCookie))).
+		statusCode(http.StatusUnauthorized)
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("unknown", "invalid_pass"), withCookie(te.cookie(DefaultMaxTriesCookie))).
+		statusCode(http.StatusForbidden)
+}
+
+func TestMaxTriesUserOverride(t *testing.T) {
+	users := []maxTriesUser{
+		{"admin", "admin_pass", 2},
+		{"service", "service_pass", 4},
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	// The global MaxTries is zero, the override enables the tries tracking.
+	h := New(Options{Allow: AllowUsers(users)})(handler)
+	te := testHandler(t, h, http.MethodGet, "/", withBasicAuth("admin", "invalid_pass")).
+		statusCode(http.StatusUnauthorized)
+	testHandler(t, h, http.MethodGet, "/", withBasicAuth("admin", "invalid_pass"), withCookie(te.cookie(DefaultMaxTriesCookie))).
+		statusCode(http.StatusForbidden)
+
+	// Server-side, the override is used by the check before the Allow too.
+	h = New(Options{Allow: AllowUsers(users), MaxTriesBy: ByUsername})(handler)
+	testHandler(t, h, http.MethodGet, "/", withBasicAuth("admin", "invalid_pass")).
+		statusCode(http.StatusUnauthorized)
+	testHandler(t, h, http.MethodGet, "/", withBasicAuth("admin", "invalid_pass")).
+		statusCode(http.StatusForbidden)
+	// Locked at the override, even with valid credentials.
+	testHandler(t, h, http.MethodGet, "/", withBasicAuth("admin", "admin_pass")).
+		statusCode(http.StatusForbidden)
+
+	// A higher override than the global MaxTries.
+	h = New(Options{Allow: AllowUsers(users), MaxTries: 1, MaxTriesBy: ByUsername})(handler)
+	for i := 1; i < 4; i++ {
+		testHandler(t, h, http.MethodGet, "/", withBasicAuth("service", "invalid_pass")).
+			statusCode(http.StatusUnauthorized)
+	}
+	testHandler(t, h, http.MethodGet, "/", withBasicAuth("service", "service_pass")).
+		statusCode(http.StatusOK)
+	// Unknown users follow the global MaxTries.
+	testHandler(t, h, http.MethodGet, "/", withBasicAuth("unknown", "invalid_pass")).
+		statusCode(http.StatusForbidden)
+}
+
+type aliasedUser struct {
+	Username string
+	Password string
+	Email    string
+}
+
+func (u aliasedUser) GetAliases() []string {
+	return []string{u.Email}
+}
+
+func TestAliasedUser(t *testing.T) {
+	b, auth := NewBasicAuth(Options{
+		Allow: AllowUsers([]aliasedUser{
+			{"kataras", "kataras_pass", "kataras@example.com"},
+			{"makis", "makis_pass", "kataras"}, // an exact username wins over an alias.
+		}),
+		MaxAge: time.Minute,
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(GetUser(r).(aliasedUser).Username))
+	}))
+
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).
+		statusCode(http.StatusOK).bodyEq("kataras")
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras@example.com", "kataras_pass")).
+		statusCode(http.StatusOK).bodyEq("kataras")
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras@example.com", "makis_pass")).
+		statusCode(http.StatusUnauthorized)
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "makis_pass")).
+		statusCode(http.StatusUnauthorized)
+
+	// Both names map to the same canonical credential.
+	if expected, got := 1, b.Len(); expected != got {
+		t.Fatalf("expected %d stored credentials but got: %d", expected, got)
+	}
+
+	if sessions := b.SessionInfo("kataras"); len(sessions) != 1 {
+		t.Fatalf("expected a single session of the primary username but got: %v", sessions)
+	}
+}
+
+func TestSimpleUserFields(t *testing.T) {
+	var users []Map
+	if err := json.Unmarshal([]byte(`[{"username":"kataras","password":"kataras_pass","role":"admin","age":27,"score":9.5}]`), &users); err != nil {
+		t.Fatal(err)
+	}
+
+	allow := AllowUsers(users)
+	auth := New(Options{
+		Allow: func(r *http.Request, username, password string) (interface{}, bool) {
+			v, ok := allow(r, username, password)
+			if !ok {
+				return v, false
+			}
+
+			// Populate the fields from the map record.
+			return &SimpleUser{Username: username, Password: password, Fields: v.(Map)}, true
+		},
+	})
+
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u := GetUser(r).(*SimpleUser)
+
+		role, _ := u.GetString("role")
+		age, _ := u.GetInt("age")
+		_, isInt := u.GetInt("score")
+		_, isString := u.GetString("age")
+		_, exists := u.Get("missing")
+		v, _ := u.Get("username")
+
+		fmt.Fprintf(w, "%s %d %v %v %v %v", role, age, isInt, isString, exists, v)
+	}))
+
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).
+		statusCode(http.StatusOK).bodyEq("admin 27 false false false kataras")
+
+	// Without fields.
+	u := &SimpleUser{Username: "kataras"}
+	if _, ok := u.Get("role"); ok {
+		t.Fatalf("expected no fields")
+	}
+	if _, ok := u.GetInt("age"); ok {
+		t.Fatalf("expected no fields")
+	}
+}
+
+type expiringUser struct {
+	Username string
+	Password string
+	TTL      time.Duration
+}
+
+func (u expiringUser) GetUsername() string      { return u.Username }
+func (u expiringUser) GetPassword() string      { return u.Password }
+func (u expiringUser) ExpiresIn() time.Duration { return u.TTL }
+
+func TestExpiringUser(t *testing.T) {
+	b, auth := NewBasicAuth(Options{
+		Allow: AllowUsers([]expiringUser{
+			{"admin", "admin_pass", 5 * time.Minute},
+			{"service", "service_pass", 6 * time.Hour},
+			{"default", "default_pass", 0},              // the global MaxAge.
+			{"limited", "limited_pass", 48 * time.Hour}, // the MaxAgeLimit.
+		}),
+		MaxAge:      time.Hour,
+		MaxAgeLimit: 24 * time.Hour,
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	var tests = []struct {
+		username string
+		expected time.Duration
+	}{
+		{"admin", 5 * time.Minute},
+		{"service", 6 * time.Hour},
+		{"default", time.Hour},
+		{"limited", 24 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		testHandler(t, handler, http.MethodGet, "/", withBasicAuth(tt.username, tt.username+"_pass")).
+			statusCode(http.StatusOK)
+
+		sessions := b.SessionInfo(tt.username)
+		if len(sessions) != 1 || sessions[0].ExpiresAt == nil {
+			t.Fatalf("[%s] expected a single session with expiration but got: %v", tt.username, sessions)
+		}
+
+		if got := sessions[0].ExpiresAt.Sub(sessions[0].FirstSeen); tt.expected != got {
+			t.Fatalf("[%s] expected max age: %s but got: %s", tt.username, tt.expected, got)
+		}
+	}
+}
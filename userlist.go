@@ -0,0 +1,158 @@
+package basicauth
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// UserList is a user list which can be modified at runtime,
+// e.g. through an admin panel, without restarting the application.
+// Its Allow method is the AuthFunc of the Options.Allow field.
+// It is safe for concurrent use.
+//
+// A removed user fails on its next request, even if it has a stored credential,
+// the client receives an ErrCredentialsRotated error.
+// Note that the Options.CacheAllow skips the Allow call until the credential expires.
+//
+// Usage:
+//
+//	users := NewUserList([]User{...}, BCRYPT)
+//	New(Options{Allow: users.Allow})
+//	users.AddUser(&SimpleUser{Username: "makis", Password: "$2a$10$..."})
+//	users.RemoveUser("kataras")
+type UserList struct {
+	options UserAuthOptions
+
+	mu       sync.RWMutex
+	index    map[string]*userEntry
+	patterns userPatternList
+}
+
+// NewUserList returns a new UserList of the given users.
+// The accepted forms of the users and the options are the same as the AllowUsers ones.
+// It panics on an invalid stored password (see UserAuthOptions.ValidateHash and PasswordPolicy).
+func NewUserList(users interface{}, opts ...UserAuthOption) *UserList {
+	l := &UserList{options: toUserAuthOptions(opts)}
+	if err := l.SetUsers(users); err != nil {
+		panic(err.Error())
+	}
+
+	return l
+}
+
+// Allow reports whether the given username:password combination is allowed,
+// it completes the AuthFunc type. See AllowUsers.
+func (l *UserList) Allow(_ *http.Request, username, password string) (interface{}, bool) {
+	l.mu.RLock()
+	u, ok := l.index[username] // fast map access,
+	if !ok && len(l.patterns) > 0 {
+		u, ok = l.patterns.match(username)
+	}
+	l.mu.RUnlock()
+
+	options := &l.options
+	if !ok {
+		// Compare anyway, so an unknown username takes the same time.
+		options.ComparePassword(options.DummyPassword, password)
+		return ErrUserNotFound{Username: username}, false
+	}
+
+	if options.ComparePassword(u.password, password) {
+		if options.isCompromised(password) {
+			return ErrPasswordCompromised{Username: username, User: u.ref}, false
+		}
+
+		return u.ref, true
+	}
+
+	return ErrPasswordMismatch{Username: username, User: u.ref}, false
+}
+
+var errInvalidUser = errors.New("user: username and password are required")
+
+// AddUser adds the given user, e.g. a User value or a map record, to the list.
+// It replaces the existing one of the same username, including its aliases (see AliasedUser).
+// It returns an error if the user has no username and password
+// or its password is not valid (see UserAuthOptions.ValidateHash and PasswordPolicy).
+func (l *UserList) AddUser(user interface{}) error {
+	username, password, ok := extractUsernameAndPassword(user)
+	if !ok {
+		return errInvalidUser
+	}
+
+	if err := l.options.checkPassword(username, password); err != nil {
+		return err
+	}
+
+	entries := indexUsers([]interface{}{user})
+
+	l.mu.Lock()
+	l.removeLocked(username)
+	for name, u := range entries {
+		// The username always wins, an alias is added only if it's not taken.
+		if _, exists := l.index[name]; !exists || name == username {
+			l.index[name] = u
+		}
+	}
+	l.patterns = userPatterns(l.index)
+	l.mu.Unlock()
+
+	return nil
+}
+
+// RemoveUser removes the user of the given username (or alias), including its aliases,
+// and reports whether it was part of the list.
+func (l *UserList) RemoveUser(username string) bool {
+	l.mu.Lock()
+	removed := l.removeLocked(username)
+	if removed {
+		l.patterns = userPatterns(l.index)
+	}
+	l.mu.Unlock()
+
+	return removed
+}
+
+func (l *UserList) removeLocked(username string) bool {
+	u, ok := l.index[username]
+	if !ok {
+		return false
+	}
+
+	for name, entry := range l.index {
+		if entry == u {
+			delete(l.index, name)
+		}
+	}
+
+	return true
+}
+
+// SetUsers replaces all the users of the list.
+// The accepted forms are the same as the AllowUsers ones.
+// On an invalid password the list is not modified and the error is returned.
+func (l *UserList) SetUsers(users interface{}) error {
+	index := indexUsers(users)
+	for username, u := range index {
+		if err := l.options.checkPassword(username, u.password); err != nil {
+			return err
+		}
+	}
+	patterns := userPatterns(index)
+
+	l.mu.Lock()
+	l.index = index
+	l.patterns = patterns
+	l.mu.Unlock()
+
+	return nil
+}
+
+// Len returns the number of the users, including the aliases.
+func (l *UserList) Len() int {
+	l.mu.RLock()
+	n := len(l.index)
+	l.mu.RUnlock()
+	return n
+}
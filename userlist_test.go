@@ -0,0 +1,135 @@
+package basicauth
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUserList(t *testing.T) {
+	users := NewUserList([]User{&SimpleUser{Username: "kataras", Password: "kataras_pass"}})
+	b, auth := NewBasicAuth(Options{Allow: users.Allow, MaxAge: time.Hour})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(GetUsername(r)))
+	}))
+
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).
+		statusCode(http.StatusOK).bodyEq("kataras")
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("makis", "makis_pass")).
+		statusCode(http.StatusUnauthorized)
+
+	if err := users.AddUser(Map{"username": "makis", "password": "makis_pass"}); err != nil {
+		t.Fatal(err)
+	}
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("makis", "makis_pass")).
+		statusCode(http.StatusOK).bodyEq("makis")
+
+	// Replaced.
+	if err := users.AddUser(&SimpleUser{Username: "makis", Password: "makis_new_pass"}); err != nil {
+		t.Fatal(err)
+	}
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("makis", "makis_new_pass")).
+		statusCode(http.StatusOK).bodyEq("makis")
+
+	if err := users.AddUser(&SimpleUser{Username: "invalid"}); err == nil {
+		t.Fatalf("expected an error of a user without password")
+	}
+
+	// The existing session fails on the next request.
+	if !users.RemoveUser("kataras") {
+		t.Fatalf("expected kataras to be removed")
+	}
+	if users.RemoveUser("kataras") {
+		t.Fatalf("expected kataras to be already removed")
+	}
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("kataras", "kataras_pass")).
+		statusCode(http.StatusUnauthorized)
+	if sessions := b.SessionInfo("kataras"); len(sessions) != 0 {
+		t.Fatalf("expected the session of the removed user to be cleared but got: %v", sessions)
+	}
+
+	if err := users.SetUsers(map[string]string{"gerasimos": "gerasimos_pass"}); err != nil {
+		t.Fatal(err)
+	}
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("makis", "makis_new_pass")).
+		statusCode(http.StatusUnauthorized)
+	testHandler(t, handler, http.MethodGet, "/", withBasicAuth("gerasimos", "gerasimos_pass")).
+		statusCode(http.StatusOK)
+
+	if expected, got := 1, users.Len(); expected != got {
+		t.Fatalf("expected %d users but got: %d", expected, got)
+	}
+}
+
+func TestUserListAliases(t *testing.T) {
+	users := NewUserList([]aliasedUser{{Username: "kataras", Password: "kataras_pass", Email: "kataras@example.com"}})
+
+	for _, u := range []aliasedUser{
+		{Username: "makis", Password: "makis_pass", Email: "kataras"},
+		{Username: "gerasimos", Password: "gerasimos_pass", Email: "gerasimos@example.com"},
+	} {
+		if err := users.AddUser(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// An exact username wins over an alias.
+	if _, ok := users.Allow(nil, "kataras", "kataras_pass"); !ok {
+		t.Fatalf("expected kataras to be allowed")
+	}
+	if _, ok := users.Allow(nil, "gerasimos@example.com", "gerasimos_pass"); !ok {
+		t.Fatalf("expected the gerasimos alias to be allowed")
+	}
+
+	users.RemoveUser("kataras@example.com")
+	for _, username := range []string{"kataras", "kataras@example.com"} {
+		if _, ok := users.Allow(nil, username, "kataras_pass"); ok {
+			t.Fatalf("expected %q to be removed", username)
+		}
+	}
+}
+
+func TestUserListValidation(t *testing.T) {
+	users := NewUserList([]Map{{"username": "kataras", "password": "$2a$10$fmxY9Ky3z4vRtqn8CmX1FeVt.7BOn5ouSzp5jjiSaIkKmMd6Sx4Nu"}}, BCRYPT, SHACRYPT)
+
+	if err := users.AddUser(Map{"username": "makis", "password": "plain_pass"}); err == nil || !strings.Contains(err.Error(), `user "makis": unsupported password hash`) {
+		t.Fatalf("expected an unsupported hash error but got: %v", err)
+	}
+
+	if err := users.SetUsers([]Map{{"username": "makis", "password": "plain_pass"}}); err == nil {
+		t.Fatalf("expected an unsupported hash error")
+	}
+
+	// Not modified.
+	if expected, got := 1, users.Len(); expected != got {
+		t.Fatalf("expected %d users but got: %d", expected, got)
+	}
+}
+
+func TestUserListConcurrent(t *testing.T) {
+	users := NewUserList([]Map{{"username": "kataras", "password": "kataras_pass"}})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				users.AddUser(Map{"username": "makis", "password": "makis_pass"})
+				users.RemoveUser("makis")
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if _, ok := users.Allow(nil, "kataras", "kataras_pass"); !ok {
+					t.Errorf("expected kataras to be allowed")
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,88 @@
+package basicauth
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+)
+
+// DefaultWatchEvery is the default interval which the AllowUsersFileWatch
+// checks the users file for changes.
+const DefaultWatchEvery = 5 * time.Second
+
+// AllowUsersFileWatch same as AllowUsersFile but it reloads the user list
+// when the file changes, e.g. a users.yml deployed through a Kubernetes config map.
+// The file's modification time and size are checked every "every" duration
+// (defaults to DefaultWatchEvery) until the "ctx" is done.
+// The new user list replaces the previous one atomically, see UserList.
+//
+// A malformed (or invalid, see UserAuthOptions.ValidateHash and PasswordPolicy) file on reload
+// is logged through the standard logger and the previous user list keeps being served.
+// Note that the initial load panics on a malformed file, as AllowUsersFile does,
+// and that the file should exist on the disk, even if the ReadFile is customized.
+//
+// Example Code:
+//
+//	New(Options{Allow: AllowUsersFileWatch(ctx, "users.yml", 10*time.Second, BCRYPT)})
+func AllowUsersFileWatch(ctx context.Context, jsonOrYamlFilename string, every time.Duration, opts ...UserAuthOption) AuthFunc {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if every <= 0 {
+		every = DefaultWatchEvery
+	}
+
+	info, err := os.Stat(jsonOrYamlFilename)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	users, err := loadUsersFile(jsonOrYamlFilename, nil)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	list := NewUserList(users, opts...)
+	go watchUsersFile(ctx, list, jsonOrYamlFilename, every, info)
+
+	return list.Allow
+}
+
+// watchUsersFile reloads the users of the given list when the file changes.
+func watchUsersFile(ctx context.Context, list *UserList, filename string, every time.Duration, last os.FileInfo) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			info, err := os.Stat(filename)
+			if err != nil {
+				log.Printf("BasicAuth: users file: %v", err)
+				continue
+			}
+
+			if info.ModTime().Equal(last.ModTime()) && info.Size() == last.Size() {
+				continue
+			}
+			last = info
+
+			if err = reloadUsersFile(list, filename); err != nil {
+				log.Printf("BasicAuth: users file: reload: %v, the previous users are kept", err)
+			}
+		}
+	}
+}
+
+func reloadUsersFile(list *UserList, filename string) error {
+	users, err := loadUsersFile(filename, nil)
+	if err != nil {
+		return err
+	}
+
+	return list.SetUsers(users)
+}
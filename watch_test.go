@@ -0,0 +1,82 @@
+package basicauth
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer which is safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestAllowUsersFileWatch(t *testing.T) {
+	var logs syncBuffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	filename := filepath.Join(t.TempDir(), "users.yml")
+	if err := os.WriteFile(filename, []byte("kataras: kataras_pass\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	allow := AllowUsersFileWatch(ctx, filename, 10*time.Millisecond)
+	if _, ok := allow(nil, "kataras", "kataras_pass"); !ok {
+		t.Fatalf("expected kataras to be allowed")
+	}
+
+	eventually := func(cond func() bool) bool {
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if cond() {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	// Reloaded.
+	if err := os.WriteFile(filename, []byte("- username: makis\n  password: makis_pass\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if !eventually(func() bool { _, ok := allow(nil, "makis", "makis_pass"); return ok }) {
+		t.Fatalf("expected makis to be allowed after reload")
+	}
+	if _, ok := allow(nil, "kataras", "kataras_pass"); ok {
+		t.Fatalf("expected kataras to be removed after reload")
+	}
+
+	// Malformed, the previous users are kept.
+	if err := os.WriteFile(filename, []byte("{{{ malformed"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if !eventually(func() bool { return strings.Contains(logs.String(), "the previous users are kept") }) {
+		t.Fatalf("expected the reload error to be logged but got: %q", logs.String())
+	}
+	if _, ok := allow(nil, "makis", "makis_pass"); !ok {
+		t.Fatalf("expected makis to be still allowed after a malformed reload")
+	}
+}
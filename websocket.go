@@ -0,0 +1,56 @@
+package basicauth
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strings"
+)
+
+// webSocketProtocols returns the offered protocols of the Sec-WebSocket-Protocol request header.
+func webSocketProtocols(r *http.Request) []string {
+	var protocols []string
+	for _, value := range r.Header.Values(webSocketProtocolHeaderKey) {
+		for _, protocol := range strings.Split(value, ",") {
+			if protocol = strings.TrimSpace(protocol); protocol != "" {
+				protocols = append(protocols, protocol)
+			}
+		}
+	}
+
+	return protocols
+}
+
+// webSocketProtocolHeader returns the credentials of the Options.WebSocketProtocol entry
+// as an authorization header value, or empty if not found or malformed.
+func (b *BasicAuth) webSocketProtocolHeader(r *http.Request) string {
+	prefix := b.opts.WebSocketProtocol + "."
+	for _, protocol := range webSocketProtocols(r) {
+		if !strings.HasPrefix(protocol, prefix) {
+			continue
+		}
+
+		fullUser, err := base64.RawURLEncoding.DecodeString(protocol[len(prefix):])
+		if err != nil {
+			return ""
+		}
+
+		return basicSpaceLiteral + base64.StdEncoding.EncodeToString(fullUser)
+	}
+
+	return ""
+}
+
+// echoWebSocketProtocol sets the Options.WebSocketProtocol on the response
+// when the client offered it, see Options.WebSocketProtocol.
+func (b *BasicAuth) echoWebSocketProtocol(w http.ResponseWriter, r *http.Request) {
+	if b.opts.WebSocketProtocol == "" {
+		return
+	}
+
+	for _, protocol := range webSocketProtocols(r) {
+		if protocol == b.opts.WebSocketProtocol {
+			w.Header().Set(webSocketProtocolHeaderKey, protocol)
+			return
+		}
+	}
+}
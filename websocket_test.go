@@ -0,0 +1,56 @@
+package basicauth
+
+import (
+	"encoding/base64"
+	"net/http"
+	"testing"
+)
+
+func TestWebSocketProtocol(t *testing.T) {
+	b, auth := NewBasicAuth(Options{
+		Allow:             AllowUsers(map[string]string{"kataras": "kataras_pass"}),
+		WebSocketProtocol: "basicauth",
+	})
+	handler := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/logout" {
+			Logout(r)
+			return
+		}
+
+		w.Write([]byte(GetUsername(r)))
+	}))
+
+	credentials := "basicauth." + base64.RawURLEncoding.EncodeToString([]byte("kataras:kataras_pass"))
+	handshake := func(protocols string) []requestOption {
+		return []requestOption{
+			withHeader("Connection", "Upgrade"),
+			withHeader("Upgrade", "websocket"),
+			withHeader("Sec-WebSocket-Version", "13"),
+			withHeader("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ=="),
+			withHeader("Sec-WebSocket-Protocol", protocols),
+		}
+	}
+
+	testHandler(t, handler, http.MethodGet, "/", handshake("basicauth, "+credentials)...).
+		statusCode(http.StatusOK).headerEq("Sec-WebSocket-Protocol", "basicauth").bodyEq("kataras")
+	// The credentials entry alone, nothing to echo.
+	testHandler(t, handler, http.MethodGet, "/", handshake(credentials)...).
+		statusCode(http.StatusOK).headerEq("Sec-WebSocket-Protocol", "").bodyEq("kataras")
+
+	invalid := "basicauth." + base64.RawURLEncoding.EncodeToString([]byte("kataras:invalid_pass"))
+	testHandler(t, handler, http.MethodGet, "/", handshake("basicauth, "+invalid)...).
+		statusCode(http.StatusUnauthorized).headerEq("Sec-WebSocket-Protocol", "")
+	testHandler(t, handler, http.MethodGet, "/", handshake("basicauth, basicauth.!malformed")...).
+		statusCode(http.StatusUnauthorized)
+	testHandler(t, handler, http.MethodGet, "/", handshake("chat")...).
+		statusCode(http.StatusUnauthorized)
+
+	// The authorization header has priority.
+	testHandler(t, handler, http.MethodGet, "/", append(handshake(invalid), withBasicAuth("kataras", "kataras_pass"))...).
+		statusCode(http.StatusOK)
+
+	testHandler(t, handler, http.MethodGet, "/logout", handshake(credentials)...).statusCode(http.StatusOK)
+	if expected, got := 0, b.Len(); expected != got {
+		t.Fatalf("expected %d stored credentials after logout but got: %d", expected, got)
+	}
+}